@@ -7,6 +7,7 @@ import (
 
 	"github.com/grussorusso/serverledge/internal/cli"
 	"github.com/grussorusso/serverledge/internal/config"
+	"github.com/grussorusso/serverledge/utils"
 )
 
 func main() {
@@ -15,6 +16,8 @@ func main() {
 	// Set defaults
 	cli.ServerConfig.Host = "127.0.0.1"
 	cli.ServerConfig.Port = config.GetInt("api.port", 1323)
+	cli.ServerConfig.APIKey = config.GetString(config.CLIENT_API_KEY, "")
+	cli.ServerConfig.Namespace = config.GetString(config.CLIENT_NAMESPACE, "")
 
 	// Check for environment variables
 	if envHost, ok := os.LookupEnv("SERVERLEDGE_HOST"); ok {
@@ -28,5 +31,21 @@ func main() {
 		}
 	}
 
+	if envKey, ok := os.LookupEnv("SERVERLEDGE_API_KEY"); ok {
+		cli.ServerConfig.APIKey = envKey
+	}
+	if envNamespace, ok := os.LookupEnv("SERVERLEDGE_NAMESPACE"); ok {
+		cli.ServerConfig.Namespace = envNamespace
+	}
+
+	if config.GetBool(config.CLIENT_TLS_ENABLED, false) {
+		tlsConfig, err := utils.LoadTLSConfig(config.GetString(config.CLIENT_TLS_CERT, ""),
+			config.GetString(config.CLIENT_TLS_KEY, ""), config.GetString(config.CLIENT_TLS_CA, ""))
+		if err != nil {
+			log.Fatalf("Invalid TLS configuration: %v\n", err)
+		}
+		cli.SetTLSConfig(tlsConfig)
+	}
+
 	cli.Init()
 }
@@ -1,14 +1,42 @@
 package main
 
 import (
-	"fmt"
 	"log"
+	"net"
 	"net/http"
+	"os"
+	"strconv"
 
 	"github.com/grussorusso/serverledge/internal/executor"
 )
 
 func main() {
+	port := executor.DEFAULT_EXECUTOR_PORT
+	if envPort, ok := os.LookupEnv(executor.PORT_ENV_VAR); ok {
+		if iPort, err := strconv.Atoi(envPort); err == nil {
+			port = iPort
+		} else {
+			log.Fatalf("Invalid port number: %s\n", envPort)
+		}
+	}
+
+	host := os.Getenv(executor.HOST_ENV_VAR)
+	listener, err := net.Listen("tcp", net.JoinHostPort(host, strconv.Itoa(port)))
+	if err != nil {
+		log.Fatal(err)
+	}
+	if portFile, ok := os.LookupEnv(executor.PORT_FILE_ENV_VAR); ok {
+		// the file is renamed, so that readers never see partial content
+		port = listener.Addr().(*net.TCPAddr).Port
+		tmpFile := portFile + ".tmp"
+		if err := os.WriteFile(tmpFile, []byte(strconv.Itoa(port)), 0644); err != nil {
+			log.Fatal(err)
+		}
+		if err := os.Rename(tmpFile, portFile); err != nil {
+			log.Fatal(err)
+		}
+	}
+
 	http.HandleFunc("/invoke", executor.InvokeHandler)
-	log.Fatal(http.ListenAndServe(fmt.Sprintf(":%d", executor.DEFAULT_EXECUTOR_PORT), nil))
+	log.Fatal(http.Serve(listener, nil))
 }
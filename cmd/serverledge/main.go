@@ -13,13 +13,17 @@ import (
 
 	"golang.org/x/net/context"
 
+	"github.com/grussorusso/serverledge/internal/admission"
 	"github.com/grussorusso/serverledge/internal/api"
+	"github.com/grussorusso/serverledge/internal/auth"
 	"github.com/grussorusso/serverledge/internal/cache"
 	"github.com/grussorusso/serverledge/internal/config"
+	"github.com/grussorusso/serverledge/internal/function"
 	"github.com/grussorusso/serverledge/internal/metrics"
 	"github.com/grussorusso/serverledge/internal/registration"
 	"github.com/grussorusso/serverledge/internal/scheduling"
 	"github.com/grussorusso/serverledge/internal/telemetry"
+	"github.com/grussorusso/serverledge/internal/trigger"
 	"github.com/grussorusso/serverledge/utils"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
@@ -29,19 +33,41 @@ func startAPIServer(e *echo.Echo) {
 	e.Use(middleware.Recover())
 
 	// Routes
-	e.POST("/invoke/:fun", api.InvokeFunction)
-	e.POST("/prewarm", api.PrewarmFunction)
-	e.POST("/create", api.CreateFunction)
-	e.POST("/delete", api.DeleteFunction)
-	e.GET("/function", api.GetFunctions)
-	e.GET("/poll/:reqId", api.PollAsyncResult)
-	e.GET("/status", api.GetServerStatus)
+	invoke := auth.Middleware(auth.ROLE_INVOKE)
+	deploy := auth.Middleware(auth.ROLE_DEPLOY)
+	e.POST("/invoke/:fun", api.InvokeFunction, invoke)
+	e.POST("/prewarm", api.PrewarmFunction, deploy)
+	e.POST("/create", api.CreateFunction, deploy)
+	e.POST("/delete", api.DeleteFunction, deploy)
+	e.POST("/publish", api.PublishFunction, deploy)
+	e.POST("/update", api.UpdateFunction, deploy)
+	e.POST("/alias", api.SetFunctionAlias, deploy)
+	e.GET("/function", api.GetFunctions, auth.Middleware(""))
+	e.GET("/function/:name", api.GetFunction, auth.Middleware(""))
+	e.GET("/function/:name/schema", api.GetFunctionSchema, auth.Middleware(""))
+	e.POST("/workflow/invoke/:name", api.InvokeWorkflow, invoke)
+	e.POST("/workflow/create", api.CreateWorkflow, deploy)
+	e.POST("/workflow/delete", api.DeleteWorkflow, deploy)
+	e.GET("/workflow", api.GetWorkflows, auth.Middleware(""))
+	e.POST("/trigger/create", api.CreateTrigger, deploy)
+	e.POST("/trigger/delete", api.DeleteTrigger, deploy)
+	e.GET("/trigger", api.GetTriggers, auth.Middleware(""))
+	e.GET("/trigger/:name/history", api.GetTriggerHistory, auth.Middleware(""))
+	e.GET("/poll/:reqId", api.PollAsyncResult, invoke)
+	e.GET("/poll/:reqId/stream", api.StreamAsyncStatus, invoke)
+	e.GET("/status", api.GetServerStatus, auth.Middleware(""))
 
 	// Start server
 	portNumber := config.GetInt(config.API_PORT, 1323)
 	e.HideBanner = true
 
-	if err := e.Start(fmt.Sprintf(":%d", portNumber)); err != nil && !errors.Is(err, http.ErrServerClosed) {
+	tlsConfig, err := utils.ServerTLSConfig()
+	if err != nil {
+		log.Fatalf("Invalid TLS configuration: %v\n", err)
+	}
+	e.Server.Addr = fmt.Sprintf(":%d", portNumber)
+	e.Server.TLSConfig = tlsConfig
+	if err := e.StartServer(e.Server); err != nil && !errors.Is(err, http.ErrServerClosed) {
 		e.Logger.Fatal("shutting down the server")
 	}
 }
@@ -84,6 +110,7 @@ func registerTerminationHandler(r *registration.Registry, e *echo.Echo) {
 
 			//stop container janitor
 			node.StopJanitor()
+			node.StopPrewarming()
 
 			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 			defer cancel()
@@ -106,6 +133,13 @@ func main() {
 	//setting up cache parameters
 	cacheSetup()
 
+	// rate and concurrency limits for invocations
+	admission.Init()
+
+	if err := auth.Init(); err != nil {
+		log.Fatal(err)
+	}
+
 	// register to etcd, this way server is visible to the others under a given local area
 	registry := new(registration.Registry)
 	isInCloud := config.GetBool(config.IS_IN_CLOUD, false)
@@ -121,7 +155,7 @@ func main() {
 		log.Fatal(err)
 	}
 
-	url := fmt.Sprintf("http://%s:%d", utils.GetIpAddress().String(), config.GetInt(config.API_PORT, 1323))
+	url := fmt.Sprintf("%s://%s:%d", utils.APIScheme(), utils.GetIpAddress().String(), config.GetInt(config.API_PORT, 1323))
 	myKey, err := registry.RegisterToEtcd(url)
 	if err != nil {
 		log.Fatal(err)
@@ -157,6 +191,24 @@ func main() {
 	schedulingPolicy := createSchedulingPolicy()
 	go scheduling.Run(schedulingPolicy)
 
+	// cron triggers are fired by a single node in the area
+	trigger.Start(registry.Area, myKey)
+
+	// keep the local function cache and warm pools consistent with the
+	// changes made by any node
+	go func() {
+		err := function.WatchChanges(context.Background(), function.ChangeHandlers{
+			OnDelete: func(funcName string) {
+				node.ShutdownWarmContainersFor(&function.Function{Name: funcName})
+			},
+			OnRetire: node.RetireVersionsBefore,
+			Known:    node.LocalFunctions,
+		})
+		if err != nil {
+			log.Printf("Stopped watching function changes: %v\n", err)
+		}
+	}()
+
 	if !isInCloud {
 		err = registration.InitEdgeMonitoring(registry)
 		if err != nil {
@@ -177,6 +229,8 @@ func createSchedulingPolicy() scheduling.Policy {
 		return &scheduling.CloudEdgePolicy{}
 	} else if policyConf == "edgeonly" {
 		return &scheduling.EdgePolicy{}
+	} else if policyConf == "qosaware" {
+		return &scheduling.QoSAwarePolicy{}
 	} else {
 		return &scheduling.DefaultLocalPolicy{}
 	}
@@ -0,0 +1,233 @@
+// Package admission limits the rate and the concurrency of invocations,
+// both per function and per client identity (see auth.Identity), before they
+// reach the scheduler.
+package admission
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/grussorusso/serverledge/internal/config"
+)
+
+// Reasons for rejecting a request
+const (
+	FUNCTION_RATE        = "function_rate"
+	FUNCTION_CONCURRENCY = "function_concurrency"
+	KEY_RATE             = "key_rate"
+	KEY_CONCURRENCY      = "key_concurrency"
+)
+
+// suggested delay before retrying requests rejected because of concurrency
+const concurrencyRetryAfter = 1 * time.Second
+
+// limiters of idle functions/keys are removed beyond this number
+const maxIdleLimiters = 1024
+
+// Limits configures the admission of requests (0 -> unlimited).
+type Limits struct {
+	Rate           float64 // requests per second
+	Burst          int     // max. requests admitted at once (default: max(1, Rate))
+	MaxConcurrency int     // max. requests being served
+}
+
+// RejectedErr is returned for requests that exceed the limits.
+type RejectedErr struct {
+	Reason     string
+	RetryAfter time.Duration
+}
+
+func (e *RejectedErr) Error() string {
+	return fmt.Sprintf("request rejected (%s), retry after %v", e.Reason, e.RetryAfter)
+}
+
+// tokenBucket is a token bucket whose tokens are refilled at a constant rate.
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func (b *tokenBucket) refill(now time.Time) {
+	b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+}
+
+// wait returns the time to wait for a token to be available.
+func (b *tokenBucket) wait() time.Duration {
+	if b.tokens >= 1.0 {
+		return 0
+	}
+	return time.Duration((1.0 - b.tokens) / b.rate * float64(time.Second))
+}
+
+type limiter struct {
+	limits  Limits
+	bucket  *tokenBucket // nil if the rate is unlimited
+	running int
+}
+
+func newLimiter(limits Limits, now time.Time) *limiter {
+	l := &limiter{limits: limits}
+	if limits.Rate > 0 {
+		burst := float64(limits.Burst)
+		if burst < 1 {
+			burst = math.Max(1.0, limits.Rate)
+		}
+		l.bucket = &tokenBucket{rate: limits.Rate, burst: burst, tokens: burst, last: now}
+	}
+	return l
+}
+
+// check returns the reason (if any) to reject a request, along with the
+// suggested delay before retrying.
+func (l *limiter) check(now time.Time, rateReason, concurrencyReason string) (string, time.Duration) {
+	if l.bucket != nil {
+		l.bucket.refill(now)
+		if wait := l.bucket.wait(); wait > 0 {
+			return rateReason, wait
+		}
+	}
+	if l.limits.MaxConcurrency > 0 && l.running >= l.limits.MaxConcurrency {
+		return concurrencyReason, concurrencyRetryAfter
+	}
+	return "", 0
+}
+
+func (l *limiter) acquire() {
+	if l.bucket != nil {
+		l.bucket.tokens -= 1.0
+	}
+	l.running++
+}
+
+func (l *limiter) isIdle(now time.Time) bool {
+	if l.running > 0 {
+		return false
+	}
+	if l.bucket != nil {
+		l.bucket.refill(now)
+		return l.bucket.tokens >= l.bucket.burst
+	}
+	return true
+}
+
+// Controller enforces the limits of functions and client identities.
+type Controller struct {
+	sync.Mutex
+	functionLimits func(name string) Limits
+	keyLimits      func(key string) Limits
+	functions      map[string]*limiter
+	keys           map[string]*limiter
+	now            func() time.Time
+}
+
+// NewController creates a Controller, which retrieves the limits of each
+// function and identity through the given functions.
+func NewController(functionLimits func(string) Limits, keyLimits func(string) Limits) *Controller {
+	return &Controller{
+		functionLimits: functionLimits,
+		keyLimits:      keyLimits,
+		functions:      make(map[string]*limiter),
+		keys:           make(map[string]*limiter),
+		now:            time.Now,
+	}
+}
+
+// Admit checks whether a new request for the function, issued by the given
+// client identity (possibly empty, e.g., for triggers), can be admitted. If so, the returned function
+// must be called when the request has been served; otherwise, a *RejectedErr
+// is returned.
+func (c *Controller) Admit(funcName string, identity string) (func(), error) {
+	c.Lock()
+	defer c.Unlock()
+
+	now := c.now()
+	fl := c.getLimiter(c.functions, funcName, c.functionLimits, now)
+	if reason, wait := fl.check(now, FUNCTION_RATE, FUNCTION_CONCURRENCY); reason != "" {
+		return nil, &RejectedErr{Reason: reason, RetryAfter: wait}
+	}
+	var kl *limiter
+	if identity != "" {
+		kl = c.getLimiter(c.keys, identity, c.keyLimits, now)
+		if reason, wait := kl.check(now, KEY_RATE, KEY_CONCURRENCY); reason != "" {
+			return nil, &RejectedErr{Reason: reason, RetryAfter: wait}
+		}
+	}
+
+	fl.acquire()
+	if kl != nil {
+		kl.acquire()
+	}
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			c.Lock()
+			defer c.Unlock()
+			fl.running--
+			if kl != nil {
+				kl.running--
+			}
+		})
+	}, nil
+}
+
+// getLimiter returns the limiter for the given name, creating it if needed.
+// The function is NOT thread-safe.
+func (c *Controller) getLimiter(limiters map[string]*limiter, name string, limitsOf func(string) Limits, now time.Time) *limiter {
+	l, ok := limiters[name]
+	if ok {
+		return l
+	}
+
+	if len(limiters) >= maxIdleLimiters {
+		for n, other := range limiters {
+			if other.isIdle(now) {
+				delete(limiters, n)
+			}
+		}
+	}
+
+	l = newLimiter(limitsOf(name), now)
+	limiters[name] = l
+	return l
+}
+
+var defaultController *Controller
+
+// Init creates the Controller used by Admit, based on the configuration.
+func Init() {
+	defaultController = NewController(
+		func(name string) Limits {
+			return limitsFromConfig(config.ADMISSION_FUNCTION_LIMITS, config.ADMISSION_FUNCTION_OVERRIDES+"."+name)
+		},
+		func(key string) Limits {
+			return limitsFromConfig(config.ADMISSION_KEY_LIMITS, config.ADMISSION_KEY_OVERRIDES+"."+key)
+		})
+}
+
+// limitsFromConfig reads the limits configured under the override prefix,
+// falling back to the defaults.
+func limitsFromConfig(defaultPrefix string, overridePrefix string) Limits {
+	get := func(suffix string) float64 {
+		return config.GetFloat(overridePrefix+suffix, config.GetFloat(defaultPrefix+suffix, 0))
+	}
+	return Limits{
+		Rate:           get(config.ADMISSION_RATE),
+		Burst:          int(get(config.ADMISSION_BURST)),
+		MaxConcurrency: int(get(config.ADMISSION_CONCURRENCY)),
+	}
+}
+
+// Admit checks a new request against the configured limits
+// (see Controller.Admit). Every request is admitted if Init has not been called.
+func Admit(funcName string, identity string) (func(), error) {
+	if defaultController == nil {
+		return func() {}, nil
+	}
+	return defaultController.Admit(funcName, identity)
+}
@@ -0,0 +1,91 @@
+package admission
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// newTestController returns a Controller driven by a manual clock.
+func newTestController(functionLimits, keyLimits Limits) (*Controller, *time.Time) {
+	now := time.Unix(0, 0)
+	c := NewController(func(string) Limits { return functionLimits }, func(string) Limits { return keyLimits })
+	c.now = func() time.Time { return now }
+	return c, &now
+}
+
+func expectRejection(t *testing.T, err error, reason string) *RejectedErr {
+	var rejection *RejectedErr
+	if !errors.As(err, &rejection) || rejection.Reason != reason {
+		t.Fatalf("expected rejection (%s), got: %v", reason, err)
+	}
+	return rejection
+}
+
+func TestRateLimit(t *testing.T) {
+	c, now := newTestController(Limits{Rate: 2, Burst: 2}, Limits{})
+
+	for i := 0; i < 2; i++ {
+		release, err := c.Admit("f", "")
+		if err != nil {
+			t.Fatalf("request %d rejected: %v", i, err)
+		}
+		release()
+	}
+	_, err := c.Admit("f", "")
+	rejection := expectRejection(t, err, FUNCTION_RATE)
+	if rejection.RetryAfter != 500*time.Millisecond {
+		t.Errorf("unexpected retry delay: %v", rejection.RetryAfter)
+	}
+
+	// other functions have their own bucket
+	if _, err := c.Admit("g", ""); err != nil {
+		t.Errorf("request for another function rejected: %v", err)
+	}
+
+	*now = now.Add(500 * time.Millisecond)
+	if _, err := c.Admit("f", ""); err != nil {
+		t.Errorf("request rejected after refill: %v", err)
+	}
+}
+
+func TestConcurrencyLimit(t *testing.T) {
+	c, _ := newTestController(Limits{}, Limits{MaxConcurrency: 1})
+
+	release, err := c.Admit("f", "key1")
+	if err != nil {
+		t.Fatalf("request rejected: %v", err)
+	}
+	_, err = c.Admit("g", "key1")
+	expectRejection(t, err, KEY_CONCURRENCY)
+
+	// requests without a key are only subject to function limits
+	if _, err := c.Admit("f", ""); err != nil {
+		t.Errorf("request without key rejected: %v", err)
+	}
+
+	release()
+	release() // releasing twice has no effect
+	if _, err := c.Admit("g", "key1"); err != nil {
+		t.Errorf("request rejected after release: %v", err)
+	}
+	_, err = c.Admit("g", "key1")
+	expectRejection(t, err, KEY_CONCURRENCY)
+}
+
+func TestRejectionConsumesNothing(t *testing.T) {
+	c, _ := newTestController(Limits{Rate: 1}, Limits{MaxConcurrency: 1})
+
+	release, err := c.Admit("f", "key1")
+	if err != nil {
+		t.Fatalf("request rejected: %v", err)
+	}
+	release()
+
+	// rejected by the function limit: the key is not affected
+	_, err = c.Admit("f", "key1")
+	expectRejection(t, err, FUNCTION_RATE)
+	if c.keys["key1"].running != 0 {
+		t.Errorf("rejected request counted as running")
+	}
+}
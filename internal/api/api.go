@@ -7,14 +7,19 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"math"
 	"net/http"
+	"strconv"
 	"sync"
 	"time"
 
+	"github.com/grussorusso/serverledge/internal/admission"
+	"github.com/grussorusso/serverledge/internal/auth"
 	"github.com/grussorusso/serverledge/internal/client"
 	"github.com/grussorusso/serverledge/internal/config"
 	"github.com/grussorusso/serverledge/internal/container"
 	"github.com/grussorusso/serverledge/internal/function"
+	"github.com/grussorusso/serverledge/internal/metrics"
 	"github.com/grussorusso/serverledge/internal/node"
 	"github.com/grussorusso/serverledge/internal/registration"
 	"github.com/grussorusso/serverledge/internal/telemetry"
@@ -32,30 +37,164 @@ var requestsPool = sync.Pool{
 }
 
 // GetFunctions handles a request to list the function available in the system.
+// Functions can be filtered by runtime and labels ("key" or "key=value"),
+// and paginated through "offset" and "limit". If "details" is true, their
+// descriptors are returned in place of their names.
 func GetFunctions(c echo.Context) error {
-	list, err := function.GetAll()
+	offset, limit, err := parsePagination(c)
+	if err != nil {
+		return c.String(http.StatusBadRequest, err.Error())
+	}
+	runtime := c.QueryParam("runtime")
+	labels := c.QueryParams()["label"]
+	details := c.QueryParam("details") == "true"
+
+	if runtime == "" && len(labels) == 0 && !details {
+		// names are enough
+		list, err := function.GetAll(auth.Namespace(c))
+		if err != nil {
+			return c.String(http.StatusServiceUnavailable, "")
+		}
+		c.Response().Header().Set("X-Total-Count", strconv.Itoa(len(list)))
+		start, end := pageBounds(len(list), offset, limit)
+		return c.JSON(http.StatusOK, list[start:end])
+	}
+
+	functions, err := function.GetAllDescriptors(auth.Namespace(c))
 	if err != nil {
 		return c.String(http.StatusServiceUnavailable, "")
 	}
-	return c.JSON(http.StatusOK, list)
+	matching := make([]*function.Descriptor, 0, len(functions))
+	for _, f := range functions {
+		if runtime != "" && f.Runtime != runtime {
+			continue
+		}
+		matches := true
+		for _, selector := range labels {
+			matches = matches && f.HasLabel(selector)
+		}
+		if matches {
+			matching = append(matching, f)
+		}
+	}
+	c.Response().Header().Set("X-Total-Count", strconv.Itoa(len(matching)))
+	start, end := pageBounds(len(matching), offset, limit)
+	matching = matching[start:end]
+
+	if details {
+		return c.JSON(http.StatusOK, matching)
+	}
+	names := make([]string, 0, len(matching))
+	for _, f := range matching {
+		names = append(names, f.Name)
+	}
+	return c.JSON(http.StatusOK, names)
+}
+
+// parsePagination returns the "offset" and "limit" parameters of a request
+// (0 if missing).
+func parsePagination(c echo.Context) (offset int, limit int, err error) {
+	if param := c.QueryParam("offset"); param != "" {
+		if offset, err = strconv.Atoi(param); err != nil || offset < 0 {
+			return 0, 0, fmt.Errorf("invalid offset: %s", param)
+		}
+	}
+	if param := c.QueryParam("limit"); param != "" {
+		if limit, err = strconv.Atoi(param); err != nil || limit < 0 {
+			return 0, 0, fmt.Errorf("invalid limit: %s", param)
+		}
+	}
+	return offset, limit, nil
+}
+
+// pageBounds returns the range of a list of n items containing up to limit
+// items (all if 0), starting from offset.
+func pageBounds(n int, offset int, limit int) (start int, end int) {
+	start = min(offset, n)
+	end = n
+	if limit > 0 {
+		end = min(start+limit, n)
+	}
+	return start, end
+}
+
+// GetFunction handles a request for the descriptor of a function.
+// The function can be referred to as "name", "name:version" or "name@alias".
+func GetFunction(c echo.Context) error {
+	funcName, err := function.QualifyReference(auth.Namespace(c), c.Param("name"))
+	if err != nil {
+		return c.String(http.StatusNotFound, "Function unknown")
+	}
+	fun, ok := function.GetFunction(funcName)
+	if !ok {
+		return c.String(http.StatusNotFound, "Function unknown")
+	}
+	return c.JSON(http.StatusOK, fun.Describe())
+}
+
+// GetFunctionSchema handles a request for the input and output schemas of
+// a function.
+func GetFunctionSchema(c echo.Context) error {
+	funcName, err := function.QualifyReference(auth.Namespace(c), c.Param("name"))
+	if err != nil {
+		return c.String(http.StatusNotFound, "Function unknown")
+	}
+	fun, ok := function.GetFunction(funcName)
+	if !ok {
+		return c.String(http.StatusNotFound, "Function unknown")
+	}
+	response := struct {
+		Input  json.RawMessage
+		Output json.RawMessage
+	}{fun.InputSchema, fun.OutputSchema}
+	return c.JSON(http.StatusOK, response)
 }
 
 // InvokeFunction handles a function invocation request.
+// The function can be referred to as "name", "name:version" or "name@alias".
 func InvokeFunction(c echo.Context) error {
-	funcName := c.Param("fun")
+	funcName, err := function.QualifyReference(auth.Namespace(c), c.Param("fun"))
+	if err != nil {
+		return c.String(http.StatusNotFound, "Function unknown")
+	}
 	fun, ok := function.GetFunction(funcName)
 	if !ok {
 		log.Printf("Dropping request for unknown fun '%s'\n", funcName)
 		return c.String(http.StatusNotFound, "Function unknown")
 	}
 
+	release, err := admission.Admit(fun.Name, auth.Identity(c))
+	var rejection *admission.RejectedErr
+	if errors.As(err, &rejection) {
+		if metrics.Enabled {
+			metrics.AddRejectedInvocation(fun.Name, rejection.Reason)
+		}
+		retryAfter := int(math.Ceil(rejection.RetryAfter.Seconds()))
+		c.Response().Header().Set("Retry-After", strconv.Itoa(retryAfter))
+		return c.String(http.StatusTooManyRequests, "Rate limit exceeded")
+	}
+	// enqueued async requests hold the admission slot until they are served
+	enqueued := false
+	defer func() {
+		if !enqueued {
+			release()
+		}
+	}()
+	if metrics.Enabled {
+		metrics.AddAdmittedInvocation(fun.Name)
+	}
+
 	var invocationRequest client.InvocationRequest
-	err := json.NewDecoder(c.Request().Body).Decode(&invocationRequest)
+	err = json.NewDecoder(c.Request().Body).Decode(&invocationRequest)
 	if err != nil && err != io.EOF {
 		log.Printf("Could not parse request: %v\n", err)
 		return fmt.Errorf("could not parse request: %v", err)
 	}
 
+	if err = scheduling.ValidateCallback(invocationRequest.CallbackURL, invocationRequest.CallbackSecret); err != nil {
+		return c.String(http.StatusBadRequest, err.Error())
+	}
+
 	r := requestsPool.Get().(*function.Request)
 	defer requestsPool.Put(r)
 	r.Fun = fun
@@ -66,8 +205,15 @@ func InvokeFunction(c echo.Context) error {
 	r.CanDoOffloading = invocationRequest.CanDoOffloading
 	r.Async = invocationRequest.Async
 	r.ReturnOutput = invocationRequest.ReturnOutput
-
-	reqId := fmt.Sprintf("%s-%s%d", fun, node.NodeIdentifier[len(node.NodeIdentifier)-5:], r.Arrival.Nanosecond())
+	r.CallbackURL = invocationRequest.CallbackURL
+	r.CallbackSecret = invocationRequest.CallbackSecret
+	r.TimeoutSeconds = invocationRequest.TimeoutSeconds
+
+	reqId := fmt.Sprintf("%s-%s%d", fun.PlainName(), node.NodeIdentifier[len(node.NodeIdentifier)-5:], r.Arrival.Nanosecond())
+	if r.Async && invocationRequest.ReqId != "" && auth.IsClusterMember(c) {
+		// offloaded by another node
+		reqId = invocationRequest.ReqId
+	}
 	r.Ctx = context.WithValue(context.Background(), "ReqId", reqId)
 
 	// Tracing
@@ -79,14 +225,32 @@ func InvokeFunction(c echo.Context) error {
 	}
 
 	if r.Async {
-		go scheduling.SubmitAsyncRequest(r)
+		err := scheduling.EnqueueAsyncRequest(r, release)
+		if errors.Is(err, function.InvalidInputErr) || errors.Is(err, scheduling.InvalidCallbackErr) {
+			return c.String(http.StatusBadRequest, err.Error())
+		} else if errors.Is(err, scheduling.AsyncRequestExistsErr) {
+			return c.String(http.StatusConflict, err.Error())
+		} else if err != nil {
+			log.Printf("Could not enqueue async request: %v\n", err)
+			return c.String(http.StatusServiceUnavailable, "")
+		}
+		enqueued = true
 		return c.JSON(http.StatusOK, function.AsyncResponse{ReqId: r.Id()})
 	}
 
 	executionReport, err := scheduling.SubmitRequest(r)
 
-	if errors.Is(err, node.OutOfResourcesErr) {
+	if errors.Is(err, function.InvalidInputErr) {
+		return c.String(http.StatusBadRequest, err.Error())
+	} else if errors.Is(err, function.InvalidOutputErr) {
+		log.Printf("Invocation failed: %v\n", err)
+		return c.String(http.StatusInternalServerError, err.Error())
+	} else if errors.Is(err, node.OutOfResourcesErr) {
 		return c.String(http.StatusTooManyRequests, "")
+	} else if errors.Is(err, scheduling.TimeoutErr) {
+		return c.String(http.StatusGatewayTimeout, "Function execution timed out")
+	} else if errors.Is(err, scheduling.QueueDeadlineErr) {
+		return c.String(http.StatusGatewayTimeout, "Deadline exceeded in queue")
 	} else if err != nil {
 		log.Printf("Invocation failed: %v\n", err)
 		return c.String(http.StatusInternalServerError, "")
@@ -95,36 +259,73 @@ func InvokeFunction(c echo.Context) error {
 	}
 }
 
+// maximum waiting time for long polling
+const maxPollWait = 5 * time.Minute
+
 // PollAsyncResult checks for the result of an asynchronous invocation.
+// If the "wait" parameter is specified (e.g., "30s"), it waits for the
+// result to be available, up to the given time.
 func PollAsyncResult(c echo.Context) error {
 	reqId := c.Param("reqId")
-	if len(reqId) < 0 {
+	if len(reqId) < 1 {
 		return c.String(http.StatusNotFound, "")
 	}
 
-	etcdClient, err := utils.GetEtcdClient()
-	if err != nil {
-		log.Println("Could not connect to Etcd")
-		return c.String(http.StatusInternalServerError, "Failed to connect to the Global Registry")
+	var wait time.Duration
+	if waitParam := c.QueryParam("wait"); waitParam != "" {
+		var err error
+		wait, err = time.ParseDuration(waitParam)
+		if err != nil || wait < 0 {
+			return c.String(http.StatusBadRequest, "Invalid waiting time")
+		}
+		if wait > maxPollWait {
+			wait = maxPollWait
+		}
 	}
 
-	ctx := context.Background()
-
-	key := fmt.Sprintf("async/%s", reqId)
-	res, err := etcdClient.Get(ctx, key)
+	payload, err := scheduling.GetAsyncResult(c.Request().Context(), reqId, auth.Namespace(c), wait)
 	if err != nil {
 		log.Println(err)
 		return c.String(http.StatusInternalServerError, "Could not retrieve results")
 	}
 
-	if len(res.Kvs) == 1 {
-		payload := res.Kvs[0].Value
+	if payload != nil {
 		return c.JSONBlob(http.StatusOK, payload)
 	} else {
 		return c.String(http.StatusNotFound, "")
 	}
 }
 
+// StreamAsyncStatus streams the status transitions of an asynchronous
+// invocation as Server-Sent Events, until the invocation is done.
+func StreamAsyncStatus(c echo.Context) error {
+	reqId := c.Param("reqId")
+
+	updates, err := scheduling.WatchAsyncStatus(c.Request().Context(), reqId, auth.Namespace(c))
+	if errors.Is(err, scheduling.AsyncRequestNotFoundErr) {
+		return c.String(http.StatusNotFound, "")
+	} else if err != nil {
+		log.Println(err)
+		return c.String(http.StatusInternalServerError, "Could not retrieve status")
+	}
+
+	resp := c.Response()
+	resp.Header().Set(echo.HeaderContentType, "text/event-stream")
+	resp.Header().Set("Cache-Control", "no-cache")
+	resp.WriteHeader(http.StatusOK)
+	for update := range updates {
+		payload, err := json.Marshal(update)
+		if err != nil {
+			return err
+		}
+		if _, err = fmt.Fprintf(resp, "event: status\ndata: %s\n\n", payload); err != nil {
+			return err
+		}
+		resp.Flush()
+	}
+	return nil
+}
+
 // CreateFunction handles a function creation request.
 func CreateFunction(c echo.Context) error {
 	var f function.Function
@@ -134,7 +335,18 @@ func CreateFunction(c echo.Context) error {
 		return err
 	}
 
-	_, ok := function.GetFunction(f.Name) // TODO: we would need a system-wide lock here...
+	if err = function.ValidateName(f.Name); err != nil {
+		return c.String(http.StatusBadRequest, err.Error())
+	}
+	if err = f.ValidateSchemas(); err != nil {
+		return c.String(http.StatusBadRequest, err.Error())
+	}
+	if err = f.ValidateLabels(); err != nil {
+		return c.String(http.StatusBadRequest, err.Error())
+	}
+	f.Name = function.QualifiedName(auth.Namespace(c), f.Name)
+
+	_, ok := function.GetFunction(f.Name)
 	if ok {
 		log.Printf("Dropping request for already existing function '%s'\n", f.Name)
 		return c.String(http.StatusConflict, "")
@@ -149,13 +361,175 @@ func CreateFunction(c echo.Context) error {
 			return c.JSON(http.StatusNotFound, "Invalid runtime.")
 		}
 	}
+	if err = validateConcurrency(f.Runtime, f.MaxConcurrency); err != nil {
+		return c.String(http.StatusBadRequest, err.Error())
+	}
 
 	err = f.SaveToEtcd()
-	if err != nil {
+	if errors.Is(err, function.AlreadyExistsErr) {
+		return c.String(http.StatusConflict, "")
+	} else if err != nil {
 		log.Printf("Failed creation: %v\n", err)
 		return c.JSON(http.StatusServiceUnavailable, "")
 	}
-	response := struct{ Created string }{f.Name}
+	response := struct{ Created string }{f.PlainName()}
+	return c.JSON(http.StatusOK, response)
+}
+
+// validateConcurrency rejects concurrent invocations of functions whose
+// runtime cannot serve them.
+func validateConcurrency(runtime string, maxConcurrency int) error {
+	if maxConcurrency > 1 && !container.SupportsConcurrency(runtime) {
+		return fmt.Errorf("runtime %s does not support MaxConcurrency > 1", runtime)
+	}
+	return nil
+}
+
+// PublishFunction handles a request to publish a new version of an existing function.
+func PublishFunction(c echo.Context) error {
+	var f function.Function
+	err := json.NewDecoder(c.Request().Body).Decode(&f)
+	if err != nil && err != io.EOF {
+		log.Printf("Could not parse request: %v\n", err)
+		return err
+	}
+
+	if err = function.ValidateName(f.Name); err != nil {
+		return c.String(http.StatusBadRequest, err.Error())
+	}
+	if err = f.ValidateSchemas(); err != nil {
+		return c.String(http.StatusBadRequest, err.Error())
+	}
+	if err = f.ValidateLabels(); err != nil {
+		return c.String(http.StatusBadRequest, err.Error())
+	}
+	f.Name = function.QualifiedName(auth.Namespace(c), f.Name)
+
+	// Check that the selected runtime exists
+	if f.Runtime != container.CUSTOM_RUNTIME {
+		_, ok := container.RuntimeToInfo[f.Runtime]
+		if !ok {
+			return c.JSON(http.StatusNotFound, "Invalid runtime.")
+		}
+	}
+	if err = validateConcurrency(f.Runtime, f.MaxConcurrency); err != nil {
+		return c.String(http.StatusBadRequest, err.Error())
+	}
+
+	log.Printf("New request: new version of %s\n", f.Name)
+	err = f.PublishVersion()
+	if errors.Is(err, function.NotFoundErr) {
+		return c.String(http.StatusNotFound, "Unknown function")
+	} else if errors.Is(err, function.ConflictErr) {
+		return c.String(http.StatusConflict, "")
+	} else if err != nil {
+		log.Printf("Failed publishing: %v\n", err)
+		return c.JSON(http.StatusServiceUnavailable, "")
+	}
+
+	response := struct {
+		Published string
+		Version   int64
+	}{f.PlainName(), f.Version}
+	return c.JSON(http.StatusOK, response)
+}
+
+// UpdateFunction handles a request to update an existing function.
+// Omitted fields are left unchanged, unless explicitly reset.
+func UpdateFunction(c echo.Context) error {
+	var req client.UpdateRequest
+	err := json.NewDecoder(c.Request().Body).Decode(&req)
+	if err != nil && err != io.EOF {
+		log.Printf("Could not parse request: %v\n", err)
+		return err
+	}
+	f := req.Function
+
+	if err = function.ValidateName(f.Name); err != nil {
+		return c.String(http.StatusBadRequest, err.Error())
+	}
+	if err = f.ValidateSchemas(); err != nil {
+		return c.String(http.StatusBadRequest, err.Error())
+	}
+	if err = f.ValidateLabels(); err != nil {
+		return c.String(http.StatusBadRequest, err.Error())
+	}
+	if err = function.ValidateReset(req.Reset); err != nil {
+		return c.String(http.StatusBadRequest, err.Error())
+	}
+	f.Name = function.QualifiedName(auth.Namespace(c), f.Name)
+
+	// Check that the selected runtime exists
+	if f.Runtime != "" && f.Runtime != container.CUSTOM_RUNTIME {
+		_, ok := container.RuntimeToInfo[f.Runtime]
+		if !ok {
+			return c.JSON(http.StatusNotFound, "Invalid runtime.")
+		}
+	}
+	// the runtime and concurrency may be inherited from the latest version
+	runtime, maxConcurrency := f.Runtime, f.MaxConcurrency
+	if latest, ok := function.GetFunction(f.Name); ok {
+		if runtime == "" {
+			runtime = latest.Runtime
+		}
+		if maxConcurrency <= 0 {
+			maxConcurrency = latest.MaxConcurrency
+		}
+	}
+	for _, field := range req.Reset {
+		if field == "MaxConcurrency" && f.MaxConcurrency <= 0 {
+			maxConcurrency = 0
+		}
+	}
+	if err = validateConcurrency(runtime, maxConcurrency); err != nil {
+		return c.String(http.StatusBadRequest, err.Error())
+	}
+
+	log.Printf("New request: update of %s\n", f.Name)
+	minVersion, err := f.Update(req.Reset)
+	if errors.Is(err, function.NotFoundErr) {
+		return c.String(http.StatusNotFound, "Unknown function")
+	} else if errors.Is(err, function.ConflictErr) {
+		return c.String(http.StatusConflict, "")
+	} else if err != nil {
+		log.Printf("Failed update: %v\n", err)
+		return c.JSON(http.StatusServiceUnavailable, "")
+	}
+
+	// Other nodes are notified through Etcd
+	node.RetireVersionsBefore(f.Name, minVersion)
+
+	response := struct {
+		Updated string
+		Version int64
+	}{f.PlainName(), f.Version}
+	return c.JSON(http.StatusOK, response)
+}
+
+// SetFunctionAlias handles a request to make an alias point to a function version.
+func SetFunctionAlias(c echo.Context) error {
+	var req client.AliasRequest
+	err := json.NewDecoder(c.Request().Body).Decode(&req)
+	if err != nil && err != io.EOF {
+		log.Printf("Could not parse request: %v\n", err)
+		return err
+	}
+
+	if err = function.ValidateName(req.Function); err != nil {
+		return c.String(http.StatusBadRequest, err.Error())
+	}
+
+	err = function.SetAlias(function.QualifiedName(auth.Namespace(c), req.Function), req.Alias, req.Version)
+	if errors.Is(err, function.NotFoundErr) {
+		return c.String(http.StatusNotFound, "Unknown function version")
+	} else if errors.Is(err, function.ConflictErr) {
+		return c.String(http.StatusConflict, "")
+	} else if err != nil {
+		log.Printf("Failed alias update: %v\n", err)
+		return c.String(http.StatusBadRequest, err.Error())
+	}
+
+	response := struct{ Alias string }{fmt.Sprintf("%s@%s", req.Function, req.Alias)}
 	return c.JSON(http.StatusOK, response)
 }
 
@@ -168,6 +542,11 @@ func DeleteFunction(c echo.Context) error {
 		return err
 	}
 
+	if err = function.ValidateName(f.Name); err != nil {
+		return c.String(http.StatusBadRequest, err.Error())
+	}
+	f.Name = function.QualifiedName(auth.Namespace(c), f.Name)
+
 	_, ok := function.GetFunction(f.Name) // TODO: we would need a system-wide lock here...
 	if !ok {
 		log.Printf("Dropping request for non existing function '%s'\n", f.Name)
@@ -184,7 +563,7 @@ func DeleteFunction(c echo.Context) error {
 	// Delete local warm containers
 	node.ShutdownWarmContainersFor(&f)
 
-	response := struct{ Deleted string }{f.Name}
+	response := struct{ Deleted string }{f.PlainName()}
 	return c.JSON(http.StatusOK, response)
 }
 
@@ -205,7 +584,7 @@ func GetServerStatus(c echo.Context) error {
 	node.Resources.RLock()
 	defer node.Resources.RUnlock()
 	portNumber := config.GetInt("api.port", 1323)
-	url := fmt.Sprintf("http://%s:%d", utils.GetIpAddress().String(), portNumber)
+	url := fmt.Sprintf("%s://%s:%d", utils.APIScheme(), utils.GetIpAddress().String(), portNumber)
 	response := registration.StatusInformation{
 		Url:            url,
 		AvailableMemMB: node.Resources.AvailableMemMB,
@@ -226,7 +605,11 @@ func PrewarmFunction(c echo.Context) error {
 		return err
 	}
 
-	fun, ok := function.GetFunction(req.Function)
+	funcName, err := function.QualifyReference(auth.Namespace(c), req.Function)
+	if err != nil {
+		return c.String(http.StatusNotFound, "Function unknown")
+	}
+	fun, ok := function.GetFunction(funcName)
 	if !ok {
 		log.Printf("Dropping request for unknown fun '%s'\n", req.Function)
 		return c.String(http.StatusNotFound, "Function unknown")
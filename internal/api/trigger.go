@@ -0,0 +1,103 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/grussorusso/serverledge/internal/auth"
+	"github.com/grussorusso/serverledge/internal/function"
+	"github.com/grussorusso/serverledge/internal/trigger"
+	"github.com/labstack/echo/v4"
+)
+
+// GetTriggers handles a request to list the triggers available in the system.
+func GetTriggers(c echo.Context) error {
+	list, err := trigger.GetAll(auth.Namespace(c))
+	if err != nil {
+		return c.String(http.StatusServiceUnavailable, "")
+	}
+	for _, t := range list {
+		t.Name = t.PlainName()
+		if t.Source != nil {
+			t.Source.Password = ""
+		}
+	}
+	return c.JSON(http.StatusOK, list)
+}
+
+// CreateTrigger handles a trigger creation request.
+func CreateTrigger(c echo.Context) error {
+	var t trigger.Trigger
+	err := json.NewDecoder(c.Request().Body).Decode(&t)
+	if err != nil && err != io.EOF {
+		log.Printf("Could not parse request: %v\n", err)
+		return err
+	}
+
+	if err = function.ValidateName(t.Name); err != nil {
+		return c.String(http.StatusBadRequest, err.Error())
+	}
+	if err = t.Validate(); err != nil {
+		return c.String(http.StatusBadRequest, err.Error())
+	}
+	t.Name = function.QualifiedName(auth.Namespace(c), t.Name)
+	if t.Area == "" {
+		t.Area = trigger.LocalArea()
+	}
+
+	log.Printf("New request: creation of trigger %s\n", t.Name)
+	err = t.SaveToEtcd()
+	if errors.Is(err, trigger.AlreadyExistsErr) {
+		return c.String(http.StatusConflict, "")
+	} else if err != nil {
+		log.Printf("Failed creation: %v\n", err)
+		return c.JSON(http.StatusServiceUnavailable, "")
+	}
+	response := struct{ Created string }{t.PlainName()}
+	return c.JSON(http.StatusOK, response)
+}
+
+// DeleteTrigger handles a trigger deletion request.
+func DeleteTrigger(c echo.Context) error {
+	var t trigger.Trigger
+	err := json.NewDecoder(c.Request().Body).Decode(&t)
+	if err != nil && err != io.EOF {
+		log.Printf("Could not parse request: %v\n", err)
+		return err
+	}
+
+	if err = function.ValidateName(t.Name); err != nil {
+		return c.String(http.StatusBadRequest, err.Error())
+	}
+	t.Name = function.QualifiedName(auth.Namespace(c), t.Name)
+
+	log.Printf("New request: deleting trigger %s\n", t.Name)
+	err = trigger.Delete(t.Name)
+	if errors.Is(err, trigger.NotFoundErr) {
+		return c.String(http.StatusNotFound, "Unknown trigger")
+	} else if err != nil {
+		log.Printf("Failed deletion: %v\n", err)
+		return c.String(http.StatusServiceUnavailable, "")
+	}
+
+	response := struct{ Deleted string }{t.PlainName()}
+	return c.JSON(http.StatusOK, response)
+}
+
+// GetTriggerHistory handles a request for the last firings of a trigger.
+func GetTriggerHistory(c echo.Context) error {
+	if err := function.ValidateName(c.Param("name")); err != nil {
+		return c.String(http.StatusNotFound, "Unknown trigger")
+	}
+	history, err := trigger.GetHistory(function.QualifiedName(auth.Namespace(c), c.Param("name")))
+	if errors.Is(err, trigger.NotFoundErr) {
+		return c.String(http.StatusNotFound, "Unknown trigger")
+	} else if err != nil {
+		log.Printf("Could not retrieve trigger history: %v\n", err)
+		return c.String(http.StatusServiceUnavailable, "")
+	}
+	return c.JSON(http.StatusOK, history)
+}
@@ -0,0 +1,120 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/grussorusso/serverledge/internal/auth"
+	"github.com/grussorusso/serverledge/internal/client"
+	"github.com/grussorusso/serverledge/internal/function"
+	"github.com/grussorusso/serverledge/internal/node"
+	"github.com/grussorusso/serverledge/internal/workflow"
+	"github.com/labstack/echo/v4"
+)
+
+// GetWorkflows handles a request to list the workflows available in the system.
+func GetWorkflows(c echo.Context) error {
+	list, err := workflow.GetAll(auth.Namespace(c))
+	if err != nil {
+		return c.String(http.StatusServiceUnavailable, "")
+	}
+	return c.JSON(http.StatusOK, list)
+}
+
+// CreateWorkflow handles a workflow creation request.
+func CreateWorkflow(c echo.Context) error {
+	var w workflow.Workflow
+	err := json.NewDecoder(c.Request().Body).Decode(&w)
+	if err != nil && err != io.EOF {
+		log.Printf("Could not parse request: %v\n", err)
+		return err
+	}
+
+	if err = function.ValidateName(w.Name); err != nil {
+		return c.String(http.StatusBadRequest, err.Error())
+	}
+	if err = w.Validate(); err != nil {
+		return c.String(http.StatusBadRequest, err.Error())
+	}
+	w.Name = function.QualifiedName(auth.Namespace(c), w.Name)
+
+	log.Printf("New request: creation of workflow %s\n", w.Name)
+	err = w.SaveToEtcd()
+	if errors.Is(err, workflow.AlreadyExistsErr) {
+		return c.String(http.StatusConflict, "")
+	} else if err != nil {
+		log.Printf("Failed creation: %v\n", err)
+		return c.JSON(http.StatusServiceUnavailable, "")
+	}
+	response := struct{ Created string }{w.PlainName()}
+	return c.JSON(http.StatusOK, response)
+}
+
+// DeleteWorkflow handles a workflow deletion request.
+func DeleteWorkflow(c echo.Context) error {
+	var w workflow.Workflow
+	err := json.NewDecoder(c.Request().Body).Decode(&w)
+	if err != nil && err != io.EOF {
+		log.Printf("Could not parse request: %v\n", err)
+		return err
+	}
+
+	if err = function.ValidateName(w.Name); err != nil {
+		return c.String(http.StatusBadRequest, err.Error())
+	}
+	w.Name = function.QualifiedName(auth.Namespace(c), w.Name)
+
+	log.Printf("New request: deleting workflow %s\n", w.Name)
+	err = workflow.Delete(w.Name)
+	if errors.Is(err, workflow.NotFoundErr) {
+		return c.String(http.StatusNotFound, "Unknown workflow")
+	} else if err != nil {
+		log.Printf("Failed deletion: %v\n", err)
+		return c.String(http.StatusServiceUnavailable, "")
+	}
+
+	response := struct{ Deleted string }{w.PlainName()}
+	return c.JSON(http.StatusOK, response)
+}
+
+// InvokeWorkflow handles a workflow invocation request. Function invocations
+// are submitted to the local scheduler, and a report of each step is returned.
+func InvokeWorkflow(c echo.Context) error {
+	if err := function.ValidateName(c.Param("name")); err != nil {
+		return c.String(http.StatusNotFound, "Workflow unknown")
+	}
+	w, err := workflow.Get(function.QualifiedName(auth.Namespace(c), c.Param("name")))
+	if errors.Is(err, workflow.NotFoundErr) {
+		return c.String(http.StatusNotFound, "Workflow unknown")
+	} else if err != nil {
+		log.Printf("Could not retrieve workflow: %v\n", err)
+		return c.String(http.StatusServiceUnavailable, "")
+	}
+
+	var invocationRequest client.WorkflowInvocationRequest
+	err = json.NewDecoder(c.Request().Body).Decode(&invocationRequest)
+	if err != nil && err != io.EOF {
+		log.Printf("Could not parse request: %v\n", err)
+		return fmt.Errorf("could not parse request: %v", err)
+	}
+
+	reqId := fmt.Sprintf("%s-%s%d", w.PlainName(), node.NodeIdentifier[len(node.NodeIdentifier)-5:], time.Now().Nanosecond())
+	// the invocation is interrupted if the client gives up
+	report := workflow.Invoke(c.Request().Context(), w, invocationRequest.Params, &workflow.Options{
+		ReqId:           reqId,
+		Class:           function.ServiceClass(invocationRequest.QoSClass),
+		CanDoOffloading: invocationRequest.CanDoOffloading,
+		ReturnOutput:    invocationRequest.ReturnOutput,
+		Identity:        auth.Identity(c),
+	})
+	if !report.Success {
+		log.Printf("Workflow %s failed: %s\n", w.Name, report.Error)
+		return c.JSON(http.StatusInternalServerError, report)
+	}
+	return c.JSON(http.StatusOK, report)
+}
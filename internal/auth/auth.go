@@ -0,0 +1,199 @@
+// Package auth authenticates API requests through API keys, and authorizes
+// them based on the roles and the namespace associated with each key.
+package auth
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/grussorusso/serverledge/internal/client"
+	"github.com/grussorusso/serverledge/internal/config"
+	"github.com/grussorusso/serverledge/internal/function"
+	"github.com/labstack/echo/v4"
+)
+
+// Roles
+const (
+	ROLE_DEPLOY = "deploy" // manage functions
+	ROLE_INVOKE = "invoke" // invoke functions and retrieve results
+)
+
+// ALL_NAMESPACES grants access to every namespace: the namespace of each
+// request is given by the client.NAMESPACE_HEADER header.
+const ALL_NAMESPACES = "*"
+
+// ANONYMOUS is the identity of requests not authenticated by an API key.
+const ANONYMOUS = "anonymous"
+
+// keys of the namespace, of the identity and of the cluster membership in
+// the echo context
+const namespaceContextKey = "namespace"
+const identityContextKey = "identity"
+const clusterContextKey = "cluster"
+
+// APIKey describes the permissions granted to an API key.
+type APIKey struct {
+	Key       string
+	ID        string // identifies the key in admission limits (optional, default: the namespace)
+	Namespace string
+	Roles     []string
+	cluster   bool // held by other nodes
+}
+
+func (k *APIKey) hasRole(role string) bool {
+	if role == "" {
+		return true
+	}
+	for _, r := range k.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+var enabled bool
+
+// NODE_CERT_OU is the organizational unit identifying the certificates of
+// the nodes, among those signed by the cluster CA.
+const NODE_CERT_OU = "serverledge-node"
+
+// permissions of clients authenticated through a node certificate signed by
+// the cluster CA (see config.TLS_CLIENT_AUTH), i.e., other nodes
+var clusterMember = APIKey{Namespace: ALL_NAMESPACES, Roles: []string{ROLE_INVOKE}, cluster: true}
+
+// keys indexed by their hash, to avoid timing attacks on lookups
+var keys map[[sha256.Size]byte]*APIKey
+
+// Init loads the API keys from the configuration.
+func Init() error {
+	enabled = config.GetBool(config.AUTH_ENABLED, false)
+	if !enabled {
+		return nil
+	}
+
+	var configured []APIKey
+	if err := config.UnmarshalKey(config.AUTH_KEYS, &configured); err != nil {
+		return fmt.Errorf("invalid API keys: %v", err)
+	}
+
+	// the key used by other nodes to offload requests
+	if clusterKey := config.GetString(config.AUTH_CLUSTER_KEY, ""); clusterKey != "" {
+		configured = append(configured, APIKey{Key: clusterKey, Namespace: ALL_NAMESPACES, Roles: []string{ROLE_INVOKE},
+			cluster: true})
+	}
+
+	keys = make(map[[sha256.Size]byte]*APIKey)
+	for i := range configured {
+		k := &configured[i]
+		if k.Key == "" {
+			return fmt.Errorf("empty API key")
+		}
+		// IDs are used in configuration keys (see admission.Init)
+		if strings.Contains(k.ID, ".") {
+			return fmt.Errorf("invalid API key ID: %s", k.ID)
+		}
+		if k.Namespace != ALL_NAMESPACES {
+			if err := function.ValidateNamespace(k.Namespace); err != nil {
+				return fmt.Errorf("invalid namespace: %s", k.Namespace)
+			}
+		}
+		keys[sha256.Sum256([]byte(k.Key))] = k
+	}
+
+	log.Printf("Authentication enabled (%d API keys)\n", len(keys))
+	return nil
+}
+
+// Middleware authenticates requests, checking that they are allowed to act
+// in the role (if not empty), and determines their namespace and identity.
+func Middleware(role string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			namespace := c.Request().Header.Get(client.NAMESPACE_HEADER)
+			identity := ANONYMOUS
+			if enabled {
+				apiKey := c.Request().Header.Get(client.API_KEY_HEADER)
+				k, ok := keys[sha256.Sum256([]byte(apiKey))]
+				if !ok && apiKey == "" && isClusterNode(c.Request()) {
+					k, ok = &clusterMember, true
+				}
+				if !ok {
+					return c.String(http.StatusUnauthorized, "Invalid API key")
+				}
+				if !k.hasRole(role) {
+					return c.String(http.StatusForbidden, "Operation not allowed")
+				}
+				if k.Namespace != ALL_NAMESPACES {
+					namespace = k.Namespace
+				}
+				if k.ID != "" {
+					identity = k.ID
+				} else if namespace != function.DEFAULT_NAMESPACE {
+					identity = namespace
+				}
+				c.Set(clusterContextKey, k.cluster)
+			}
+
+			if err := function.ValidateNamespace(namespace); err != nil {
+				return c.String(http.StatusBadRequest, "Invalid namespace")
+			}
+			c.Set(namespaceContextKey, namespace)
+			c.Set(identityContextKey, identity)
+			return next(c)
+		}
+	}
+}
+
+// isClusterNode returns true if the client presented a valid node
+// certificate (verified by the TLS server), i.e., with NODE_CERT_OU among its
+// organizational units. Requests forwarded by a proxy (e.g., the load
+// balancer, which may present a node certificate) are not trusted.
+func isClusterNode(r *http.Request) bool {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return false
+	}
+	if r.Header.Get(echo.HeaderXForwardedFor) != "" || r.Header.Get(echo.HeaderXRealIP) != "" {
+		return false
+	}
+	for _, ou := range r.TLS.VerifiedChains[0][0].Subject.OrganizationalUnit {
+		if ou == NODE_CERT_OU {
+			return true
+		}
+	}
+	return false
+}
+
+// IsClusterMember returns true if the request has been authenticated as sent
+// by another node, through the cluster key or a node certificate.
+// Without authentication, every client is trusted.
+func IsClusterMember(c echo.Context) bool {
+	if !enabled {
+		return true
+	}
+	cluster, _ := c.Get(clusterContextKey).(bool)
+	return cluster
+}
+
+// Identity returns the identity of an authenticated request, i.e., the ID of
+// its API key or, if missing, the namespace of the request. ANONYMOUS is
+// returned for requests without identity (e.g., if authentication is disabled).
+func Identity(c echo.Context) string {
+	identity, ok := c.Get(identityContextKey).(string)
+	if !ok {
+		return ANONYMOUS
+	}
+	return identity
+}
+
+// Namespace returns the namespace of an authenticated request.
+func Namespace(c echo.Context) string {
+	namespace, ok := c.Get(namespaceContextKey).(string)
+	if !ok {
+		return function.DEFAULT_NAMESPACE
+	}
+	return namespace
+}
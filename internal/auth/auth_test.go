@@ -0,0 +1,174 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/grussorusso/serverledge/internal/client"
+	"github.com/labstack/echo/v4"
+)
+
+func setupKeys(t *testing.T, apiKeys ...APIKey) {
+	enabled = true
+	keys = make(map[[sha256.Size]byte]*APIKey)
+	for i := range apiKeys {
+		keys[sha256.Sum256([]byte(apiKeys[i].Key))] = &apiKeys[i]
+	}
+	t.Cleanup(func() { enabled = false })
+}
+
+// serve returns the status code and the namespace seen by the handler.
+func serve(role string, apiKey string, namespace string) (int, string) {
+	return serveTLS(role, apiKey, namespace, nil)
+}
+
+func serveTLS(role string, apiKey string, namespace string, state *tls.ConnectionState) (int, string) {
+	return serveForwarded(role, apiKey, namespace, state, false)
+}
+
+func serveForwarded(role string, apiKey string, namespace string, state *tls.ConnectionState, forwarded bool) (int, string) {
+	e := echo.New()
+	seen := ""
+	e.GET("/", func(c echo.Context) error {
+		seen = Namespace(c)
+		return c.NoContent(http.StatusOK)
+	}, Middleware(role))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(client.API_KEY_HEADER, apiKey)
+	req.Header.Set(client.NAMESPACE_HEADER, namespace)
+	req.TLS = state
+	if forwarded {
+		req.Header.Set(echo.HeaderXForwardedFor, "192.0.2.1")
+	}
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec.Code, seen
+}
+
+func TestMiddleware(t *testing.T) {
+	setupKeys(t,
+		APIKey{Key: "dev", Namespace: "team1", Roles: []string{ROLE_DEPLOY, ROLE_INVOKE}},
+		APIKey{Key: "app", Namespace: "team1", Roles: []string{ROLE_INVOKE}},
+		APIKey{Key: "admin", Namespace: ALL_NAMESPACES, Roles: []string{ROLE_DEPLOY}})
+
+	tests := []struct {
+		role      string
+		key       string
+		namespace string
+		code      int
+		seen      string
+	}{
+		{ROLE_DEPLOY, "dev", "", http.StatusOK, "team1"},
+		{ROLE_DEPLOY, "dev", "team2", http.StatusOK, "team1"}, // header ignored
+		{ROLE_DEPLOY, "app", "", http.StatusForbidden, ""},
+		{ROLE_INVOKE, "app", "", http.StatusOK, "team1"},
+		{ROLE_INVOKE, "wrong", "", http.StatusUnauthorized, ""},
+		{ROLE_DEPLOY, "admin", "team2", http.StatusOK, "team2"},
+		{ROLE_DEPLOY, "admin", "a/b", http.StatusBadRequest, ""},
+		{"", "app", "", http.StatusOK, "team1"},
+	}
+	for _, tt := range tests {
+		code, seen := serve(tt.role, tt.key, tt.namespace)
+		if code != tt.code || seen != tt.seen {
+			t.Errorf("%s as %s: got %d (namespace '%s')", tt.key, tt.role, code, seen)
+		}
+	}
+}
+
+func TestDisabled(t *testing.T) {
+	if code, seen := serve(ROLE_DEPLOY, "", "team2"); code != http.StatusOK || seen != "team2" {
+		t.Errorf("unexpected response: %d (namespace '%s')", code, seen)
+	}
+}
+
+func TestClusterCertificate(t *testing.T) {
+	setupKeys(t, APIKey{Key: "app", Namespace: "team1", Roles: []string{ROLE_INVOKE}})
+	nodeCert := &x509.Certificate{Subject: pkix.Name{OrganizationalUnit: []string{NODE_CERT_OU}}}
+	verified := &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{nodeCert}}}
+
+	if code, seen := serveTLS(ROLE_INVOKE, "", "team2", verified); code != http.StatusOK || seen != "team2" {
+		t.Errorf("cluster member not allowed to invoke: %d (namespace '%s')", code, seen)
+	}
+	if code, _ := serveTLS(ROLE_DEPLOY, "", "team2", verified); code != http.StatusForbidden {
+		t.Errorf("cluster member allowed to deploy: %d", code)
+	}
+	if code, _ := serveTLS(ROLE_INVOKE, "", "team2", &tls.ConnectionState{}); code != http.StatusUnauthorized {
+		t.Errorf("unverified client allowed: %d", code)
+	}
+
+	// certificates without the node identity
+	other := &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{&x509.Certificate{}}}}
+	if code, _ := serveTLS(ROLE_INVOKE, "", "team2", other); code != http.StatusUnauthorized {
+		t.Errorf("client without node identity allowed: %d", code)
+	}
+	// certificates never override invalid keys, nor authenticate forwarded requests
+	if code, _ := serveTLS(ROLE_INVOKE, "wrong", "team2", verified); code != http.StatusUnauthorized {
+		t.Errorf("invalid key accepted: %d", code)
+	}
+	if code, _ := serveForwarded(ROLE_INVOKE, "", "team2", verified, true); code != http.StatusUnauthorized {
+		t.Errorf("forwarded request allowed: %d", code)
+	}
+	if code, seen := serveForwarded(ROLE_INVOKE, "app", "team2", verified, true); code != http.StatusOK || seen != "team1" {
+		t.Errorf("unexpected response to forwarded request: %d (namespace '%s')", code, seen)
+	}
+}
+
+func TestIsClusterMember(t *testing.T) {
+	setupKeys(t, APIKey{Key: "app", Namespace: "team1", Roles: []string{ROLE_INVOKE}},
+		APIKey{Key: "cluster", Namespace: ALL_NAMESPACES, Roles: []string{ROLE_INVOKE}, cluster: true})
+
+	for key, expected := range map[string]bool{"app": false, "cluster": true} {
+		e := echo.New()
+		member := !expected
+		e.GET("/", func(c echo.Context) error {
+			member = IsClusterMember(c)
+			return c.NoContent(http.StatusOK)
+		}, Middleware(ROLE_INVOKE))
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(client.API_KEY_HEADER, key)
+		e.ServeHTTP(httptest.NewRecorder(), req)
+		if member != expected {
+			t.Errorf("%s: expected cluster membership %v", key, expected)
+		}
+	}
+}
+
+func TestIdentity(t *testing.T) {
+	setupKeys(t,
+		APIKey{Key: "dev", ID: "dev1", Namespace: "team1", Roles: []string{ROLE_INVOKE}},
+		APIKey{Key: "app", Namespace: "team1", Roles: []string{ROLE_INVOKE}},
+		APIKey{Key: "admin", Namespace: ALL_NAMESPACES, Roles: []string{ROLE_INVOKE}})
+
+	tests := []struct {
+		key       string
+		namespace string
+		identity  string
+	}{
+		{"dev", "", "dev1"},
+		{"app", "", "team1"},
+		{"admin", "team2", "team2"},
+		{"admin", "", ANONYMOUS},
+	}
+	for _, tt := range tests {
+		e := echo.New()
+		seen := ""
+		e.GET("/", func(c echo.Context) error {
+			seen = Identity(c)
+			return c.NoContent(http.StatusOK)
+		}, Middleware(ROLE_INVOKE))
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(client.API_KEY_HEADER, tt.key)
+		req.Header.Set(client.NAMESPACE_HEADER, tt.namespace)
+		e.ServeHTTP(httptest.NewRecorder(), req)
+		if seen != tt.identity {
+			t.Errorf("%s: expected identity '%s', got '%s'", tt.key, tt.identity, seen)
+		}
+	}
+}
@@ -134,6 +134,25 @@ func (c *cache) Delete(k string) {
 	}
 }
 
+// DeleteFunc deletes all the items whose key satisfies the given predicate.
+// thread safe
+func (c *cache) DeleteFunc(match func(string) bool) {
+	var evictedItems []keyAndValue
+	c.mu.Lock()
+	for k := range c.items {
+		if match(k) {
+			ov, evicted := c.delete(k)
+			if evicted {
+				evictedItems = append(evictedItems, keyAndValue{k, ov})
+			}
+		}
+	}
+	c.mu.Unlock()
+	for _, v := range evictedItems {
+		c.onEvicted(v.key, v.value)
+	}
+}
+
 // no thread safe
 func (c *cache) delete(k string) (interface{}, bool) {
 	if c.onEvicted != nil {
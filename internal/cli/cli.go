@@ -1,24 +1,35 @@
 package cli
 
 import (
+	"bytes"
+	"crypto/tls"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"os"
+	"sort"
 	"strings"
+	"text/tabwriter"
+	"time"
 
 	"github.com/grussorusso/serverledge/internal/api"
 	"github.com/grussorusso/serverledge/internal/client"
 	"github.com/grussorusso/serverledge/internal/config"
 	"github.com/grussorusso/serverledge/internal/function"
+	"github.com/grussorusso/serverledge/internal/trigger"
+	"github.com/grussorusso/serverledge/internal/workflow"
 	"github.com/grussorusso/serverledge/utils"
 	"github.com/spf13/cobra"
 )
 
 var ServerConfig config.RemoteServerConf
 
+// httpClient is used to contact the server (see SetTLSConfig)
+var httpClient = &http.Client{}
+
 var rootCmd = &cobra.Command{
 	Use:   "serverledge-cli",
 	Short: "CLI utility for Serverledge",
@@ -43,33 +54,136 @@ var createCmd = &cobra.Command{
 	Run:   create,
 }
 
+var publishCmd = &cobra.Command{
+	Use:   "publish",
+	Short: "Publishes a new version of an existing function",
+	Run:   publish,
+}
+
+var updateCmd = &cobra.Command{
+	Use:   "update",
+	Short: "Updates an existing function (omitted options are left unchanged)",
+	Run:   update,
+}
+
+var aliasCmd = &cobra.Command{
+	Use:   "alias",
+	Short: "Makes an alias refer to a function version",
+	Run:   setAlias,
+}
+
 var deleteCmd = &cobra.Command{
 	Use:   "delete",
 	Short: "Deletes a function",
 	Run:   deleteFunction,
 }
 
+var schemaCmd = &cobra.Command{
+	Use:   "schema",
+	Short: "Shows the input and output schemas of a function",
+	Run:   getSchema,
+}
+
 var listCmd = &cobra.Command{
 	Use:   "list",
 	Short: "Lists registered functions",
 	Run:   listFunctions,
 }
 
+var describeCmd = &cobra.Command{
+	Use:   "describe",
+	Short: "Shows the details of a function",
+	Run:   describeFunction,
+}
+
+var workflowCmd = &cobra.Command{
+	Use:   "workflow",
+	Short: "Manages workflows of functions",
+}
+
+var workflowCreateCmd = &cobra.Command{
+	Use:   "create",
+	Short: "Registers a new workflow from its JSON definition",
+	Run:   createWorkflow,
+}
+
+var workflowInvokeCmd = &cobra.Command{
+	Use:   "invoke",
+	Short: "Invokes a workflow",
+	Run:   invokeWorkflow,
+}
+
+var workflowDeleteCmd = &cobra.Command{
+	Use:   "delete",
+	Short: "Deletes a workflow",
+	Run:   deleteWorkflow,
+}
+
+var workflowListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "Lists registered workflows",
+	Run:   listWorkflows,
+}
+
+var triggerCmd = &cobra.Command{
+	Use:   "trigger",
+	Short: "Manages triggers of functions (cron schedules or broker topics)",
+}
+
+var triggerCreateCmd = &cobra.Command{
+	Use:   "create",
+	Short: "Registers a trigger invoking a function periodically or upon messages",
+	Run:   createTrigger,
+}
+
+var triggerDeleteCmd = &cobra.Command{
+	Use:   "delete",
+	Short: "Deletes a trigger",
+	Run:   deleteTrigger,
+}
+
+var triggerListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "Lists registered triggers",
+	Run:   listTriggers,
+}
+
+var triggerHistoryCmd = &cobra.Command{
+	Use:   "history",
+	Short: "Shows the last firings of a trigger",
+	Run:   getTriggerHistory,
+}
+
 var statusCmd = &cobra.Command{
 	Use:   "status",
 	Short: "Prints status information about the system",
 	Run:   getStatus,
 }
 
+var workflowName string
+var triggerName, schedule, area string
+var broker, brokerType, topic, brokerUser, brokerPassword string
+var brokerQoS, batchSize, triggerConcurrency int
+var batchWindow float64
 var funcName, runtime, handler, customImage, src, qosClass string
 var requestId string
+var pollWait time.Duration
+var alias string
+var version int64
 var memory int64
-var cpuDemand, qosMaxRespT float64
+var maxConcurrency int
+var cpuDemand, qosMaxRespT, timeout, keepAlive float64
 var params []string
 var paramsFile string
+var inputSchemaFile, outputSchemaFile string
+var labels []string
+var resetFields []string
+var outputFormat, runtimeFilter string
+var listLimit, listOffset int
 var asyncInvocation bool
 var verbose bool
 var returnOutput bool
+var callbackURL, callbackSecret string
 
 func Init() {
 	rootCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "verbose output")
@@ -77,13 +191,16 @@ func Init() {
 	rootCmd.PersistentFlags().IntVarP(&ServerConfig.Port, "port", "P", ServerConfig.Port, "remote Serverledge port")
 
 	rootCmd.AddCommand(invokeCmd)
-	invokeCmd.Flags().StringVarP(&funcName, "function", "f", "", "name of the function")
+	invokeCmd.Flags().StringVarP(&funcName, "function", "f", "", "name of the function (optionally followed by :version or @alias)")
 	invokeCmd.Flags().Float64VarP(&qosMaxRespT, "resptime", "", -1.0, "Max. response time (optional)")
 	invokeCmd.Flags().StringVarP(&qosClass, "class", "c", "", "QoS class (optional)")
 	invokeCmd.Flags().StringSliceVarP(&params, "param", "p", nil, "Function parameter: <name>:<value>")
 	invokeCmd.Flags().StringVarP(&paramsFile, "params_file", "j", "", "File containing parameters (JSON)")
 	invokeCmd.Flags().BoolVarP(&asyncInvocation, "async", "a", false, "Asynchronous invocation")
 	invokeCmd.Flags().BoolVarP(&returnOutput, "ret_output", "o", false, "Capture function output (if supported by used runtime)")
+	invokeCmd.Flags().Float64VarP(&timeout, "timeout", "", 0.0, "max. response time in seconds (overrides the function timeout)")
+	invokeCmd.Flags().StringVarP(&callbackURL, "callback", "", "", "URL notified with the results (only for async invocations)")
+	invokeCmd.Flags().StringVarP(&callbackSecret, "secret", "", "", "Key used to sign callback notifications (optional)")
 
 	rootCmd.AddCommand(createCmd)
 	createCmd.Flags().StringVarP(&funcName, "function", "f", "", "name of the function")
@@ -93,16 +210,107 @@ func Init() {
 	createCmd.Flags().Float64VarP(&cpuDemand, "cpu", "", 0.0, "estimated CPU demand for the function (1.0 = 1 core)")
 	createCmd.Flags().StringVarP(&src, "src", "", "", "source for the function (single file, directory or TAR archive) (not necessary for runtime==custom)")
 	createCmd.Flags().StringVarP(&customImage, "custom_image", "", "", "custom container image (only if runtime == 'custom')")
+	createCmd.Flags().Float64VarP(&timeout, "timeout", "", 0.0, "max. execution time in seconds (0 = unbounded)")
+	createCmd.Flags().Float64VarP(&keepAlive, "keepalive", "", 0.0, "seconds idle instances are kept warm (0 = node default)")
+	createCmd.Flags().IntVarP(&maxConcurrency, "concurrency", "", 0, "max. requests served at once by each instance (0 = 1)")
+	createCmd.Flags().StringVarP(&inputSchemaFile, "input_schema", "", "", "JSON Schema of the function parameters (file)")
+	createCmd.Flags().StringVarP(&outputSchemaFile, "output_schema", "", "", "JSON Schema of the function result (file)")
+	createCmd.Flags().StringSliceVarP(&labels, "label", "l", nil, "Function label: <key>=<value>")
+
+	rootCmd.AddCommand(publishCmd)
+	publishCmd.Flags().StringVarP(&funcName, "function", "f", "", "name of the function")
+	publishCmd.Flags().StringVarP(&runtime, "runtime", "", "python38", "runtime for the function")
+	publishCmd.Flags().StringVarP(&handler, "handler", "", "", "function handler (runtime specific)")
+	publishCmd.Flags().Int64VarP(&memory, "memory", "", 128, "memory (in MB) for the function")
+	publishCmd.Flags().Float64VarP(&cpuDemand, "cpu", "", 0.0, "estimated CPU demand for the function (1.0 = 1 core)")
+	publishCmd.Flags().StringVarP(&src, "src", "", "", "source for the function (single file, directory or TAR archive) (not necessary for runtime==custom)")
+	publishCmd.Flags().StringVarP(&customImage, "custom_image", "", "", "custom container image (only if runtime == 'custom')")
+	publishCmd.Flags().Float64VarP(&timeout, "timeout", "", 0.0, "max. execution time in seconds (0 = unbounded)")
+	publishCmd.Flags().Float64VarP(&keepAlive, "keepalive", "", 0.0, "seconds idle instances are kept warm (0 = node default)")
+	publishCmd.Flags().IntVarP(&maxConcurrency, "concurrency", "", 0, "max. requests served at once by each instance (0 = 1)")
+	publishCmd.Flags().StringVarP(&inputSchemaFile, "input_schema", "", "", "JSON Schema of the function parameters (file)")
+	publishCmd.Flags().StringVarP(&outputSchemaFile, "output_schema", "", "", "JSON Schema of the function result (file)")
+	publishCmd.Flags().StringSliceVarP(&labels, "label", "l", nil, "Function label: <key>=<value>")
+
+	rootCmd.AddCommand(updateCmd)
+	updateCmd.Flags().StringVarP(&funcName, "function", "f", "", "name of the function")
+	updateCmd.Flags().StringVarP(&runtime, "runtime", "", "", "runtime for the function")
+	updateCmd.Flags().StringVarP(&handler, "handler", "", "", "function handler (runtime specific)")
+	updateCmd.Flags().Int64VarP(&memory, "memory", "", 0, "memory (in MB) for the function")
+	updateCmd.Flags().Float64VarP(&cpuDemand, "cpu", "", 0.0, "estimated CPU demand for the function (1.0 = 1 core)")
+	updateCmd.Flags().StringVarP(&src, "src", "", "", "source for the function (single file, directory or TAR archive)")
+	updateCmd.Flags().StringVarP(&customImage, "custom_image", "", "", "custom container image (only if runtime == 'custom')")
+	updateCmd.Flags().Float64VarP(&timeout, "timeout", "", 0.0, "max. execution time in seconds")
+	updateCmd.Flags().Float64VarP(&keepAlive, "keepalive", "", 0.0, "seconds idle instances are kept warm")
+	updateCmd.Flags().IntVarP(&maxConcurrency, "concurrency", "", 0, "max. requests served at once by each instance")
+	updateCmd.Flags().StringVarP(&inputSchemaFile, "input_schema", "", "", "JSON Schema of the function parameters (file)")
+	updateCmd.Flags().StringVarP(&outputSchemaFile, "output_schema", "", "", "JSON Schema of the function result (file)")
+	updateCmd.Flags().StringSliceVarP(&labels, "label", "l", nil, "Function label: <key>=<value>")
+	updateCmd.Flags().StringSliceVarP(&resetFields, "reset", "", nil, fmt.Sprintf("fields reset to their default value (%s)", strings.Join(function.ResettableFields, ", ")))
+
+	rootCmd.AddCommand(aliasCmd)
+	aliasCmd.Flags().StringVarP(&funcName, "function", "f", "", "name of the function")
+	aliasCmd.Flags().StringVarP(&alias, "alias", "", "", "name of the alias (e.g., stable)")
+	aliasCmd.Flags().Int64VarP(&version, "version", "", 0, "function version the alias refers to")
 
 	rootCmd.AddCommand(deleteCmd)
 	deleteCmd.Flags().StringVarP(&funcName, "function", "f", "", "name of the function")
 
+	rootCmd.AddCommand(schemaCmd)
+	schemaCmd.Flags().StringVarP(&funcName, "function", "f", "", "name of the function (optionally followed by :version or @alias)")
+
 	rootCmd.AddCommand(listCmd)
+	listCmd.Flags().StringVarP(&outputFormat, "output", "o", "", "output format (\"wide\" for details)")
+	listCmd.Flags().StringVarP(&runtimeFilter, "runtime", "", "", "only list functions with the given runtime")
+	listCmd.Flags().StringSliceVarP(&labels, "label", "l", nil, "only list functions with the given label: <key> or <key>=<value>")
+	listCmd.Flags().IntVarP(&listLimit, "limit", "", 0, "max. number of functions (0 = unlimited)")
+	listCmd.Flags().IntVarP(&listOffset, "offset", "", 0, "number of functions skipped")
+
+	rootCmd.AddCommand(describeCmd)
+	describeCmd.Flags().StringVarP(&funcName, "function", "f", "", "name of the function (optionally followed by :version or @alias)")
+
+	rootCmd.AddCommand(workflowCmd)
+	workflowCmd.AddCommand(workflowCreateCmd)
+	workflowCreateCmd.Flags().StringVarP(&workflowName, "workflow", "w", "", "name of the workflow")
+	workflowCreateCmd.Flags().StringVarP(&src, "src", "", "", "JSON file with the definition of the workflow")
+	workflowCmd.AddCommand(workflowInvokeCmd)
+	workflowInvokeCmd.Flags().StringVarP(&workflowName, "workflow", "w", "", "name of the workflow")
+	workflowInvokeCmd.Flags().StringVarP(&qosClass, "class", "c", "", "QoS class (optional)")
+	workflowInvokeCmd.Flags().StringSliceVarP(&params, "param", "p", nil, "Workflow parameter: <name>:<value>")
+	workflowInvokeCmd.Flags().StringVarP(&paramsFile, "params_file", "j", "", "File containing parameters (JSON)")
+	workflowInvokeCmd.Flags().BoolVarP(&returnOutput, "ret_output", "o", false, "Capture function output (if supported by used runtime)")
+	workflowCmd.AddCommand(workflowDeleteCmd)
+	workflowDeleteCmd.Flags().StringVarP(&workflowName, "workflow", "w", "", "name of the workflow")
+	workflowCmd.AddCommand(workflowListCmd)
+
+	rootCmd.AddCommand(triggerCmd)
+	triggerCmd.AddCommand(triggerCreateCmd)
+	triggerCreateCmd.Flags().StringVarP(&triggerName, "trigger", "t", "", "name of the trigger")
+	triggerCreateCmd.Flags().StringVarP(&funcName, "function", "f", "", "name of the function (optionally followed by :version or @alias)")
+	triggerCreateCmd.Flags().StringVarP(&schedule, "schedule", "", "", "cron expression (e.g., '*/5 * * * *' or '@every 30s')")
+	triggerCreateCmd.Flags().StringSliceVarP(&params, "param", "p", nil, "Function parameter: <name>:<value>")
+	triggerCreateCmd.Flags().StringVarP(&paramsFile, "params_file", "j", "", "File containing parameters (JSON)")
+	triggerCreateCmd.Flags().StringVarP(&broker, "broker", "", "", "URL of the broker (e.g., tcp://host:1883), instead of a schedule")
+	triggerCreateCmd.Flags().StringVarP(&brokerType, "broker_type", "", trigger.MQTT, "type of broker")
+	triggerCreateCmd.Flags().StringVarP(&topic, "topic", "", "", "topic the trigger subscribes to")
+	triggerCreateCmd.Flags().IntVarP(&brokerQoS, "qos", "", 0, "QoS of the subscription")
+	triggerCreateCmd.Flags().StringVarP(&brokerUser, "broker_user", "", "", "username for the broker (optional)")
+	triggerCreateCmd.Flags().StringVarP(&brokerPassword, "broker_password", "", "", "password for the broker (optional)")
+	triggerCreateCmd.Flags().IntVarP(&batchSize, "batch", "", 1, "max. number of messages per invocation")
+	triggerCreateCmd.Flags().Float64VarP(&batchWindow, "batch_window", "", 0.0, "max. seconds waited to fill a batch (0 = 1 second)")
+	triggerCreateCmd.Flags().IntVarP(&triggerConcurrency, "concurrency", "", 1, "max. number of invocations in progress")
+	triggerCreateCmd.Flags().StringVarP(&area, "area", "", "", "area of the nodes firing the trigger (default: area of the contacted node)")
+	triggerCmd.AddCommand(triggerDeleteCmd)
+	triggerDeleteCmd.Flags().StringVarP(&triggerName, "trigger", "t", "", "name of the trigger")
+	triggerCmd.AddCommand(triggerListCmd)
+	triggerCmd.AddCommand(triggerHistoryCmd)
+	triggerHistoryCmd.Flags().StringVarP(&triggerName, "trigger", "t", "", "name of the trigger")
 
 	rootCmd.AddCommand(statusCmd)
 
 	rootCmd.AddCommand(pollCmd)
 	pollCmd.Flags().StringVarP(&requestId, "request", "", "", "ID of the async request")
+	pollCmd.Flags().DurationVarP(&pollWait, "wait", "w", 0, "wait for the result up to the given time (e.g., 30s)")
 
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Println(err)
@@ -124,7 +332,40 @@ func invoke(cmd *cobra.Command, args []string) {
 		showHelpAndExit(cmd)
 	}
 
-	// Parse parameters
+	paramsMap := parseParams(cmd)
+	if callbackURL != "" && !asyncInvocation {
+		fmt.Println("Callbacks are only supported for asynchronous invocations (--async)")
+		os.Exit(1)
+	}
+
+	// Prepare request
+	request := client.InvocationRequest{
+		Params:          paramsMap,
+		QoSClass:        int64(api.DecodeServiceClass(qosClass)),
+		QoSMaxRespT:     qosMaxRespT,
+		CanDoOffloading: true,
+		ReturnOutput:    returnOutput,
+		Async:           asyncInvocation,
+		CallbackURL:     callbackURL,
+		CallbackSecret:  callbackSecret,
+		TimeoutSeconds:  timeout}
+	invocationBody, err := json.Marshal(request)
+	if err != nil {
+		showHelpAndExit(cmd)
+	}
+
+	// Send invocation request
+	url := fmt.Sprintf("%s/invoke/%s", ServerConfig.BaseURL(), funcName)
+	resp, err := postJson(url, invocationBody)
+	if err != nil {
+		fmt.Printf("Invocation failed: %v\n", err)
+		os.Exit(2)
+	}
+	utils.PrintJsonResponse(resp.Body)
+}
+
+// parseParams reads the invocation parameters from the command line flags.
+func parseParams(cmd *cobra.Command) map[string]interface{} {
 	paramsMap := make(map[string]interface{})
 
 	// Parameters can be specified either via file ("--params_file") or via cli ("--param")
@@ -159,68 +400,166 @@ func invoke(cmd *cobra.Command, args []string) {
 			os.Exit(1)
 		}
 	}
+	return paramsMap
+}
 
-	// Prepare request
-	request := client.InvocationRequest{
-		Params:          paramsMap,
-		QoSClass:        int64(api.DecodeServiceClass(qosClass)),
-		QoSMaxRespT:     qosMaxRespT,
-		CanDoOffloading: true,
-		ReturnOutput:    returnOutput,
-		Async:           asyncInvocation}
-	invocationBody, err := json.Marshal(request)
+// buildFunction prepares a function descriptor based on the command line flags.
+func buildFunction(cmd *cobra.Command) function.Function {
+	if funcName == "" || runtime == "" {
+		showHelpAndExit(cmd)
+	}
+	if runtime == "custom" && customImage == "" {
+		showHelpAndExit(cmd)
+	} else if runtime != "custom" && src == "" {
+		showHelpAndExit(cmd)
+	}
+
+	var encoded string
+	if src != "" {
+		// sources are optional with custom runtimes
+		srcContent, err := readSourcesAsTar(src)
+		if err != nil {
+			fmt.Printf("%v\n", err)
+			os.Exit(3)
+		}
+		encoded = base64.StdEncoding.EncodeToString(srcContent)
+	} else {
+		encoded = ""
+	}
+
+	return function.Function{Name: funcName, Handler: handler,
+		Runtime: runtime, MemoryMB: memory,
+		CPUDemand:       cpuDemand,
+		TarFunctionCode: encoded,
+		CustomImage:     customImage,
+		TimeoutSeconds:  timeout,
+		KeepAlive:       keepAlive,
+		MaxConcurrency:  maxConcurrency,
+		InputSchema:     readSchema(inputSchemaFile),
+		OutputSchema:    readSchema(outputSchemaFile),
+		Labels:          parseLabels(),
+	}
+}
+
+// parseLabels returns the labels given through the command line.
+func parseLabels() map[string]string {
+	if len(labels) == 0 {
+		return nil
+	}
+	parsed := make(map[string]string, len(labels))
+	for _, label := range labels {
+		key, value, _ := strings.Cut(label, "=")
+		parsed[key] = value
+	}
+	return parsed
+}
+
+// readSchema reads a JSON Schema from a file (if any).
+func readSchema(path string) json.RawMessage {
+	if path == "" {
+		return nil
+	}
+	schema, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		os.Exit(3)
+	}
+	if !json.Valid(schema) {
+		fmt.Printf("Invalid JSON in %s\n", path)
+		os.Exit(3)
+	}
+	return schema
+}
+
+func create(cmd *cobra.Command, args []string) {
+	request := buildFunction(cmd)
+	requestBody, err := json.Marshal(request)
 	if err != nil {
 		showHelpAndExit(cmd)
 	}
 
-	// Send invocation request
-	url := fmt.Sprintf("http://%s:%d/invoke/%s", ServerConfig.Host, ServerConfig.Port, funcName)
-	resp, err := utils.PostJson(url, invocationBody)
+	url := fmt.Sprintf("%s/create", ServerConfig.BaseURL())
+	resp, err := postJson(url, requestBody)
 	if err != nil {
-		fmt.Printf("Invocation failed: %v\n", err)
+		// TODO: check returned error code
+		fmt.Printf("Creation request failed: %v\n", err)
 		os.Exit(2)
 	}
 	utils.PrintJsonResponse(resp.Body)
 }
 
-func create(cmd *cobra.Command, args []string) {
-	if funcName == "" || runtime == "" {
+func publish(cmd *cobra.Command, args []string) {
+	request := buildFunction(cmd)
+	requestBody, err := json.Marshal(request)
+	if err != nil {
 		showHelpAndExit(cmd)
 	}
-	if runtime == "custom" && customImage == "" {
-		showHelpAndExit(cmd)
-	} else if runtime != "custom" && src == "" {
+
+	url := fmt.Sprintf("%s/publish", ServerConfig.BaseURL())
+	resp, err := postJson(url, requestBody)
+	if err != nil {
+		fmt.Printf("Publishing request failed: %v\n", err)
+		os.Exit(2)
+	}
+	utils.PrintJsonResponse(resp.Body)
+}
+
+func update(cmd *cobra.Command, args []string) {
+	if funcName == "" {
 		showHelpAndExit(cmd)
 	}
 
 	var encoded string
-	if runtime != "custom" {
+	if src != "" {
 		srcContent, err := readSourcesAsTar(src)
 		if err != nil {
 			fmt.Printf("%v\n", err)
 			os.Exit(3)
 		}
 		encoded = base64.StdEncoding.EncodeToString(srcContent)
-	} else {
-		encoded = ""
 	}
 
-	request := function.Function{Name: funcName, Handler: handler,
+	request := client.UpdateRequest{Function: function.Function{Name: funcName, Handler: handler,
 		Runtime: runtime, MemoryMB: memory,
 		CPUDemand:       cpuDemand,
 		TarFunctionCode: encoded,
 		CustomImage:     customImage,
+		TimeoutSeconds:  timeout,
+		KeepAlive:       keepAlive,
+		MaxConcurrency:  maxConcurrency,
+		InputSchema:     readSchema(inputSchemaFile),
+		OutputSchema:    readSchema(outputSchemaFile),
+		Labels:          parseLabels(),
+	}, Reset: resetFields}
+	requestBody, err := json.Marshal(request)
+	if err != nil {
+		showHelpAndExit(cmd)
+	}
+
+	url := fmt.Sprintf("%s/update", ServerConfig.BaseURL())
+	resp, err := postJson(url, requestBody)
+	if err != nil {
+		fmt.Printf("Update request failed: %v\n", err)
+		os.Exit(2)
+	}
+	utils.PrintJsonResponse(resp.Body)
+}
+
+func setAlias(cmd *cobra.Command, args []string) {
+	if funcName == "" || alias == "" || version < 1 {
+		showHelpAndExit(cmd)
 	}
+
+	request := client.AliasRequest{Function: funcName, Alias: alias, Version: version}
 	requestBody, err := json.Marshal(request)
 	if err != nil {
 		showHelpAndExit(cmd)
 	}
 
-	url := fmt.Sprintf("http://%s:%d/create", ServerConfig.Host, ServerConfig.Port)
-	resp, err := utils.PostJson(url, requestBody)
+	url := fmt.Sprintf("%s/alias", ServerConfig.BaseURL())
+	resp, err := postJson(url, requestBody)
 	if err != nil {
-		// TODO: check returned error code
-		fmt.Printf("Creation request failed: %v\n", err)
+		fmt.Printf("Alias request failed: %v\n", err)
 		os.Exit(2)
 	}
 	utils.PrintJsonResponse(resp.Body)
@@ -269,8 +608,8 @@ func deleteFunction(cmd *cobra.Command, args []string) {
 		os.Exit(2)
 	}
 
-	url := fmt.Sprintf("http://%s:%d/delete", ServerConfig.Host, ServerConfig.Port)
-	resp, err := utils.PostJson(url, requestBody)
+	url := fmt.Sprintf("%s/delete", ServerConfig.BaseURL())
+	resp, err := postJson(url, requestBody)
 	if err != nil {
 		fmt.Printf("Deletion request failed: %v\n", err)
 		os.Exit(2)
@@ -279,8 +618,177 @@ func deleteFunction(cmd *cobra.Command, args []string) {
 }
 
 func listFunctions(cmd *cobra.Command, args []string) {
-	url := fmt.Sprintf("http://%s:%d/function", ServerConfig.Host, ServerConfig.Port)
-	resp, err := http.Get(url)
+	if outputFormat != "" && outputFormat != "wide" {
+		showHelpAndExit(cmd)
+	}
+
+	query := url.Values{}
+	if runtimeFilter != "" {
+		query.Set("runtime", runtimeFilter)
+	}
+	for _, label := range labels {
+		query.Add("label", label)
+	}
+	if listLimit > 0 {
+		query.Set("limit", fmt.Sprint(listLimit))
+	}
+	if listOffset > 0 {
+		query.Set("offset", fmt.Sprint(listOffset))
+	}
+	if outputFormat == "wide" {
+		query.Set("details", "true")
+	}
+
+	resp, err := get(fmt.Sprintf("%s/function?%s", ServerConfig.BaseURL(), query.Encode()))
+	if err != nil {
+		fmt.Printf("List request failed: %v\n", err)
+		os.Exit(2)
+	}
+	if outputFormat != "wide" || resp.StatusCode != http.StatusOK {
+		utils.PrintJsonResponse(resp.Body)
+		return
+	}
+
+	defer resp.Body.Close()
+	var descriptors []function.Descriptor
+	if err = json.NewDecoder(resp.Body).Decode(&descriptors); err != nil {
+		fmt.Printf("Invalid response: %v\n", err)
+		os.Exit(2)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tVERSION\tRUNTIME\tMEMORY\tCPU\tCREATED\tLABELS")
+	for _, d := range descriptors {
+		created := "-"
+		if !d.Created.IsZero() {
+			created = d.Created.Local().Format(time.DateTime)
+		}
+		fmt.Fprintf(w, "%s\t%d\t%s\t%d\t%g\t%s\t%s\n", d.Name, d.Version, d.Runtime, d.MemoryMB,
+			d.CPUDemand, created, formatLabels(d.Labels))
+	}
+	_ = w.Flush()
+}
+
+// formatLabels returns labels as a sorted, comma-separated list.
+func formatLabels(labels map[string]string) string {
+	list := make([]string, 0, len(labels))
+	for key, value := range labels {
+		list = append(list, key+"="+value)
+	}
+	sort.Strings(list)
+	return strings.Join(list, ",")
+}
+
+func describeFunction(cmd *cobra.Command, args []string) {
+	if funcName == "" {
+		showHelpAndExit(cmd)
+	}
+
+	resp, err := get(fmt.Sprintf("%s/function/%s", ServerConfig.BaseURL(), funcName))
+	if err != nil {
+		fmt.Printf("Describe request failed: %v\n", err)
+		os.Exit(2)
+	}
+	utils.PrintJsonResponse(resp.Body)
+}
+
+func getSchema(cmd *cobra.Command, args []string) {
+	if funcName == "" {
+		showHelpAndExit(cmd)
+	}
+
+	url := fmt.Sprintf("%s/function/%s/schema", ServerConfig.BaseURL(), funcName)
+	resp, err := get(url)
+	if err != nil {
+		fmt.Printf("Schema request failed: %v\n", err)
+		os.Exit(2)
+	}
+	utils.PrintJsonResponse(resp.Body)
+}
+
+func createWorkflow(cmd *cobra.Command, args []string) {
+	if workflowName == "" || src == "" {
+		showHelpAndExit(cmd)
+	}
+
+	definition, err := os.ReadFile(src)
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		os.Exit(3)
+	}
+	var request workflow.Workflow
+	if err = json.Unmarshal(definition, &request); err != nil {
+		fmt.Printf("Could not parse the workflow definition: %v\n", err)
+		os.Exit(3)
+	}
+	request.Name = workflowName
+	requestBody, err := json.Marshal(request)
+	if err != nil {
+		showHelpAndExit(cmd)
+	}
+
+	url := fmt.Sprintf("%s/workflow/create", ServerConfig.BaseURL())
+	resp, err := postJson(url, requestBody)
+	if err != nil {
+		fmt.Printf("Creation request failed: %v\n", err)
+		if resp != nil {
+			utils.PrintJsonResponse(resp.Body)
+		}
+		os.Exit(2)
+	}
+	utils.PrintJsonResponse(resp.Body)
+}
+
+func invokeWorkflow(cmd *cobra.Command, args []string) {
+	if workflowName == "" {
+		showHelpAndExit(cmd)
+	}
+
+	request := client.WorkflowInvocationRequest{
+		Params:          parseParams(cmd),
+		QoSClass:        int64(api.DecodeServiceClass(qosClass)),
+		CanDoOffloading: true,
+		ReturnOutput:    returnOutput,
+	}
+	invocationBody, err := json.Marshal(request)
+	if err != nil {
+		showHelpAndExit(cmd)
+	}
+
+	url := fmt.Sprintf("%s/workflow/invoke/%s", ServerConfig.BaseURL(), workflowName)
+	resp, err := postJson(url, invocationBody)
+	if err != nil {
+		fmt.Printf("Invocation failed: %v\n", err)
+		if resp != nil {
+			// report of the failed steps
+			utils.PrintJsonResponse(resp.Body)
+		}
+		os.Exit(2)
+	}
+	utils.PrintJsonResponse(resp.Body)
+}
+
+func deleteWorkflow(cmd *cobra.Command, args []string) {
+	if workflowName == "" {
+		showHelpAndExit(cmd)
+	}
+	requestBody, err := json.Marshal(workflow.Workflow{Name: workflowName})
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(2)
+	}
+
+	url := fmt.Sprintf("%s/workflow/delete", ServerConfig.BaseURL())
+	resp, err := postJson(url, requestBody)
+	if err != nil {
+		fmt.Printf("Deletion request failed: %v\n", err)
+		os.Exit(2)
+	}
+	utils.PrintJsonResponse(resp.Body)
+}
+
+func listWorkflows(cmd *cobra.Command, args []string) {
+	url := fmt.Sprintf("%s/workflow", ServerConfig.BaseURL())
+	resp, err := get(url)
 	if err != nil {
 		fmt.Printf("List request failed: %v\n", err)
 		os.Exit(2)
@@ -288,9 +796,94 @@ func listFunctions(cmd *cobra.Command, args []string) {
 	utils.PrintJsonResponse(resp.Body)
 }
 
+func createTrigger(cmd *cobra.Command, args []string) {
+	if triggerName == "" || funcName == "" || (schedule == "") == (broker == "") {
+		showHelpAndExit(cmd)
+	}
+
+	request := trigger.Trigger{
+		Name:     triggerName,
+		Function: funcName,
+		Schedule: schedule,
+		Params:   parseParams(cmd),
+		Area:     area,
+	}
+	if broker != "" {
+		request.Source = &trigger.Source{
+			Type:           brokerType,
+			URL:            broker,
+			Topic:          topic,
+			QoS:            brokerQoS,
+			Username:       brokerUser,
+			Password:       brokerPassword,
+			BatchSize:      batchSize,
+			BatchWindow:    batchWindow,
+			MaxConcurrency: triggerConcurrency,
+		}
+	}
+	requestBody, err := json.Marshal(request)
+	if err != nil {
+		showHelpAndExit(cmd)
+	}
+
+	url := fmt.Sprintf("%s/trigger/create", ServerConfig.BaseURL())
+	resp, err := postJson(url, requestBody)
+	if err != nil {
+		fmt.Printf("Creation request failed: %v\n", err)
+		if resp != nil {
+			utils.PrintJsonResponse(resp.Body)
+		}
+		os.Exit(2)
+	}
+	utils.PrintJsonResponse(resp.Body)
+}
+
+func deleteTrigger(cmd *cobra.Command, args []string) {
+	if triggerName == "" {
+		showHelpAndExit(cmd)
+	}
+	requestBody, err := json.Marshal(trigger.Trigger{Name: triggerName})
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(2)
+	}
+
+	url := fmt.Sprintf("%s/trigger/delete", ServerConfig.BaseURL())
+	resp, err := postJson(url, requestBody)
+	if err != nil {
+		fmt.Printf("Deletion request failed: %v\n", err)
+		os.Exit(2)
+	}
+	utils.PrintJsonResponse(resp.Body)
+}
+
+func listTriggers(cmd *cobra.Command, args []string) {
+	url := fmt.Sprintf("%s/trigger", ServerConfig.BaseURL())
+	resp, err := get(url)
+	if err != nil {
+		fmt.Printf("List request failed: %v\n", err)
+		os.Exit(2)
+	}
+	utils.PrintJsonResponse(resp.Body)
+}
+
+func getTriggerHistory(cmd *cobra.Command, args []string) {
+	if triggerName == "" {
+		showHelpAndExit(cmd)
+	}
+
+	url := fmt.Sprintf("%s/trigger/%s/history", ServerConfig.BaseURL(), triggerName)
+	resp, err := get(url)
+	if err != nil {
+		fmt.Printf("History request failed: %v\n", err)
+		os.Exit(2)
+	}
+	utils.PrintJsonResponse(resp.Body)
+}
+
 func getStatus(cmd *cobra.Command, args []string) {
-	url := fmt.Sprintf("http://%s:%d/status", ServerConfig.Host, ServerConfig.Port)
-	resp, err := http.Get(url)
+	url := fmt.Sprintf("%s/status", ServerConfig.BaseURL())
+	resp, err := get(url)
 	if err != nil {
 		fmt.Printf("Invocation failed: %v", err)
 		os.Exit(2)
@@ -303,11 +896,58 @@ func poll(cmd *cobra.Command, args []string) {
 		showHelpAndExit(cmd)
 	}
 
-	url := fmt.Sprintf("http://%s:%d/poll/%s", ServerConfig.Host, ServerConfig.Port, requestId)
-	resp, err := http.Get(url)
+	url := fmt.Sprintf("%s/poll/%s", ServerConfig.BaseURL(), requestId)
+	if pollWait > 0 {
+		url = fmt.Sprintf("%s?wait=%s", url, pollWait)
+	}
+	resp, err := get(url)
 	if err != nil {
 		fmt.Printf("Polling request failed: %v\n", err)
 		os.Exit(2)
 	}
 	utils.PrintJsonResponse(resp.Body)
 }
+
+// SetTLSConfig makes the client contact the server through TLS.
+func SetTLSConfig(tlsConfig *tls.Config) {
+	ServerConfig.TLS = true
+	httpClient.Transport = &http.Transport{TLSClientConfig: tlsConfig}
+}
+
+// setCredentials adds the client credentials (if any) to a request.
+func setCredentials(req *http.Request) {
+	if ServerConfig.APIKey != "" {
+		req.Header.Set(client.API_KEY_HEADER, ServerConfig.APIKey)
+	}
+	if ServerConfig.Namespace != "" {
+		req.Header.Set(client.NAMESPACE_HEADER, ServerConfig.Namespace)
+	}
+}
+
+// postJson sends a JSON request to the server, failing on non-OK responses.
+func postJson(url string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewBuffer(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	setCredentials(req)
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return resp, fmt.Errorf("Server response: %v", resp.Status)
+	}
+	return resp, nil
+}
+
+func get(url string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	setCredentials(req)
+	return httpClient.Do(req)
+}
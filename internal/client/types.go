@@ -1,5 +1,14 @@
 package client
 
+import "github.com/grussorusso/serverledge/internal/function"
+
+// API_KEY_HEADER is the HTTP header carrying the API key of the client.
+const API_KEY_HEADER = "Serverledge-API-Key"
+
+// NAMESPACE_HEADER is the HTTP header carrying the namespace of the request,
+// if not implied by the API key.
+const NAMESPACE_HEADER = "Serverledge-Namespace"
+
 type InvocationRequest struct {
 	Params          map[string]interface{}
 	QoSClass        int64
@@ -7,6 +16,10 @@ type InvocationRequest struct {
 	CanDoOffloading bool
 	Async           bool
 	ReturnOutput    bool
+	CallbackURL     string  // notified upon completion of async invocations (optional)
+	CallbackSecret  string  // key used to sign callback notifications (optional)
+	ReqId           string  // identifier of async requests offloaded by another node
+	TimeoutSeconds  float64 // overrides the timeout of the function (optional)
 }
 
 type PrewarmingRequest struct {
@@ -14,3 +27,24 @@ type PrewarmingRequest struct {
 	Instances      int64
 	ForceImagePull bool
 }
+
+// UpdateRequest describes the update of a function: non-empty fields are
+// overridden, while the fields listed in Reset are reset to their default
+// value (see function.ResettableFields).
+type UpdateRequest struct {
+	function.Function
+	Reset []string
+}
+
+type AliasRequest struct {
+	Function string
+	Alias    string
+	Version  int64
+}
+
+type WorkflowInvocationRequest struct {
+	Params          map[string]interface{}
+	QoSClass        int64
+	CanDoOffloading bool
+	ReturnOutput    bool
+}
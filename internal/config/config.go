@@ -50,6 +50,19 @@ func GetBool(key string, defaultValue bool) bool {
 	}
 }
 
+func GetStringSlice(key string, defaultValue []string) []string {
+	if viper.IsSet(key) {
+		return viper.GetStringSlice(key)
+	} else {
+		return defaultValue
+	}
+}
+
+// UnmarshalKey decodes the configured value for a given key into rawVal.
+func UnmarshalKey(key string, rawVal interface{}) error {
+	return viper.UnmarshalKey(key, rawVal)
+}
+
 // ReadConfiguration reads a configuration file stored in one of the predefined paths.
 func ReadConfiguration(fileName string) {
 	// paths where the config file can be placed
@@ -9,10 +9,23 @@ const API_PORT = "api.port"
 // REMOTE SERVER URL
 const CLOUD_URL = "cloud.server.url"
 
+// Container factory to use
+// Possible values: "docker" (default), "process"
+const FACTORY_TYPE = "factory.type"
+
+// Path of the Executor binary used by the "process" factory
+const FACTORY_PROCESS_EXECUTOR = "factory.process.executor"
+
+// Directory where the "process" factory creates function instances
+const FACTORY_PROCESS_DIR = "factory.process.dir"
+
 // Forces runtime container images to be pulled the first time they are used,
 // even if they are locally available (true/false).
 const FACTORY_REFRESH_IMAGES = "factory.images.refresh"
 
+// Directory where the Docker daemon stores container checkpoints
+const FACTORY_DOCKER_CHECKPOINT_DIR = "factory.docker.checkpoints"
+
 // Amount of memory available for the container pool (in MB)
 const POOL_MEMORY_MB = "container.pool.memory"
 
@@ -25,6 +38,41 @@ const POOL_CLEANUP_PERIOD = "janitor.interval"
 // container expiration time
 const CONTAINER_EXPIRATION_TIME = "container.expiration"
 
+// Pauses idle warm containers, so that they do not use CPU (true/false)
+const CONTAINER_PAUSE_IDLE = "container.pause"
+
+// Snapshots of initialized containers used to speed up cold starts
+// Possible values: "none" (default), "pause", "checkpoint"
+const SNAPSHOT_MODE = "container.snapshot"
+
+// Policy deciding how long idle containers are kept warm
+// Possible values: "fixed" (CONTAINER_EXPIRATION_TIME, default), "adaptive"
+const KEEPALIVE_POLICY = "container.keepalive.policy"
+
+// Percentile of the inter-arrival times covered by the "adaptive" keep-alive policy
+const KEEPALIVE_PERCENTILE = "container.keepalive.percentile"
+
+// Bounds (in seconds) of the keep-alive time learned by the "adaptive" policy
+const KEEPALIVE_MIN = "container.keepalive.min"
+const KEEPALIVE_MAX = "container.keepalive.max"
+
+// Policy ranking idle containers to evict when memory is needed
+// Possible values: "lru" (default), "greedydual"
+const EVICTION_POLICY = "container.eviction.policy"
+
+// Policy used to pre-spawn warm containers according to the forecast demand
+// Possible values: "none" (default), "ewma"
+const PREWARM_POLICY = "prewarm.policy"
+
+// Activation interval (in seconds) of the prewarming controller
+const PREWARM_INTERVAL = "prewarm.interval"
+
+// Max. number of containers kept by the prewarming controller for each function
+const PREWARM_MAX_CONTAINERS = "prewarm.max"
+
+// Smoothing factor of the "ewma" prewarming policy
+const PREWARM_EWMA_ALPHA = "prewarm.ewma.alpha"
+
 // cache capacity
 const CACHE_SIZE = "cache.size"
 
@@ -59,12 +107,94 @@ const METRICS_PROMETHEUS_HOST = "metrics.prometheus.host"
 const METRICS_PROMETHEUS_PORT = "metrics.prometheus.port"
 
 // Scheduling policy to use
-// Possible values: "qosaware", "default", "cloudonly"
+// Possible values: "qosaware", "default", "cloudonly", "edgecloud", "edgeonly"
 const SCHEDULING_POLICY = "scheduler.policy"
 
 // Capacity of the queue (possibly) used by the scheduler
 const SCHEDULER_QUEUE_CAPACITY = "scheduler.queue.capacity"
 
+// Ordering of the scheduler queue
+// Possible values: "priority" (by service class and deadline), "fifo"
+const SCHEDULER_QUEUE_POLICY = "scheduler.queue.policy"
+
+// Max. time (in seconds) a request can wait in the scheduler queue (0 -> unbounded)
+const SCHEDULER_QUEUE_MAX_WAIT = "scheduler.queue.maxwait"
+
+// Number of workers serving async invocations on each node
+const ASYNC_WORKERS = "async.workers"
+
+// Number of attempts before an async invocation is moved to the dead-letter area
+const ASYNC_MAX_ATTEMPTS = "async.attempts"
+
+// Delay (in seconds) before retrying a failed async invocation; it doubles
+// after every failure, up to ASYNC_MAX_BACKOFF
+const ASYNC_BACKOFF = "async.backoff.initial"
+const ASYNC_MAX_BACKOFF = "async.backoff.max"
+
+// Number of attempts to deliver a callback notification
+const CALLBACK_MAX_ATTEMPTS = "async.callback.attempts"
+
+// Timeout (in seconds) for the delivery of a callback notification
+const CALLBACK_TIMEOUT = "async.callback.timeout"
+
+// Hosts that callback URLs may refer to; if unset, any host with a public
+// address is allowed
+const CALLBACK_ALLOWED_HOSTS = "async.callback.hosts"
+
+// Key used to encrypt the callback secrets stored in Etcd (default: AUTH_CLUSTER_KEY)
+const CALLBACK_KEY = "async.callback.key"
+
+// Admission control: default limits for every function and API key, which
+// can be overridden for specific functions and keys
+// (e.g., "admission.functions.<name>.rate", "admission.keys.<key>.rate")
+const ADMISSION_FUNCTION_LIMITS = "admission.function"
+const ADMISSION_KEY_LIMITS = "admission.key"
+const ADMISSION_FUNCTION_OVERRIDES = "admission.functions"
+const ADMISSION_KEY_OVERRIDES = "admission.keys"
+
+// Suffixes of admission control keys (0 -> unlimited)
+const ADMISSION_RATE = ".rate"               // requests per second
+const ADMISSION_BURST = ".burst"             // max. requests admitted at once
+const ADMISSION_CONCURRENCY = ".concurrency" // max. requests being served
+
+// Enables authentication of API requests
+const AUTH_ENABLED = "auth.enabled"
+
+// List of API keys, each with "key", "namespace" and "roles"
+const AUTH_KEYS = "auth.keys"
+
+// API key used to offload requests to other nodes (accepted for
+// invocations in any namespace)
+const AUTH_CLUSTER_KEY = "auth.cluster.key"
+
+// Credentials used by the CLI
+// (can be overridden through $SERVERLEDGE_API_KEY and $SERVERLEDGE_NAMESPACE)
+const CLIENT_API_KEY = "client.key"
+const CLIENT_NAMESPACE = "client.namespace"
+
+// TLS certificate and key of the node, used by the API server and (as
+// client certificate) to contact other nodes. TLS is enabled if set.
+const TLS_CERT = "tls.cert"
+const TLS_KEY = "tls.key"
+
+// CA used to verify the certificates of other nodes
+const TLS_CA = "tls.ca"
+
+// Authentication of API clients through certificates signed by TLS_CA
+// Possible values: "none" (default), "optional", "required"
+const TLS_CLIENT_AUTH = "tls.clientauth"
+
+// TLS configuration for Etcd (all optional)
+const ETCD_TLS_CERT = "etcd.tls.cert"
+const ETCD_TLS_KEY = "etcd.tls.key"
+const ETCD_TLS_CA = "etcd.tls.ca"
+
+// TLS configuration used by the CLI
+const CLIENT_TLS_ENABLED = "client.tls.enabled"
+const CLIENT_TLS_CA = "client.tls.ca"
+const CLIENT_TLS_CERT = "client.tls.cert"
+const CLIENT_TLS_KEY = "client.tls.key"
+
 // Enables tracing
 const TRACING_ENABLED = "tracing.enabled"
 
@@ -1,6 +1,20 @@
 package config
 
+import "fmt"
+
 type RemoteServerConf struct {
-	Host string
-	Port int
+	Host      string
+	Port      int
+	APIKey    string // optional
+	Namespace string // optional (only for keys granting access to every namespace)
+	TLS       bool
+}
+
+// BaseURL returns the URL of the remote server API.
+func (c *RemoteServerConf) BaseURL() string {
+	scheme := "http"
+	if c.TLS {
+		scheme = "https"
+	}
+	return fmt.Sprintf("%s://%s:%d", scheme, c.Host, c.Port)
 }
@@ -2,17 +2,22 @@ package container
 
 import (
 	"bytes"
+	"context"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"net"
 	"net/http"
 	"time"
 
 	"github.com/grussorusso/serverledge/internal/executor"
 )
 
+var CheckpointNotSupportedErr = errors.New("checkpoints not supported by the container factory")
+
 // NewContainer creates and starts a new container.
 func NewContainer(image, codeTar string, opts *ContainerOptions) (ContainerID, error) {
 	contID, err := cf.Create(image, opts)
@@ -38,18 +43,106 @@ func NewContainer(image, codeTar string, opts *ContainerOptions) (ContainerID, e
 	return contID, nil
 }
 
+// RestoreContainer creates a new container and starts it from a checkpoint
+// (see Checkpointer).
+func RestoreContainer(image, codeTar string, opts *ContainerOptions, checkpointID string) (ContainerID, error) {
+	checkpointer, ok := cf.(Checkpointer)
+	if !ok {
+		return "", CheckpointNotSupportedErr
+	}
+
+	contID, err := cf.Create(image, opts)
+	if err != nil {
+		log.Printf("Failed container creation\n")
+		return "", err
+	}
+
+	if len(codeTar) > 0 {
+		decodedCode, _ := base64.StdEncoding.DecodeString(codeTar)
+		err = cf.CopyToContainer(contID, bytes.NewReader(decodedCode), "/app/")
+		if err != nil {
+			log.Printf("Failed code copy\n")
+			_ = cf.Destroy(contID)
+			return "", err
+		}
+	}
+
+	if err = checkpointer.Restore(contID, checkpointID); err != nil {
+		_ = cf.Destroy(contID)
+		return "", err
+	}
+	return contID, nil
+}
+
+// SupportsCheckpoint returns true if the container factory of the node
+// supports checkpoint/restore.
+func SupportsCheckpoint() bool {
+	_, ok := cf.(Checkpointer)
+	return ok
+}
+
+// Checkpoint saves the state of a container (see Checkpointer), which is stopped.
+func Checkpoint(contID ContainerID, checkpointID string) error {
+	checkpointer, ok := cf.(Checkpointer)
+	if !ok {
+		return CheckpointNotSupportedErr
+	}
+	return checkpointer.Checkpoint(contID, checkpointID)
+}
+
+// DeleteCheckpoint removes a checkpoint of a container (see Checkpointer).
+func DeleteCheckpoint(contID ContainerID, checkpointID string) error {
+	checkpointer, ok := cf.(Checkpointer)
+	if !ok {
+		return CheckpointNotSupportedErr
+	}
+	return checkpointer.DeleteCheckpoint(contID, checkpointID)
+}
+
+func Pause(id ContainerID) error {
+	return cf.Pause(id)
+}
+
+func Unpause(id ContainerID) error {
+	return cf.Unpause(id)
+}
+
+// WaitReady waits until the Executor of a started container accepts connections.
+func WaitReady(contID ContainerID, timeout time.Duration) error {
+	executorAddr, err := cf.GetExecutorAddress(contID)
+	if err != nil {
+		return fmt.Errorf("Failed to retrieve executor address for container: %v", err)
+	}
+
+	deadline := time.Now().Add(timeout)
+	backoff := 25 * time.Millisecond
+	for {
+		conn, err := net.DialTimeout("tcp", executorAddr, time.Until(deadline))
+		if err == nil {
+			return conn.Close()
+		}
+		if time.Now().Add(backoff).After(deadline) {
+			return fmt.Errorf("executor not ready: %v", err)
+		}
+		time.Sleep(backoff)
+		backoff = time.Duration(minInt(int(backoff*2), int(500*time.Millisecond)))
+	}
+}
+
 // Execute interacts with the Executor running in the container to invoke the
-// function through a HTTP request.
-func Execute(contID ContainerID, req *executor.InvocationRequest) (*executor.InvocationResult, time.Duration, error) {
-	ipAddr, err := cf.GetIPAddress(contID)
+// function through a HTTP request. The request is aborted when ctx is done
+// (the returned error wraps ctx.Err()).
+func Execute(ctx context.Context, contID ContainerID, req *executor.InvocationRequest) (*executor.InvocationResult, time.Duration, error) {
+	executorAddr, err := cf.GetExecutorAddress(contID)
 	if err != nil {
-		return nil, 0, fmt.Errorf("Failed to retrieve IP address for container: %v", err)
+		return nil, 0, fmt.Errorf("Failed to retrieve executor address for container: %v", err)
 	}
 
 	postBody, _ := json.Marshal(req)
-	postBodyB := bytes.NewBuffer(postBody)
-	resp, waitDuration, err := sendPostRequestWithRetries(fmt.Sprintf("http://%s:%d/invoke", ipAddr,
-		executor.DEFAULT_EXECUTOR_PORT), postBodyB)
+	resp, waitDuration, err := sendPostRequestWithRetries(ctx, fmt.Sprintf("http://%s/invoke", executorAddr), postBody)
+	if ctx.Err() != nil {
+		return nil, waitDuration, fmt.Errorf("Request to executor aborted: %w", ctx.Err())
+	}
 	if err != nil || resp == nil {
 		return nil, waitDuration, fmt.Errorf("Request to executor failed: %v", err)
 	}
@@ -64,6 +157,9 @@ func Execute(contID ContainerID, req *executor.InvocationRequest) (*executor.Inv
 	response := &executor.InvocationResult{}
 	err = d.Decode(response)
 	if err != nil {
+		if ctx.Err() != nil {
+			return nil, waitDuration, fmt.Errorf("Request to executor aborted: %w", ctx.Err())
+		}
 		return nil, waitDuration, fmt.Errorf("Parsing executor response failed: %v", err)
 	}
 
@@ -78,7 +174,7 @@ func Destroy(id ContainerID) error {
 	return cf.Destroy(id)
 }
 
-func sendPostRequestWithRetries(url string, body *bytes.Buffer) (*http.Response, time.Duration, error) {
+func sendPostRequestWithRetries(ctx context.Context, url string, body []byte) (*http.Response, time.Duration, error) {
 	const TIMEOUT_MILLIS = 30000
 	const MAX_BACKOFF_MILLIS = 500
 	var backoffMillis = 25
@@ -87,8 +183,15 @@ func sendPostRequestWithRetries(url string, body *bytes.Buffer) (*http.Response,
 
 	var err error
 
-	for totalWaitMillis < TIMEOUT_MILLIS {
-		resp, err := http.Post(url, "application/json", body)
+	for totalWaitMillis < TIMEOUT_MILLIS && ctx.Err() == nil {
+		var req *http.Request
+		req, err = http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+		if err != nil {
+			return nil, 0, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		var resp *http.Response
+		resp, err = http.DefaultClient.Do(req)
 		if err == nil {
 			return resp, time.Duration(totalWaitMillis * int(time.Millisecond)), err
 		} else if attempts > 3 {
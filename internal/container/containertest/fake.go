@@ -0,0 +1,245 @@
+// Package containertest provides a fake container factory for tests.
+package containertest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/grussorusso/serverledge/internal/container"
+	"github.com/grussorusso/serverledge/internal/executor"
+)
+
+// FakeFactory is an in-memory Factory that does not create any real
+// container. It simulates cold start latency and answers invocations through
+// a local HTTP server, so that the rest of the system can be tested without a
+// container engine.
+type FakeFactory struct {
+	// ColdStartLatency is the time spent by Start
+	ColdStartLatency time.Duration
+	// RestoreLatency is the time spent by Restore
+	RestoreLatency time.Duration
+	// ExecutionTime is the time spent by the executor to serve a request
+	ExecutionTime time.Duration
+	// Handler computes the executor response (optional)
+	Handler func(*executor.InvocationRequest) *executor.InvocationResult
+
+	mu          sync.Mutex
+	server      *httptest.Server
+	containers  map[container.ContainerID]*fakeContainer
+	nextID      int
+	checkpoints map[string]bool
+	Created     int
+	Destroyed   int
+	Restored    int
+}
+
+type fakeContainer struct {
+	image   string
+	opts    container.ContainerOptions
+	started bool
+	paused  bool
+}
+
+// InitFakeContainerFactory installs a FakeFactory as the container factory of the node.
+// Close must be called to release the underlying HTTP server.
+func InitFakeContainerFactory(coldStartLatency, executionTime time.Duration) *FakeFactory {
+	fakeFact := &FakeFactory{
+		ColdStartLatency: coldStartLatency,
+		ExecutionTime:    executionTime,
+		containers:       make(map[container.ContainerID]*fakeContainer),
+		checkpoints:      make(map[string]bool),
+	}
+	fakeFact.server = httptest.NewServer(http.HandlerFunc(fakeFact.invokeHandler))
+	container.SetFactory(fakeFact)
+	return fakeFact
+}
+
+// Close shuts down the fake executor server.
+func (ff *FakeFactory) Close() {
+	ff.server.Close()
+}
+
+func (ff *FakeFactory) invokeHandler(w http.ResponseWriter, r *http.Request) {
+	req := &executor.InvocationRequest{}
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	time.Sleep(ff.ExecutionTime)
+
+	resp := &executor.InvocationResult{Success: true, Result: "{}"}
+	if ff.Handler != nil {
+		resp = ff.Handler(req)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+func (ff *FakeFactory) getContainer(contID container.ContainerID) (*fakeContainer, error) {
+	ff.mu.Lock()
+	defer ff.mu.Unlock()
+	c, ok := ff.containers[contID]
+	if !ok {
+		return nil, fmt.Errorf("no such container: %s", contID)
+	}
+	return c, nil
+}
+
+// Count returns the number of containers currently alive.
+func (ff *FakeFactory) Count() int {
+	ff.mu.Lock()
+	defer ff.mu.Unlock()
+	return len(ff.containers)
+}
+
+func (ff *FakeFactory) Create(image string, opts *container.ContainerOptions) (container.ContainerID, error) {
+	ff.mu.Lock()
+	defer ff.mu.Unlock()
+	ff.nextID++
+	ff.Created++
+	contID := fmt.Sprintf("fake-%d", ff.nextID)
+	ff.containers[contID] = &fakeContainer{image: image, opts: *opts}
+	return contID, nil
+}
+
+func (ff *FakeFactory) CopyToContainer(contID container.ContainerID, content io.Reader, _ string) error {
+	if _, err := ff.getContainer(contID); err != nil {
+		return err
+	}
+	_, err := io.Copy(io.Discard, content)
+	return err
+}
+
+func (ff *FakeFactory) Start(contID container.ContainerID) error {
+	c, err := ff.getContainer(contID)
+	if err != nil {
+		return err
+	}
+	time.Sleep(ff.ColdStartLatency)
+	ff.mu.Lock()
+	c.started = true
+	ff.mu.Unlock()
+	return nil
+}
+
+func (ff *FakeFactory) Destroy(contID container.ContainerID) error {
+	ff.mu.Lock()
+	defer ff.mu.Unlock()
+	if _, ok := ff.containers[contID]; !ok {
+		return fmt.Errorf("no such container: %s", contID)
+	}
+	delete(ff.containers, contID)
+	ff.Destroyed++
+	return nil
+}
+
+func (ff *FakeFactory) HasImage(string) bool {
+	return true
+}
+
+func (ff *FakeFactory) PullImage(string) error {
+	return nil
+}
+
+func (ff *FakeFactory) GetExecutorAddress(contID container.ContainerID) (string, error) {
+	c, err := ff.getContainer(contID)
+	if err != nil {
+		return "", err
+	}
+	ff.mu.Lock()
+	defer ff.mu.Unlock()
+	if !c.started {
+		return "", fmt.Errorf("container %s not started", contID)
+	}
+	if c.paused {
+		return "", fmt.Errorf("container %s paused", contID)
+	}
+	return strings.TrimPrefix(ff.server.URL, "http://"), nil
+}
+
+func (ff *FakeFactory) GetMemoryMB(contID container.ContainerID) (int64, error) {
+	c, err := ff.getContainer(contID)
+	if err != nil {
+		return -1, err
+	}
+	return c.opts.MemoryMB, nil
+}
+
+// IsPaused returns true if the container is paused.
+func (ff *FakeFactory) IsPaused(contID container.ContainerID) bool {
+	ff.mu.Lock()
+	defer ff.mu.Unlock()
+	c, ok := ff.containers[contID]
+	return ok && c.paused
+}
+
+func (ff *FakeFactory) setPaused(contID container.ContainerID, paused bool) error {
+	c, err := ff.getContainer(contID)
+	if err != nil {
+		return err
+	}
+	ff.mu.Lock()
+	defer ff.mu.Unlock()
+	if !c.started || c.paused == paused {
+		return fmt.Errorf("invalid state of container %s", contID)
+	}
+	c.paused = paused
+	return nil
+}
+
+func (ff *FakeFactory) Pause(contID container.ContainerID) error {
+	return ff.setPaused(contID, true)
+}
+
+func (ff *FakeFactory) Unpause(contID container.ContainerID) error {
+	return ff.setPaused(contID, false)
+}
+
+func (ff *FakeFactory) Checkpoint(contID container.ContainerID, checkpointID string) error {
+	c, err := ff.getContainer(contID)
+	if err != nil {
+		return err
+	}
+	ff.mu.Lock()
+	defer ff.mu.Unlock()
+	if !c.started {
+		return fmt.Errorf("container %s not started", contID)
+	}
+	c.started = false
+	ff.checkpoints[checkpointID] = true
+	return nil
+}
+
+func (ff *FakeFactory) Restore(contID container.ContainerID, checkpointID string) error {
+	c, err := ff.getContainer(contID)
+	if err != nil {
+		return err
+	}
+	ff.mu.Lock()
+	if !ff.checkpoints[checkpointID] {
+		ff.mu.Unlock()
+		return fmt.Errorf("no such checkpoint: %s", checkpointID)
+	}
+	ff.mu.Unlock()
+	time.Sleep(ff.RestoreLatency)
+	ff.mu.Lock()
+	c.started = true
+	ff.Restored++
+	ff.mu.Unlock()
+	return nil
+}
+
+func (ff *FakeFactory) DeleteCheckpoint(_ container.ContainerID, checkpointID string) error {
+	ff.mu.Lock()
+	defer ff.mu.Unlock()
+	delete(ff.checkpoints, checkpointID)
+	return nil
+}
@@ -11,12 +11,14 @@ import (
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/client"
 	"github.com/grussorusso/serverledge/internal/config"
+	"github.com/grussorusso/serverledge/internal/executor"
 	//	"github.com/docker/docker/pkg/stdcopy"
 )
 
 type DockerFactory struct {
-	cli *client.Client
-	ctx context.Context
+	cli           *client.Client
+	ctx           context.Context
+	checkpointDir string
 }
 
 func InitDockerContainerFactory() *DockerFactory {
@@ -26,7 +28,8 @@ func InitDockerContainerFactory() *DockerFactory {
 		panic(err)
 	}
 
-	dockerFact := &DockerFactory{cli, ctx}
+	checkpointDir := config.GetString(config.FACTORY_DOCKER_CHECKPOINT_DIR, "/tmp/serverledge-checkpoints")
+	dockerFact := &DockerFactory{cli, ctx, checkpointDir}
 	cf = dockerFact
 	return dockerFact
 }
@@ -125,6 +128,14 @@ func (cf *DockerFactory) GetIPAddress(contID ContainerID) (string, error) {
 	return contJson.NetworkSettings.IPAddress, nil
 }
 
+func (cf *DockerFactory) GetExecutorAddress(contID ContainerID) (string, error) {
+	ipAddr, err := cf.GetIPAddress(contID)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s:%d", ipAddr, executor.DEFAULT_EXECUTOR_PORT), nil
+}
+
 func (cf *DockerFactory) GetMemoryMB(contID ContainerID) (int64, error) {
 	contJson, err := cf.cli.ContainerInspect(cf.ctx, contID)
 	if err != nil {
@@ -132,3 +143,35 @@ func (cf *DockerFactory) GetMemoryMB(contID ContainerID) (int64, error) {
 	}
 	return contJson.HostConfig.Memory / 1048576, nil
 }
+
+func (cf *DockerFactory) Pause(contID ContainerID) error {
+	return cf.cli.ContainerPause(cf.ctx, contID)
+}
+
+func (cf *DockerFactory) Unpause(contID ContainerID) error {
+	return cf.cli.ContainerUnpause(cf.ctx, contID)
+}
+
+// Checkpoint relies on the experimental checkpoint support of Docker (CRIU
+// must be installed on the host).
+func (cf *DockerFactory) Checkpoint(contID ContainerID, checkpointID string) error {
+	return cf.cli.CheckpointCreate(cf.ctx, contID, types.CheckpointCreateOptions{
+		CheckpointID:  checkpointID,
+		CheckpointDir: cf.checkpointDir,
+		Exit:          true,
+	})
+}
+
+func (cf *DockerFactory) Restore(contID ContainerID, checkpointID string) error {
+	return cf.cli.ContainerStart(cf.ctx, contID, types.ContainerStartOptions{
+		CheckpointID:  checkpointID,
+		CheckpointDir: cf.checkpointDir,
+	})
+}
+
+func (cf *DockerFactory) DeleteCheckpoint(contID ContainerID, checkpointID string) error {
+	return cf.cli.CheckpointDelete(cf.ctx, contID, types.CheckpointDeleteOptions{
+		CheckpointID:  checkpointID,
+		CheckpointDir: cf.checkpointDir,
+	})
+}
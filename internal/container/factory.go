@@ -1,7 +1,10 @@
 package container
 
 import (
+	"fmt"
 	"io"
+
+	"github.com/grussorusso/serverledge/internal/config"
 )
 
 // A Factory to create and manage container.
@@ -12,8 +15,22 @@ type Factory interface {
 	Destroy(ContainerID) error
 	HasImage(string) bool
 	PullImage(string) error
-	GetIPAddress(ContainerID) (string, error)
+	GetExecutorAddress(ContainerID) (string, error) // host:port of the Executor
 	GetMemoryMB(id ContainerID) (int64, error)
+	Pause(ContainerID) error   // freezes the processes of a running container
+	Unpause(ContainerID) error // resumes a paused container
+}
+
+// A Checkpointer is a Factory able to save the state of a running container
+// and to restore it into new containers, skipping their initialization.
+type Checkpointer interface {
+	// Checkpoint saves the state of a container with the given name, and
+	// stops the container.
+	Checkpoint(contID ContainerID, checkpointID string) error
+	// Restore starts a created container from a checkpoint.
+	Restore(contID ContainerID, checkpointID string) error
+	// DeleteCheckpoint removes a checkpoint of a container.
+	DeleteCheckpoint(contID ContainerID, checkpointID string) error
 }
 
 // ContainerOptions contains options for container creation.
@@ -29,6 +46,31 @@ type ContainerID = string
 // cf is the container factory for the node
 var cf Factory
 
+// Supported factory types
+const (
+	DOCKER_FACTORY  = "docker"
+	PROCESS_FACTORY = "process"
+)
+
+// InitContainerFactory initializes the container factory selected in the
+// configuration.
+func InitContainerFactory() (Factory, error) {
+	factoryType := config.GetString(config.FACTORY_TYPE, DOCKER_FACTORY)
+	switch factoryType {
+	case DOCKER_FACTORY:
+		return InitDockerContainerFactory(), nil
+	case PROCESS_FACTORY:
+		return InitProcessContainerFactory()
+	default:
+		return nil, fmt.Errorf("unknown container factory: %s", factoryType)
+	}
+}
+
+// SetFactory installs the given container factory for the node.
+func SetFactory(f Factory) {
+	cf = f
+}
+
 func DownloadImage(image string, forceRefresh bool) error {
 	if forceRefresh || !cf.HasImage(image) {
 		return cf.PullImage(image)
@@ -0,0 +1,254 @@
+package container
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/grussorusso/serverledge/internal/config"
+	"github.com/grussorusso/serverledge/internal/executor"
+	"github.com/grussorusso/serverledge/utils"
+)
+
+// ProcessFactory runs function instances as local processes, each one
+// executing its own copy of the Executor binary within a private directory.
+// Neither a container engine nor images are needed: the image of a custom
+// function is interpreted as the command to run (relative to the instance
+// directory). Memory and CPU limits are only used for bookkeeping.
+type ProcessFactory struct {
+	executorPath string
+	baseDir      string
+	mu           sync.Mutex
+	instances    map[ContainerID]*processInstance
+}
+
+type processInstance struct {
+	dir     string
+	port    int // known once started
+	command string
+	opts    ContainerOptions
+	cmd     *exec.Cmd
+}
+
+// max. time waited for an Executor to listen
+const processStartTimeout = 10 * time.Second
+
+// name of the file where the Executor writes its port
+const portFileName = "executor.port"
+
+// variables of the node environment passed to instances, which must not
+// see the rest of it (e.g., credentials)
+var processEnvAllowList = []string{"PATH", "LANG", "LC_ALL", "TZ"}
+
+func InitProcessContainerFactory() (*ProcessFactory, error) {
+	executorPath, err := exec.LookPath(config.GetString(config.FACTORY_PROCESS_EXECUTOR, "executor"))
+	if err != nil {
+		return nil, fmt.Errorf("could not find the executor binary: %v", err)
+	}
+	executorPath, err = filepath.Abs(executorPath)
+	if err != nil {
+		return nil, err
+	}
+
+	baseDir := config.GetString(config.FACTORY_PROCESS_DIR, filepath.Join(os.TempDir(), "serverledge"))
+	if err := os.MkdirAll(baseDir, 0755); err != nil {
+		return nil, fmt.Errorf("could not create directory for instances: %v", err)
+	}
+
+	processFact := &ProcessFactory{
+		executorPath: executorPath,
+		baseDir:      baseDir,
+		instances:    make(map[ContainerID]*processInstance),
+	}
+	cf = processFact
+	return processFact, nil
+}
+
+func (pf *ProcessFactory) getInstance(contID ContainerID) (*processInstance, error) {
+	pf.mu.Lock()
+	defer pf.mu.Unlock()
+	inst, ok := pf.instances[contID]
+	if !ok {
+		return nil, fmt.Errorf("no such instance: %s", contID)
+	}
+	return inst, nil
+}
+
+func (pf *ProcessFactory) Create(image string, opts *ContainerOptions) (ContainerID, error) {
+	for _, info := range RuntimeToInfo {
+		if info.Image == image {
+			return "", fmt.Errorf("runtime image %s is not supported by the process factory", image)
+		}
+	}
+
+	dir, err := os.MkdirTemp(pf.baseDir, "instance")
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "tmp"), 0755); err != nil {
+		return "", err
+	}
+
+	contID := filepath.Base(dir)
+	pf.mu.Lock()
+	pf.instances[contID] = &processInstance{dir: dir, command: image, opts: *opts}
+	pf.mu.Unlock()
+
+	log.Printf("Instance %s created in %s\n", contID, dir)
+	return contID, nil
+}
+
+func (pf *ProcessFactory) CopyToContainer(contID ContainerID, content io.Reader, destPath string) error {
+	inst, err := pf.getInstance(contID)
+	if err != nil {
+		return err
+	}
+	return utils.Untar(content, filepath.Join(inst.dir, destPath))
+}
+
+func (pf *ProcessFactory) Start(contID ContainerID) error {
+	inst, err := pf.getInstance(contID)
+	if err != nil {
+		return err
+	}
+
+	// the Executor listens on the loopback interface only, on a port chosen
+	// by the kernel, so that concurrent instances cannot race for the same port
+	portFile := filepath.Join(inst.dir, portFileName)
+	cmd := exec.Command(pf.executorPath)
+	cmd.Dir = inst.dir
+	for _, name := range processEnvAllowList {
+		if value, ok := os.LookupEnv(name); ok {
+			cmd.Env = append(cmd.Env, name+"="+value)
+		}
+	}
+	cmd.Env = append(cmd.Env, inst.opts.Env...)
+	cmd.Env = append(cmd.Env,
+		fmt.Sprintf("HOME=%s", inst.dir),
+		fmt.Sprintf("%s=127.0.0.1", executor.HOST_ENV_VAR),
+		fmt.Sprintf("%s=0", executor.PORT_ENV_VAR),
+		fmt.Sprintf("%s=%s", executor.PORT_FILE_ENV_VAR, portFile),
+		fmt.Sprintf("TMPDIR=%s", filepath.Join(inst.dir, "tmp")),
+		fmt.Sprintf("CUSTOM_CMD=%s", inst.command))
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	pf.mu.Lock()
+	inst.cmd = cmd
+	pf.mu.Unlock()
+
+	// reap the process on termination
+	exited := make(chan struct{})
+	go func() {
+		_ = cmd.Wait()
+		close(exited)
+	}()
+
+	port, err := waitForPort(portFile, exited)
+	if err != nil {
+		_ = cmd.Process.Kill()
+		return err
+	}
+	pf.mu.Lock()
+	inst.port = port
+	pf.mu.Unlock()
+	return nil
+}
+
+// waitForPort waits until the Executor writes the port it listens on.
+func waitForPort(portFile string, exited <-chan struct{}) (int, error) {
+	timeout := time.After(processStartTimeout)
+	for {
+		if content, err := os.ReadFile(portFile); err == nil {
+			return strconv.Atoi(string(content))
+		}
+		select {
+		case <-exited:
+			return 0, fmt.Errorf("executor terminated before listening")
+		case <-timeout:
+			return 0, fmt.Errorf("executor not listening after %v", processStartTimeout)
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+func (pf *ProcessFactory) Destroy(contID ContainerID) error {
+	pf.mu.Lock()
+	inst, ok := pf.instances[contID]
+	delete(pf.instances, contID)
+	pf.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("no such instance: %s", contID)
+	}
+
+	if inst.cmd != nil && inst.cmd.Process != nil {
+		if err := inst.cmd.Process.Kill(); err != nil {
+			log.Printf("Could not kill instance %s: %v\n", contID, err)
+		}
+	}
+	return os.RemoveAll(inst.dir)
+}
+
+func (pf *ProcessFactory) HasImage(string) bool {
+	// no images are needed
+	return true
+}
+
+func (pf *ProcessFactory) PullImage(string) error {
+	return nil
+}
+
+func (pf *ProcessFactory) GetExecutorAddress(contID ContainerID) (string, error) {
+	inst, err := pf.getInstance(contID)
+	if err != nil {
+		return "", err
+	}
+	pf.mu.Lock()
+	port := inst.port
+	pf.mu.Unlock()
+	if port == 0 {
+		return "", fmt.Errorf("instance %s not started", contID)
+	}
+	return net.JoinHostPort("127.0.0.1", strconv.Itoa(port)), nil
+}
+
+func (pf *ProcessFactory) GetMemoryMB(contID ContainerID) (int64, error) {
+	inst, err := pf.getInstance(contID)
+	if err != nil {
+		return -1, err
+	}
+	return inst.opts.MemoryMB, nil
+}
+
+// Pause stops the Executor process of an instance.
+func (pf *ProcessFactory) Pause(contID ContainerID) error {
+	return pf.signal(contID, syscall.SIGSTOP)
+}
+
+// Unpause resumes the Executor process of an instance.
+func (pf *ProcessFactory) Unpause(contID ContainerID) error {
+	return pf.signal(contID, syscall.SIGCONT)
+}
+
+func (pf *ProcessFactory) signal(contID ContainerID, sig os.Signal) error {
+	inst, err := pf.getInstance(contID)
+	if err != nil {
+		return err
+	}
+	pf.mu.Lock()
+	cmd := inst.cmd
+	pf.mu.Unlock()
+	if cmd == nil || cmd.Process == nil {
+		return fmt.Errorf("instance %s not started", contID)
+	}
+	return cmd.Process.Signal(sig)
+}
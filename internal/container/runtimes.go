@@ -2,8 +2,9 @@ package container
 
 // RuntimeInfo contains information about a supported function runtime env.
 type RuntimeInfo struct {
-	Image         string
-	InvocationCmd []string
+	Image                 string
+	InvocationCmd         []string
+	ConcurrentInvocations bool // true if the runtime can serve multiple requests at once
 }
 
 const CUSTOM_RUNTIME = "custom"
@@ -11,7 +12,17 @@ const CUSTOM_RUNTIME = "custom"
 var refreshedImages = map[string]bool{}
 
 var RuntimeToInfo = map[string]RuntimeInfo{
-	"python310":  {"grussorusso/serverledge-python310", []string{"python", "/entrypoint.py"}},
-	"nodejs17":   {"grussorusso/serverledge-nodejs17", []string{"node", "/entrypoint.js"}},
-	"nodejs17ng": {"grussorusso/serverledge-nodejs17ng", []string{}},
+	"python310":  {"grussorusso/serverledge-python310", []string{"python", "/entrypoint.py"}, false},
+	"nodejs17":   {"grussorusso/serverledge-nodejs17", []string{"node", "/entrypoint.js"}, false},
+	"nodejs17ng": {"grussorusso/serverledge-nodejs17ng", []string{}, true},
+}
+
+// SupportsConcurrency returns true if containers of the runtime can serve
+// multiple requests at once. Custom images are assumed to do so, as the
+// executor serves each request in a separate process.
+func SupportsConcurrency(runtime string) bool {
+	if runtime == CUSTOM_RUNTIME {
+		return true
+	}
+	return RuntimeToInfo[runtime].ConcurrentInvocations
 }
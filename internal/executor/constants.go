@@ -1,3 +1,14 @@
 package executor
 
 const DEFAULT_EXECUTOR_PORT = 8080
+
+// PORT_ENV_VAR can be used to make the executor listen on a non-default port
+const PORT_ENV_VAR = "EXECUTOR_PORT"
+
+// HOST_ENV_VAR can be used to make the executor listen on a single address
+// (e.g., 127.0.0.1), rather than on every interface
+const HOST_ENV_VAR = "EXECUTOR_HOST"
+
+// PORT_FILE_ENV_VAR can be used to make the executor write the port it
+// listens on to a file (e.g., when listening on a port chosen by the kernel)
+const PORT_FILE_ENV_VAR = "EXECUTOR_PORT_FILE"
@@ -1,6 +1,7 @@
 package executor
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"log"
@@ -8,10 +9,24 @@ import (
 	"os"
 	"os/exec"
 	"strings"
+	"time"
 )
 
-const resultFile = "/tmp/_executor_result.json"
-const paramsFile = "/tmp/_executor.params"
+// Files are placed in the temporary directory, which can be overridden
+// through $TMPDIR (e.g., when multiple executors share the same host).
+// Each request uses its own files, as requests may be served concurrently.
+const resultFilePattern = "_executor_result_*.json"
+const paramsFilePattern = "_executor_*.params"
+
+// createTempFile creates an empty file in the temporary directory, returning
+// its name.
+func createTempFile(pattern string) (string, error) {
+	f, err := os.CreateTemp("", pattern)
+	if err != nil {
+		return "", err
+	}
+	return f.Name(), f.Close()
+}
 
 func readExecutionResult(resultFile string) string {
 	content, err := os.ReadFile(resultFile)
@@ -33,27 +48,6 @@ func InvokeHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Set environment variables
-	err = os.Setenv("RESULT_FILE", resultFile)
-	err = errors.Join(err, os.Setenv("HANDLER", req.Handler))
-	err = errors.Join(err, os.Setenv("HANDLER_DIR", req.HandlerDir))
-	params := req.Params
-	if params == nil {
-		err = errors.Join(err, os.Setenv("PARAMS_FILE", ""))
-	} else {
-		paramsB, _ := json.Marshal(req.Params)
-		fileError := os.WriteFile(paramsFile, paramsB, 0644)
-		if fileError != nil {
-			log.Printf("Could not write parameters to %s\n", paramsFile)
-			http.Error(w, fileError.Error(), http.StatusInternalServerError)
-			return
-		}
-		err = errors.Join(err, os.Setenv("PARAMS_FILE", paramsFile))
-	}
-	if err != nil {
-		log.Printf("Error while setting environment variables: %s\n", err)
-	}
-
 	// Exec handler process
 	cmd := req.Command
 	if cmd == nil || len(cmd) < 1 {
@@ -62,30 +56,68 @@ func InvokeHandler(w http.ResponseWriter, r *http.Request) {
 		customCmd, ok := os.LookupEnv("CUSTOM_CMD")
 		if !ok {
 			log.Printf("Invalid request!\n")
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			http.Error(w, "missing command", http.StatusBadRequest)
 			return
 		}
 
 		cmd = strings.Split(customCmd, " ")
 	}
 
+	// Set environment variables of the handler process
+	resultFile, err := createTempFile(resultFilePattern)
+	if err != nil {
+		log.Printf("Could not create result file: %v\n", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer os.Remove(resultFile)
+	env := append(os.Environ(), "RESULT_FILE="+resultFile, "HANDLER="+req.Handler, "HANDLER_DIR="+req.HandlerDir)
+	if req.Params == nil {
+		env = append(env, "PARAMS_FILE=")
+	} else {
+		paramsFile, err := createTempFile(paramsFilePattern)
+		if err == nil {
+			defer os.Remove(paramsFile)
+			paramsB, _ := json.Marshal(req.Params)
+			err = os.WriteFile(paramsFile, paramsB, 0644)
+		}
+		if err != nil {
+			log.Printf("Could not write parameters: %v\n", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		env = append(env, "PARAMS_FILE="+paramsFile)
+	}
+
+	// the handler is killed upon timeout, or if the caller gives up
+	ctx := r.Context()
+	if req.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(req.Timeout*float64(time.Second)))
+		defer cancel()
+	}
+
 	var resp *InvocationResult
-	execCmd := exec.Command(cmd[0], cmd[1:]...)
+	execCmd := exec.CommandContext(ctx, cmd[0], cmd[1:]...)
+	execCmd.Env = env
+	// do not wait for orphaned children still holding the output pipes
+	execCmd.WaitDelay = 100 * time.Millisecond
 	out, err := execCmd.CombinedOutput()
 	if err != nil {
 		log.Printf("cmd.Run() failed with %s\n", err)
+		timedOut := errors.Is(ctx.Err(), context.DeadlineExceeded)
 		if req.ReturnOutput {
-			resp = &InvocationResult{Success: false, Output: string(out)}
+			resp = &InvocationResult{Success: false, Output: string(out), TimedOut: timedOut}
 		} else {
-			resp = &InvocationResult{Success: false, Output: ""}
+			resp = &InvocationResult{Success: false, Output: "", TimedOut: timedOut}
 		}
 	} else {
 		result := readExecutionResult(resultFile)
 
 		if req.ReturnOutput {
-			resp = &InvocationResult{true, result, string(out)}
+			resp = &InvocationResult{Success: true, Result: result, Output: string(out)}
 		} else {
-			resp = &InvocationResult{true, result, ""}
+			resp = &InvocationResult{Success: true, Result: result, Output: ""}
 		}
 	}
 
@@ -6,10 +6,13 @@ type InvocationRequest struct {
 	Handler      string
 	HandlerDir   string
 	ReturnOutput bool
+	Timeout      float64 // seconds (0 -> unbounded)
 }
 
 type InvocationResult struct {
 	Success bool
 	Result  string
 	Output  string
+	// TimedOut is true if the handler has been killed upon timeout
+	TimedOut bool
 }
@@ -0,0 +1,94 @@
+package function
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Descriptor describes a function, omitting its code.
+type Descriptor struct {
+	Name           string
+	Version        int64
+	Runtime        string
+	MemoryMB       int64
+	CPUDemand      float64
+	Handler        string
+	CustomImage    string
+	TimeoutSeconds float64
+	KeepAlive      float64
+	MaxConcurrency int
+	InputSchema    json.RawMessage `json:",omitempty"`
+	OutputSchema   json.RawMessage `json:",omitempty"`
+	Labels         map[string]string
+	Created        time.Time
+	CodeHash       string // SHA-256 of the code archive (empty without code)
+}
+
+// Describe returns the descriptor of the function.
+func (f *Function) Describe() *Descriptor {
+	return &Descriptor{
+		Name:           f.PlainName(),
+		Version:        f.Version,
+		Runtime:        f.Runtime,
+		MemoryMB:       f.MemoryMB,
+		CPUDemand:      f.CPUDemand,
+		Handler:        f.Handler,
+		CustomImage:    f.CustomImage,
+		TimeoutSeconds: f.TimeoutSeconds,
+		KeepAlive:      f.KeepAlive,
+		MaxConcurrency: f.MaxConcurrency,
+		InputSchema:    f.InputSchema,
+		OutputSchema:   f.OutputSchema,
+		Labels:         f.Labels,
+		Created:        f.Created,
+		CodeHash:       f.CodeHash(),
+	}
+}
+
+// CodeHash returns the SHA-256 of the code archive of the function, as a
+// hex string.
+func (f *Function) CodeHash() string {
+	if f.TarFunctionCode == "" {
+		return ""
+	}
+	code, err := base64.StdEncoding.DecodeString(f.TarFunctionCode)
+	if err != nil {
+		code = []byte(f.TarFunctionCode)
+	}
+	hash := sha256.Sum256(code)
+	return hex.EncodeToString(hash[:])
+}
+
+// ValidateLabels checks that the labels of the function can be matched
+// by selectors (see HasLabel).
+func (f *Function) ValidateLabels() error {
+	for key := range f.Labels {
+		if key == "" || strings.Contains(key, "=") {
+			return fmt.Errorf("invalid label '%s'", key)
+		}
+	}
+	return nil
+}
+
+// HasLabel checks whether the function matches a label selector, either
+// "key" or "key=value".
+func (f *Function) HasLabel(selector string) bool {
+	return hasLabel(f.Labels, selector)
+}
+
+// HasLabel checks whether the described function matches a label selector
+// (see Function.HasLabel).
+func (d *Descriptor) HasLabel(selector string) bool {
+	return hasLabel(d.Labels, selector)
+}
+
+func hasLabel(labels map[string]string, selector string) bool {
+	key, value, withValue := strings.Cut(selector, "=")
+	v, ok := labels[key]
+	return ok && (!withValue || v == value)
+}
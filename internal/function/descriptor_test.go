@@ -0,0 +1,31 @@
+package function
+
+import (
+	"encoding/base64"
+	"testing"
+)
+
+func TestDescribe(t *testing.T) {
+	f := &Function{Name: QualifiedName("team", "f"), Version: 2, Runtime: "python310",
+		TarFunctionCode: base64.StdEncoding.EncodeToString([]byte("abc")),
+		Labels:          map[string]string{"tier": "gold", "beta": ""}}
+
+	d := f.Describe()
+	if d.Name != "f" || d.Version != 2 || d.Runtime != "python310" {
+		t.Errorf("unexpected descriptor: %+v", d)
+	}
+	// SHA-256 of "abc"
+	if d.CodeHash != "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad" {
+		t.Errorf("unexpected code hash: %s", d.CodeHash)
+	}
+	if (&Function{}).CodeHash() != "" {
+		t.Errorf("expected no hash without code")
+	}
+
+	for selector, expected := range map[string]bool{"tier": true, "tier=gold": true, "tier=silver": false,
+		"beta": true, "beta=": true, "gamma": false} {
+		if f.HasLabel(selector) != expected || d.HasLabel(selector) != expected {
+			t.Errorf("%s: expected %v", selector, expected)
+		}
+	}
+}
@@ -2,7 +2,10 @@ package function
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/grussorusso/serverledge/internal/cache"
@@ -14,34 +17,141 @@ import (
 // Function describes a serverless function.
 type Function struct {
 	Name            string
-	Runtime         string  // example: python310
-	MemoryMB        int64   // MB
-	CPUDemand       float64 // 1.0 -> 1 core
-	Handler         string  // example: "module.function_name"
-	TarFunctionCode string  // input is .tar
-	CustomImage     string  // used if custom runtime is chosen
+	Version         int64           // assigned upon creation, starting from 1
+	Runtime         string          // example: python310
+	MemoryMB        int64           // MB
+	CPUDemand       float64         // 1.0 -> 1 core
+	Handler         string          // example: "module.function_name"
+	TarFunctionCode string          // input is .tar
+	CustomImage     string          // used if custom runtime is chosen
+	TimeoutSeconds  float64         // max. execution time (0 -> unbounded)
+	KeepAlive       float64         // seconds idle containers are kept warm (0 -> node policy)
+	MaxConcurrency  int             // max. requests served at once by each container (0 -> 1)
+	InputSchema     json.RawMessage `json:",omitempty"` // JSON Schema of the parameters (optional)
+	OutputSchema    json.RawMessage `json:",omitempty"` // JSON Schema of the result (optional)
+	Labels          map[string]string
+	Created         time.Time // creation time of the version
+
+	// compiled schemas, shared by the cached copies of the version
+	inputSchema  *Schema
+	outputSchema *Schema
 }
 
+// LATEST_ALIAS always refers to the most recent version of a function.
+const LATEST_ALIAS = "latest"
+
+const versionSeparator = ":"
+const aliasSeparator = "@"
+
+// Etcd prefixes
+const functionPrefix = "/function/"
+const versionsPrefix = "/versions/"
+const aliasesPrefix = "/aliases/"
+const retiredPrefix = "/retired/"
+const descriptorsPrefix = "/descriptors/"
+
+var AlreadyExistsErr = errors.New("function already exists")
+var NotFoundErr = errors.New("function not found")
+var ConflictErr = errors.New("concurrent modification of the function")
+
 func (f *Function) getEtcdKey() string {
 	return getEtcdKey(f.Name)
 }
 
+// getEtcdKey returns the key of the latest version of a function.
 func getEtcdKey(funcName string) string {
-	return fmt.Sprintf("/function/%s", funcName)
+	return functionPrefix + funcName
+}
+
+// getVersionsPrefix returns the prefix of the keys of all the versions of a function.
+// Separators cannot appear in names, so that the prefix does not match the
+// keys of functions in a namespace with the same name.
+func getVersionsPrefix(funcName string) string {
+	return versionsPrefix + funcName + versionSeparator
+}
+
+// getVersionEtcdKey returns the key of an (immutable) version of a function.
+func getVersionEtcdKey(funcName string, version int64) string {
+	return fmt.Sprintf("%s%d", getVersionsPrefix(funcName), version)
+}
+
+// getRetiredEtcdKey returns the key storing the oldest version of a function
+// that has not been retired.
+func getRetiredEtcdKey(funcName string) string {
+	return retiredPrefix + funcName
 }
 
-// GetFunction retrieves a Function given its name.
-func GetFunction(name string) (*Function, bool) {
+// getDescriptorEtcdKey returns the key of the descriptor of the latest version
+// of a function, which is listed without loading the code.
+func getDescriptorEtcdKey(funcName string) string {
+	return descriptorsPrefix + funcName
+}
+
+// getAliasEtcdKey returns the key of a named alias of a function.
+func getAliasEtcdKey(funcName string, alias string) string {
+	return aliasesPrefix + funcName + aliasSeparator + alias
+}
+
+// VersionedName returns the name of the function qualified with its version
+// (e.g., "func:2").
+func (f *Function) VersionedName() string {
+	if f.Version < 1 {
+		// function registered before the introduction of versioning
+		return f.Name
+	}
+	return fmt.Sprintf("%s%s%d", f.Name, versionSeparator, f.Version)
+}
 
-	val, found := getFromCache(name)
+// Concurrency returns the max. number of requests served at once by each
+// container of the function.
+func (f *Function) Concurrency() int {
+	if f.MaxConcurrency > 1 {
+		return f.MaxConcurrency
+	}
+	return 1
+}
+
+// ValidateName checks that a name can be used for a new function.
+func ValidateName(name string) error {
+	if len(name) < 1 {
+		return fmt.Errorf("empty function name")
+	}
+	if strings.ContainsAny(name, versionSeparator+aliasSeparator+"/") {
+		return fmt.Errorf("invalid function name: %s", name)
+	}
+	return nil
+}
+
+// ParseReference splits a function reference into name, version and alias.
+// Supported formats are "name", "name:version" and "name@alias".
+// For plain names, the "latest" alias is returned.
+func ParseReference(ref string) (name string, version int64, alias string, err error) {
+	if i := strings.Index(ref, aliasSeparator); i >= 0 {
+		return ref[:i], 0, ref[i+1:], nil
+	}
+	if i := strings.Index(ref, versionSeparator); i >= 0 {
+		version, err = strconv.ParseInt(ref[i+1:], 10, 64)
+		if err != nil || version < 1 {
+			return "", 0, "", fmt.Errorf("invalid version in reference: %s", ref)
+		}
+		return ref[:i], version, "", nil
+	}
+	return ref, 0, LATEST_ALIAS, nil
+}
+
+// GetFunction retrieves a Function given a reference to it, i.e., its name,
+// optionally followed by either ":version" or "@alias".
+func GetFunction(ref string) (*Function, bool) {
+
+	val, found := getFromCache(ref)
 	if !found {
 		// cache miss
-		f, response := getFromEtcd(name)
+		f, response := getFromEtcd(ref)
 		if !response {
 			return nil, false
 		}
 		//insert a new element to the cache
-		cache.GetCacheInstance().Set(name, f, cache.DefaultExp)
+		cache.GetCacheInstance().Set(ref, f, cache.DefaultExp)
 		return f, true
 	}
 
@@ -53,6 +163,14 @@ func (f *Function) String() string {
 	return f.Name
 }
 
+// evictFromCache removes every cached reference to a function.
+func evictFromCache(funcName string) {
+	cache.GetCacheInstance().DeleteFunc(func(ref string) bool {
+		name, _, _, _ := ParseReference(ref)
+		return name == funcName
+	})
+}
+
 func getFromCache(name string) (*Function, bool) {
 	localCache := cache.GetCacheInstance()
 	f, found := localCache.Get(name)
@@ -66,13 +184,35 @@ func getFromCache(name string) (*Function, bool) {
 
 }
 
-func getFromEtcd(name string) (*Function, bool) {
+func getFromEtcd(ref string) (*Function, bool) {
+	name, version, alias, err := ParseReference(ref)
+	if err != nil {
+		return nil, false
+	}
 	cli, err := utils.GetEtcdClient()
 	if err != nil {
 		return nil, false
 	}
 	ctx, _ := context.WithTimeout(context.Background(), 1*time.Second)
-	getResponse, err := cli.Get(ctx, getEtcdKey(name))
+
+	var key string
+	if alias == LATEST_ALIAS {
+		key = getEtcdKey(name)
+	} else if alias != "" {
+		aliasResponse, err := cli.Get(ctx, getAliasEtcdKey(name, alias))
+		if err != nil || len(aliasResponse.Kvs) < 1 {
+			return nil, false
+		}
+		version, err = strconv.ParseInt(string(aliasResponse.Kvs[0].Value), 10, 64)
+		if err != nil {
+			return nil, false
+		}
+		key = getVersionEtcdKey(name, version)
+	} else {
+		key = getVersionEtcdKey(name, version)
+	}
+
+	getResponse, err := cli.Get(ctx, key)
 	if err != nil || len(getResponse.Kvs) < 1 {
 		return nil, false
 	}
@@ -82,33 +222,297 @@ func getFromEtcd(name string) (*Function, bool) {
 	if err != nil {
 		return nil, false
 	}
+	f.compileSchemas()
 
 	return &f, true
 }
 
+// SaveToEtcd registers a new function, whose first version is stored.
 func (f *Function) SaveToEtcd() error {
+	f.Version = 1
+	return f.saveVersion(0, nil)
+}
+
+// getLatest retrieves the latest version of a function from Etcd, along with
+// the revision of its last modification.
+func getLatest(name string) (*Function, int64, error) {
+	cli, err := utils.GetEtcdClient()
+	if err != nil {
+		return nil, 0, err
+	}
+	ctx := context.TODO()
+
+	getResponse, err := cli.Get(ctx, getEtcdKey(name))
+	if err != nil {
+		return nil, 0, fmt.Errorf("Failed Get: %v", err)
+	}
+	if len(getResponse.Kvs) < 1 {
+		return nil, 0, NotFoundErr
+	}
+	var latest Function
+	if err = json.Unmarshal(getResponse.Kvs[0].Value, &latest); err != nil {
+		return nil, 0, fmt.Errorf("Could not unmarshal function: %v", err)
+	}
+
+	return &latest, getResponse.Kvs[0].ModRevision, nil
+}
+
+// getRetiredVersion retrieves the oldest version of a function that has not
+// been retired (0 if no version has been retired), along with the revision
+// of its last modification.
+func getRetiredVersion(name string) (int64, int64, error) {
+	cli, err := utils.GetEtcdClient()
+	if err != nil {
+		return 0, 0, err
+	}
+	ctx := context.TODO()
+
+	getResponse, err := cli.Get(ctx, getRetiredEtcdKey(name))
+	if err != nil {
+		return 0, 0, fmt.Errorf("Failed Get: %v", err)
+	}
+	if len(getResponse.Kvs) < 1 {
+		return 0, 0, nil
+	}
+	version, err := strconv.ParseInt(string(getResponse.Kvs[0].Value), 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("Invalid retired version: %v", err)
+	}
+	return version, getResponse.Kvs[0].ModRevision, nil
+}
+
+// PublishVersion stores f as a new version of an existing function, which
+// becomes the latest one.
+func (f *Function) PublishVersion() error {
+	latest, modRevision, err := getLatest(f.Name)
+	if err != nil {
+		return err
+	}
+
+	f.Version = latest.Version + 1
+	return f.saveVersion(modRevision, nil)
+}
+
+// ResettableFields are the fields that Update can reset to their default
+// value.
+var ResettableFields = []string{"TimeoutSeconds", "KeepAlive", "MaxConcurrency", "InputSchema",
+	"OutputSchema", "Labels"}
+
+// ValidateReset checks that the given fields can be reset by Update.
+func ValidateReset(fields []string) error {
+	for _, field := range fields {
+		found := false
+		for _, resettable := range ResettableFields {
+			found = found || field == resettable
+		}
+		if !found {
+			return fmt.Errorf("field '%s' cannot be reset", field)
+		}
+	}
+	return nil
+}
+
+// Update replaces the latest version of a function with a new one, obtained
+// by overriding the non-empty fields of f and resetting the given fields
+// (see ResettableFields). Differently from PublishVersion, previous versions
+// are retired: their warm containers are dismissed by every node. Versions
+// referred to by an alias (and the following ones) are not retired.
+// The oldest version that has not been retired is returned.
+func (f *Function) Update(reset []string) (int64, error) {
+	if err := ValidateReset(reset); err != nil {
+		return 0, err
+	}
+	latest, modRevision, err := getLatest(f.Name)
+	if err != nil {
+		return 0, err
+	}
+
+	updated := *latest
+	for _, field := range reset {
+		switch field {
+		case "TimeoutSeconds":
+			updated.TimeoutSeconds = 0.0
+		case "KeepAlive":
+			updated.KeepAlive = 0.0
+		case "MaxConcurrency":
+			updated.MaxConcurrency = 0
+		case "InputSchema":
+			updated.InputSchema = nil
+		case "OutputSchema":
+			updated.OutputSchema = nil
+		case "Labels":
+			updated.Labels = nil
+		}
+	}
+	if f.Runtime != "" {
+		updated.Runtime = f.Runtime
+	}
+	if f.MemoryMB > 0 {
+		updated.MemoryMB = f.MemoryMB
+	}
+	if f.CPUDemand != 0.0 {
+		updated.CPUDemand = f.CPUDemand
+	}
+	if f.Handler != "" {
+		updated.Handler = f.Handler
+	}
+	if f.TarFunctionCode != "" {
+		updated.TarFunctionCode = f.TarFunctionCode
+	}
+	if f.CustomImage != "" {
+		updated.CustomImage = f.CustomImage
+	}
+	if f.TimeoutSeconds > 0.0 {
+		updated.TimeoutSeconds = f.TimeoutSeconds
+	}
+	if f.KeepAlive > 0.0 {
+		updated.KeepAlive = f.KeepAlive
+	}
+	if f.MaxConcurrency > 0 {
+		updated.MaxConcurrency = f.MaxConcurrency
+	}
+	if len(f.InputSchema) > 0 {
+		updated.InputSchema = f.InputSchema
+	}
+	if len(f.OutputSchema) > 0 {
+		updated.OutputSchema = f.OutputSchema
+	}
+	if len(f.Labels) > 0 {
+		updated.Labels = f.Labels
+	}
+	updated.Version = latest.Version + 1
+
+	cli, err := utils.GetEtcdClient()
+	if err != nil {
+		return 0, err
+	}
+	ctx := context.TODO()
+
+	// versions referred to by aliases must not be retired
+	aliasPrefix := getAliasEtcdKey(f.Name, "")
+	aliasResponse, err := cli.Get(ctx, aliasPrefix, clientv3.WithPrefix())
+	if err != nil {
+		return 0, fmt.Errorf("Failed Get: %v", err)
+	}
+	minVersion := updated.Version
+	for _, kv := range aliasResponse.Kvs {
+		if version, err := strconv.ParseInt(string(kv.Value), 10, 64); err == nil {
+			minVersion = min(minVersion, version)
+		}
+	}
+	// retired versions cannot be restored
+	retired, _, err := getRetiredVersion(f.Name)
+	if err != nil {
+		return 0, err
+	}
+	minVersion = max(minVersion, retired)
+
+	// the update fails if aliases are concurrently modified
+	aliasesUnchanged := clientv3.Compare(clientv3.ModRevision(aliasPrefix), "<",
+		aliasResponse.Header.Revision+1).WithPrefix()
+	err = updated.saveVersion(modRevision, []clientv3.Cmp{aliasesUnchanged},
+		clientv3.OpPut(getRetiredEtcdKey(f.Name), strconv.FormatInt(minVersion, 10)))
+	if err != nil {
+		return 0, err
+	}
+
+	*f = updated
+	return minVersion, nil
+}
+
+// saveVersion atomically stores f as the latest version, provided that the
+// latest version has not been modified after modRevision (0 means that
+// the function must not exist). Additional conditions can be checked, and
+// additional operations executed, in the same transaction.
+func (f *Function) saveVersion(modRevision int64, cmps []clientv3.Cmp, ops ...clientv3.Op) error {
 	cli, err := utils.GetEtcdClient()
 	if err != nil {
 		return err
 	}
 	ctx := context.TODO()
 
+	f.Created = time.Now()
 	payload, err := json.Marshal(*f)
 	if err != nil {
 		return fmt.Errorf("Could not marshal function: %v", err)
 	}
-	_, err = cli.Put(ctx, f.getEtcdKey(), string(payload))
+
+	descriptor, err := json.Marshal(f.Describe())
+	if err != nil {
+		return fmt.Errorf("Could not marshal descriptor: %v", err)
+	}
+
+	ops = append(ops, clientv3.OpPut(f.getEtcdKey(), string(payload)),
+		clientv3.OpPut(getVersionEtcdKey(f.Name, f.Version), string(payload)),
+		clientv3.OpPut(getDescriptorEtcdKey(f.Name), string(descriptor)))
+	cmps = append(cmps, clientv3.Compare(clientv3.ModRevision(f.getEtcdKey()), "=", modRevision))
+	txnResp, err := cli.Txn(ctx).
+		If(cmps...).
+		Then(ops...).
+		Commit()
 	if err != nil {
 		return fmt.Errorf("Failed Put: %v", err)
 	}
+	if !txnResp.Succeeded {
+		if modRevision == 0 {
+			return AlreadyExistsErr
+		}
+		return ConflictErr
+	}
 
 	// Add the function to the local cache
+	f.compileSchemas()
 	cache.GetCacheInstance().Set(f.Name, f, cache.DefaultExp)
+	cache.GetCacheInstance().Set(f.VersionedName(), f, cache.DefaultExp)
 
 	return nil
 }
 
-// Delete removes a function from Etcd and the local cache.
+// SetAlias makes alias refer to the given version of the function.
+// Aliases cannot refer to retired versions (see Update).
+func SetAlias(name string, alias string, version int64) error {
+	if alias == LATEST_ALIAS {
+		return fmt.Errorf("alias '%s' is reserved", LATEST_ALIAS)
+	}
+	if err := ValidateName(alias); err != nil {
+		return fmt.Errorf("invalid alias: %s", alias)
+	}
+	if _, ok := GetFunction(fmt.Sprintf("%s%s%d", name, versionSeparator, version)); !ok {
+		return NotFoundErr
+	}
+	retired, modRevision, err := getRetiredVersion(name)
+	if err != nil {
+		return err
+	}
+	if version < retired {
+		return fmt.Errorf("version %d has been retired", version)
+	}
+
+	cli, err := utils.GetEtcdClient()
+	if err != nil {
+		return err
+	}
+	ctx := context.TODO()
+
+	// the alias is not set if versions are concurrently retired
+	txnResp, err := cli.Txn(ctx).
+		If(clientv3.Compare(clientv3.ModRevision(getRetiredEtcdKey(name)), "=", modRevision)).
+		Then(clientv3.OpPut(getAliasEtcdKey(name, alias), strconv.FormatInt(version, 10))).
+		Commit()
+	if err != nil {
+		return fmt.Errorf("Failed Put: %v", err)
+	}
+	if !txnResp.Succeeded {
+		return ConflictErr
+	}
+
+	cache.GetCacheInstance().Delete(name + aliasSeparator + alias)
+
+	return nil
+}
+
+// Delete removes a function (along with all its versions and aliases) from
+// Etcd and the local cache.
 func (f *Function) Delete() error {
 	cli, err := utils.GetEtcdClient()
 	if err != nil {
@@ -116,33 +520,91 @@ func (f *Function) Delete() error {
 	}
 	ctx := context.TODO()
 
-	dresp, err := cli.Delete(ctx, f.getEtcdKey())
-	if err != nil || dresp.Deleted != 1 {
+	txnResp, err := cli.Txn(ctx).
+		Then(clientv3.OpDelete(f.getEtcdKey()),
+			clientv3.OpDelete(getVersionsPrefix(f.Name), clientv3.WithPrefix()),
+			clientv3.OpDelete(getAliasEtcdKey(f.Name, ""), clientv3.WithPrefix()),
+			clientv3.OpDelete(getRetiredEtcdKey(f.Name)),
+			clientv3.OpDelete(getDescriptorEtcdKey(f.Name))).
+		Commit()
+	if err != nil || txnResp.Responses[0].GetResponseDeleteRange().Deleted != 1 {
 		return fmt.Errorf("Failed Delete: %v", err)
 	}
 
 	// Remove the function from the local cache
-	cache.GetCacheInstance().Delete(f.Name)
+	evictFromCache(f.Name)
 
 	return nil
 }
 
-func GetAll() ([]string, error) {
+// GetAll returns the (plain) names of the functions in a namespace.
+func GetAll(namespace string) ([]string, error) {
 	cli, err := utils.GetEtcdClient()
 	if err != nil {
 		return nil, err
 	}
 	ctx := context.TODO()
 
-	resp, err := cli.Get(ctx, "/function", clientv3.WithPrefix())
+	prefix := getEtcdKey(QualifiedName(namespace, ""))
+	resp, err := cli.Get(ctx, prefix, clientv3.WithPrefix(), clientv3.WithKeysOnly())
 	if err != nil {
 		return nil, err
 	}
 
-	functions := make([]string, len(resp.Kvs))
-	for i, s := range resp.Kvs {
-		functions[i] = string(s.Key)[len("/function/"):]
+	functions := make([]string, 0, len(resp.Kvs))
+	for _, s := range resp.Kvs {
+		name := string(s.Key)[len(prefix):]
+		if strings.Contains(name, namespaceSeparator) {
+			continue // function in a nested namespace
+		}
+		functions = append(functions, name)
 	}
 
 	return functions, nil
 }
+
+// GetAllDescriptors returns the descriptors of the latest version of the
+// functions in a namespace, sorted by name, without loading their code.
+func GetAllDescriptors(namespace string) ([]*Descriptor, error) {
+	cli, err := utils.GetEtcdClient()
+	if err != nil {
+		return nil, err
+	}
+	ctx := context.TODO()
+
+	names, err := GetAll(namespace)
+	if err != nil {
+		return nil, err
+	}
+	prefix := getDescriptorEtcdKey(QualifiedName(namespace, ""))
+	resp, err := cli.Get(ctx, prefix, clientv3.WithPrefix())
+	if err != nil {
+		return nil, err
+	}
+	stored := make(map[string]*Descriptor, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		var d Descriptor
+		if err = json.Unmarshal(kv.Value, &d); err != nil {
+			return nil, fmt.Errorf("Could not unmarshal descriptor: %v", err)
+		}
+		stored[string(kv.Key)[len(prefix):]] = &d
+	}
+
+	descriptors := make([]*Descriptor, 0, len(names))
+	for _, name := range names {
+		d, ok := stored[name]
+		if !ok {
+			// function saved before descriptors were stored
+			latest, _, err := getLatest(QualifiedName(namespace, name))
+			if errors.Is(err, NotFoundErr) {
+				continue // concurrently deleted
+			} else if err != nil {
+				return nil, err
+			}
+			d = latest.Describe()
+		}
+		descriptors = append(descriptors, d)
+	}
+
+	return descriptors, nil
+}
@@ -0,0 +1,74 @@
+package function
+
+import "testing"
+
+func TestParseReference(t *testing.T) {
+	tests := []struct {
+		ref     string
+		name    string
+		version int64
+		alias   string
+		invalid bool
+	}{
+		{"func", "func", 0, LATEST_ALIAS, false},
+		{"func:3", "func", 3, "", false},
+		{"func@stable", "func", 0, "stable", false},
+		{"func:0", "", 0, "", true},
+		{"func:abc", "", 0, "", true},
+	}
+
+	for _, tt := range tests {
+		name, version, alias, err := ParseReference(tt.ref)
+		if (err != nil) != tt.invalid {
+			t.Errorf("%s: unexpected error: %v", tt.ref, err)
+			continue
+		}
+		if name != tt.name || version != tt.version || alias != tt.alias {
+			t.Errorf("%s: got (%s, %d, %s)", tt.ref, name, version, alias)
+		}
+	}
+}
+
+func TestVersionedName(t *testing.T) {
+	f := Function{Name: "func", Version: 2}
+	if f.VersionedName() != "func:2" {
+		t.Errorf("unexpected versioned name: %s", f.VersionedName())
+	}
+	legacy := Function{Name: "func"}
+	if legacy.VersionedName() != "func" {
+		t.Errorf("unexpected versioned name: %s", legacy.VersionedName())
+	}
+}
+
+func TestQualifyReference(t *testing.T) {
+	tests := []struct {
+		namespace string
+		ref       string
+		qualified string
+		invalid   bool
+	}{
+		{DEFAULT_NAMESPACE, "func:2", "func:2", false},
+		{"ns", "func@stable", "ns/func@stable", false},
+		{"ns", "other/func", "", true},
+		{DEFAULT_NAMESPACE, "ns/func", "", true},
+	}
+
+	for _, tt := range tests {
+		qualified, err := QualifyReference(tt.namespace, tt.ref)
+		if (err != nil) != tt.invalid {
+			t.Errorf("%s: unexpected error: %v", tt.ref, err)
+			continue
+		}
+		if qualified != tt.qualified {
+			t.Errorf("%s: got %s", tt.ref, qualified)
+		}
+	}
+
+	f := Function{Name: QualifiedName("ns", "func"), Version: 2}
+	if f.Namespace() != "ns" || f.PlainName() != "func" {
+		t.Errorf("unexpected namespace and name: %s, %s", f.Namespace(), f.PlainName())
+	}
+	if namespace, ref := SplitName(f.VersionedName()); namespace != "ns" || ref != "func:2" {
+		t.Errorf("unexpected split: %s, %s", namespace, ref)
+	}
+}
@@ -0,0 +1,62 @@
+package function
+
+import "strings"
+
+// Functions belong to namespaces, which isolate the functions of different
+// tenants. Internally, a function is identified by its name qualified with
+// the namespace (e.g., "ns/func"), and the qualified name is used as Name.
+// Functions in the default namespace ("") are identified by their plain name.
+const namespaceSeparator = "/"
+
+// DEFAULT_NAMESPACE is the namespace of functions registered without specifying one.
+const DEFAULT_NAMESPACE = ""
+
+// QualifiedName returns the name that identifies a function in a namespace.
+func QualifiedName(namespace string, name string) string {
+	if namespace == DEFAULT_NAMESPACE {
+		return name
+	}
+	return namespace + namespaceSeparator + name
+}
+
+// SplitName splits a qualified name into namespace and plain name.
+func SplitName(qualifiedName string) (namespace string, name string) {
+	i := strings.LastIndex(qualifiedName, namespaceSeparator)
+	if i < 0 {
+		return DEFAULT_NAMESPACE, qualifiedName
+	}
+	return qualifiedName[:i], qualifiedName[i+1:]
+}
+
+// QualifyReference resolves a reference to a function (see GetFunction) in a
+// namespace. References to functions outside the namespace are rejected.
+func QualifyReference(namespace string, ref string) (string, error) {
+	name, _, _, err := ParseReference(ref)
+	if err != nil {
+		return "", err
+	}
+	if err = ValidateName(name); err != nil {
+		return "", err
+	}
+	return QualifiedName(namespace, ref), nil
+}
+
+// ValidateNamespace checks that a string can be used as a namespace.
+func ValidateNamespace(namespace string) error {
+	if namespace == DEFAULT_NAMESPACE {
+		return nil
+	}
+	return ValidateName(namespace)
+}
+
+// Namespace returns the namespace of the function.
+func (f *Function) Namespace() string {
+	namespace, _ := SplitName(f.Name)
+	return namespace
+}
+
+// PlainName returns the name of the function without its namespace.
+func (f *Function) PlainName() string {
+	_, name := SplitName(f.Name)
+	return name
+}
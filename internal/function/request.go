@@ -16,6 +16,9 @@ type Request struct {
 	CanDoOffloading bool
 	Async           bool
 	ReturnOutput    bool
+	CallbackURL     string
+	CallbackSecret  string
+	TimeoutSeconds  float64 // overrides the timeout of the function (if > 0)
 }
 
 type RequestQoS struct {
@@ -27,13 +30,22 @@ type ExecutionReport struct {
 	Result         string
 	ResponseTime   float64
 	IsWarmStart    bool
+	StartType      string // warm, cold or restored (see *_START)
 	InitTime       float64
 	OffloadLatency float64
+	QueueTime      float64 // time spent waiting in the scheduler queue
 	Duration       float64
 	SchedAction    string
 	Output         string
 }
 
+// Kinds of container starts
+const (
+	WARM_START     = "warm"
+	COLD_START     = "cold"
+	RESTORED_START = "restored" // restored from a snapshot (see node.SNAPSHOT_MODE)
+)
+
 type Response struct {
 	Success bool
 	ExecutionReport
@@ -47,6 +59,26 @@ func (r *Request) Id() string {
 	return r.Ctx.Value("ReqId").(string)
 }
 
+// Timeout returns the max. response time for the request, measured from its
+// arrival (0 -> unbounded). The timeout of the request may only shorten the
+// one of the function.
+func (r *Request) Timeout() time.Duration {
+	timeout := r.Fun.TimeoutSeconds
+	if r.TimeoutSeconds > 0 && (timeout <= 0 || r.TimeoutSeconds < timeout) {
+		timeout = r.TimeoutSeconds
+	}
+	return time.Duration(timeout * float64(time.Second))
+}
+
+// Deadline returns the time by which the request should be completed,
+// according to its MaxRespT. It returns false if there is no deadline.
+func (r *Request) Deadline() (time.Time, bool) {
+	if r.MaxRespT <= 0 {
+		return time.Time{}, false
+	}
+	return r.Arrival.Add(time.Duration(r.MaxRespT * float64(time.Second))), true
+}
+
 func (r *Request) String() string {
 	return fmt.Sprintf("[%s] Rq-%s", r.Fun.Name, r.Id())
 }
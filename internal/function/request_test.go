@@ -0,0 +1,27 @@
+package function
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRequestTimeout(t *testing.T) {
+	tests := []struct {
+		function float64
+		request  float64
+		expected time.Duration
+	}{
+		{0, 0, 0},
+		{10, 0, 10 * time.Second},
+		{0, 5, 5 * time.Second},
+		{10, 5, 5 * time.Second},
+		{10, 20, 10 * time.Second},
+	}
+
+	for _, tt := range tests {
+		r := &Request{Fun: &Function{TimeoutSeconds: tt.function}, TimeoutSeconds: tt.request}
+		if got := r.Timeout(); got != tt.expected {
+			t.Errorf("function %v, request %v: expected %v, got %v", tt.function, tt.request, tt.expected, got)
+		}
+	}
+}
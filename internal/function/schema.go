@@ -0,0 +1,499 @@
+package function
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"unicode/utf8"
+)
+
+var InvalidInputErr = errors.New("invalid input")
+var InvalidOutputErr = errors.New("invalid output")
+
+// Schema is a compiled JSON Schema. The following keywords are supported:
+// type, enum, const, properties, required, additionalProperties, items,
+// minItems, maxItems, minLength, maxLength, pattern, minimum, maximum,
+// exclusiveMinimum, exclusiveMaximum, allOf, anyOf, oneOf and not.
+// Annotations (e.g., title and description) are ignored, while references
+// and the other validation keywords (see unsupportedKeywords) are rejected.
+type Schema struct {
+	never            bool // the "false" schema
+	types            []string
+	enum             []interface{}
+	constant         *interface{}
+	properties       map[string]*Schema
+	required         []string
+	additional       *Schema
+	items            *Schema
+	minItems         *int
+	maxItems         *int
+	minLength        *int
+	maxLength        *int
+	pattern          *regexp.Regexp
+	minimum          *float64
+	maximum          *float64
+	exclusiveMinimum *float64
+	exclusiveMaximum *float64
+	allOf            []*Schema
+	anyOf            []*Schema
+	oneOf            []*Schema
+	not              *Schema
+}
+
+// unsupportedKeywords are the validation keywords (up to draft 2020-12) that
+// are not implemented: schemas using them are rejected rather than silently
+// accepting any value.
+var unsupportedKeywords = map[string]bool{"format": true, "multipleOf": true, "uniqueItems": true,
+	"contains": true, "minContains": true, "maxContains": true, "prefixItems": true,
+	"additionalItems": true, "unevaluatedItems": true, "minProperties": true, "maxProperties": true,
+	"patternProperties": true, "propertyNames": true, "dependencies": true, "dependentRequired": true,
+	"dependentSchemas": true, "unevaluatedProperties": true, "if": true, "then": true, "else": true}
+
+var jsonTypes = map[string]bool{"null": true, "boolean": true, "object": true, "array": true,
+	"number": true, "integer": true, "string": true}
+
+// ParseSchema compiles a JSON Schema.
+func ParseSchema(raw json.RawMessage) (*Schema, error) {
+	var v interface{}
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return nil, fmt.Errorf("invalid schema: %v", err)
+	}
+	s, err := compileSchema(v)
+	if err != nil {
+		return nil, fmt.Errorf("invalid schema: %v", err)
+	}
+	return s, nil
+}
+
+func compileSchema(v interface{}) (*Schema, error) {
+	if b, ok := v.(bool); ok {
+		return &Schema{never: !b}, nil
+	}
+	def, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("schemas must be objects or booleans")
+	}
+
+	s := &Schema{}
+	var err error
+	for keyword, value := range def {
+		switch keyword {
+		case "type":
+			switch t := value.(type) {
+			case string:
+				s.types = []string{t}
+			case []interface{}:
+				for _, item := range t {
+					name, _ := item.(string)
+					s.types = append(s.types, name)
+				}
+			}
+			if len(s.types) == 0 {
+				return nil, fmt.Errorf("invalid type")
+			}
+			for _, t := range s.types {
+				if !jsonTypes[t] {
+					return nil, fmt.Errorf("unknown type '%s'", t)
+				}
+			}
+		case "enum":
+			if s.enum, ok = value.([]interface{}); !ok {
+				return nil, fmt.Errorf("enum must be an array")
+			}
+		case "const":
+			s.constant = &value
+		case "properties":
+			props, ok := value.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("properties must be an object")
+			}
+			s.properties = make(map[string]*Schema, len(props))
+			for name, prop := range props {
+				if s.properties[name], err = compileSchema(prop); err != nil {
+					return nil, fmt.Errorf("property '%s': %v", name, err)
+				}
+			}
+		case "required":
+			list, ok := value.([]interface{})
+			if !ok {
+				return nil, fmt.Errorf("required must be an array")
+			}
+			for _, item := range list {
+				name, ok := item.(string)
+				if !ok {
+					return nil, fmt.Errorf("required must contain strings")
+				}
+				s.required = append(s.required, name)
+			}
+		case "additionalProperties":
+			if s.additional, err = compileSchema(value); err != nil {
+				return nil, fmt.Errorf("additionalProperties: %v", err)
+			}
+		case "items":
+			if s.items, err = compileSchema(value); err != nil {
+				return nil, fmt.Errorf("items: %v", err)
+			}
+		case "minItems", "maxItems", "minLength", "maxLength":
+			n, ok := value.(float64)
+			if !ok || n < 0 || n != math.Trunc(n) {
+				return nil, fmt.Errorf("%s must be a non-negative integer", keyword)
+			}
+			limit := int(n)
+			switch keyword {
+			case "minItems":
+				s.minItems = &limit
+			case "maxItems":
+				s.maxItems = &limit
+			case "minLength":
+				s.minLength = &limit
+			default:
+				s.maxLength = &limit
+			}
+		case "minimum", "maximum", "exclusiveMinimum", "exclusiveMaximum":
+			n, ok := value.(float64)
+			if !ok {
+				return nil, fmt.Errorf("%s must be a number", keyword)
+			}
+			switch keyword {
+			case "minimum":
+				s.minimum = &n
+			case "maximum":
+				s.maximum = &n
+			case "exclusiveMinimum":
+				s.exclusiveMinimum = &n
+			default:
+				s.exclusiveMaximum = &n
+			}
+		case "pattern":
+			expr, ok := value.(string)
+			if !ok {
+				return nil, fmt.Errorf("pattern must be a string")
+			}
+			if s.pattern, err = regexp.Compile(expr); err != nil {
+				return nil, fmt.Errorf("invalid pattern: %v", err)
+			}
+		case "allOf", "anyOf", "oneOf":
+			list, ok := value.([]interface{})
+			if !ok || len(list) == 0 {
+				return nil, fmt.Errorf("%s must be a non-empty array", keyword)
+			}
+			schemas := make([]*Schema, 0, len(list))
+			for _, item := range list {
+				sub, err := compileSchema(item)
+				if err != nil {
+					return nil, fmt.Errorf("%s: %v", keyword, err)
+				}
+				schemas = append(schemas, sub)
+			}
+			switch keyword {
+			case "allOf":
+				s.allOf = schemas
+			case "anyOf":
+				s.anyOf = schemas
+			default:
+				s.oneOf = schemas
+			}
+		case "not":
+			if s.not, err = compileSchema(value); err != nil {
+				return nil, fmt.Errorf("not: %v", err)
+			}
+		case "$ref", "$dynamicRef", "$recursiveRef":
+			return nil, fmt.Errorf("references are not supported")
+		default:
+			if unsupportedKeywords[keyword] {
+				return nil, fmt.Errorf("keyword '%s' is not supported", keyword)
+			}
+		}
+	}
+	return s, nil
+}
+
+// Validate checks that a value (decoded from JSON) satisfies the schema.
+func (s *Schema) Validate(v interface{}) error {
+	return s.validate(v, "")
+}
+
+func (s *Schema) validate(v interface{}, path string) error {
+	fail := func(format string, args ...interface{}) error {
+		if path == "" {
+			return fmt.Errorf(format, args...)
+		}
+		return fmt.Errorf("%s: %s", path, fmt.Sprintf(format, args...))
+	}
+
+	if s.never {
+		return fail("no value allowed")
+	}
+	if len(s.types) > 0 && !s.matchesType(v) {
+		return fail("expected %v, got %s", typeNames(s.types), jsonType(v))
+	}
+	if s.enum != nil && !containsValue(s.enum, v) {
+		return fail("value not allowed")
+	}
+	if s.constant != nil && !reflect.DeepEqual(*s.constant, v) {
+		return fail("value not allowed")
+	}
+
+	switch value := v.(type) {
+	case map[string]interface{}:
+		for _, name := range s.required {
+			if _, ok := value[name]; !ok {
+				return fail("missing property '%s'", name)
+			}
+		}
+		// sorted, for deterministic errors
+		names := make([]string, 0, len(value))
+		for name := range value {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			prop, ok := s.properties[name]
+			if !ok {
+				prop = s.additional
+			}
+			if prop == nil {
+				continue
+			}
+			if err := prop.validate(value[name], joinPath(path, name)); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		if s.minItems != nil && len(value) < *s.minItems {
+			return fail("expected at least %d items", *s.minItems)
+		}
+		if s.maxItems != nil && len(value) > *s.maxItems {
+			return fail("expected at most %d items", *s.maxItems)
+		}
+		if s.items != nil {
+			for i, item := range value {
+				if err := s.items.validate(item, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+					return err
+				}
+			}
+		}
+	case string:
+		length := utf8.RuneCountInString(value)
+		if s.minLength != nil && length < *s.minLength {
+			return fail("expected at least %d characters", *s.minLength)
+		}
+		if s.maxLength != nil && length > *s.maxLength {
+			return fail("expected at most %d characters", *s.maxLength)
+		}
+		if s.pattern != nil && !s.pattern.MatchString(value) {
+			return fail("does not match '%s'", s.pattern)
+		}
+	case float64:
+		if s.minimum != nil && value < *s.minimum {
+			return fail("expected a value >= %v", *s.minimum)
+		}
+		if s.maximum != nil && value > *s.maximum {
+			return fail("expected a value <= %v", *s.maximum)
+		}
+		if s.exclusiveMinimum != nil && value <= *s.exclusiveMinimum {
+			return fail("expected a value > %v", *s.exclusiveMinimum)
+		}
+		if s.exclusiveMaximum != nil && value >= *s.exclusiveMaximum {
+			return fail("expected a value < %v", *s.exclusiveMaximum)
+		}
+	}
+
+	for _, sub := range s.allOf {
+		if err := sub.validate(v, path); err != nil {
+			return err
+		}
+	}
+	if s.anyOf != nil && countMatches(s.anyOf, v) == 0 {
+		return fail("no alternative of anyOf matches")
+	}
+	if s.oneOf != nil && countMatches(s.oneOf, v) != 1 {
+		return fail("exactly one alternative of oneOf must match")
+	}
+	if s.not != nil && s.not.validate(v, path) == nil {
+		return fail("value not allowed")
+	}
+	return nil
+}
+
+func (s *Schema) matchesType(v interface{}) bool {
+	t := jsonType(v)
+	for _, allowed := range s.types {
+		if allowed == t || (allowed == "number" && t == "integer") {
+			return true
+		}
+	}
+	return false
+}
+
+// jsonType returns the JSON type of a decoded value ("integer" for
+// numbers without a fractional part).
+func jsonType(v interface{}) string {
+	switch value := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	case string:
+		return "string"
+	case float64:
+		if value == math.Trunc(value) {
+			return "integer"
+		}
+		return "number"
+	default:
+		return fmt.Sprintf("%T", v)
+	}
+}
+
+func typeNames(types []string) string {
+	if len(types) == 1 {
+		return types[0]
+	}
+	return fmt.Sprintf("one of %v", types)
+}
+
+func containsValue(values []interface{}, v interface{}) bool {
+	for _, allowed := range values {
+		if reflect.DeepEqual(allowed, v) {
+			return true
+		}
+	}
+	return false
+}
+
+func countMatches(schemas []*Schema, v interface{}) int {
+	n := 0
+	for _, s := range schemas {
+		if s.validate(v, "") == nil {
+			n++
+		}
+	}
+	return n
+}
+
+func joinPath(path string, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+// ValidateSchemas checks that the input and output schemas of the function
+// (if any) are valid.
+func (f *Function) ValidateSchemas() error {
+	if len(f.InputSchema) > 0 {
+		if _, err := ParseSchema(f.InputSchema); err != nil {
+			return fmt.Errorf("input: %v", err)
+		}
+	}
+	if len(f.OutputSchema) > 0 {
+		if _, err := ParseSchema(f.OutputSchema); err != nil {
+			return fmt.Errorf("output: %v", err)
+		}
+	}
+	return nil
+}
+
+// compileSchemas compiles the schemas of a version once, as versions are
+// immutable. Invalid schemas (rejected upon creation) are compiled again,
+// and fail, upon validation.
+func (f *Function) compileSchemas() {
+	if len(f.InputSchema) > 0 {
+		f.inputSchema, _ = ParseSchema(f.InputSchema)
+	}
+	if len(f.OutputSchema) > 0 {
+		f.outputSchema, _ = ParseSchema(f.OutputSchema)
+	}
+}
+
+// getSchema returns a compiled schema, compiling its definition if needed.
+func getSchema(compiled *Schema, raw json.RawMessage) (*Schema, error) {
+	if compiled != nil {
+		return compiled, nil
+	}
+	return ParseSchema(raw)
+}
+
+// isDecodedJSON tells whether a value only consists of the types obtained by
+// decoding JSON, which holds for the parameters of API requests.
+func isDecodedJSON(v interface{}) bool {
+	switch value := v.(type) {
+	case nil, bool, string, float64:
+		return true
+	case map[string]interface{}:
+		for _, item := range value {
+			if !isDecodedJSON(item) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		for _, item := range value {
+			if !isDecodedJSON(item) {
+				return false
+			}
+		}
+		return true
+	default:
+		return false
+	}
+}
+
+// ValidateParams checks the parameters of an invocation against the input
+// schema of the function (if any).
+func (f *Function) ValidateParams(params map[string]interface{}) error {
+	if len(f.InputSchema) == 0 {
+		return nil
+	}
+	s, err := getSchema(f.inputSchema, f.InputSchema)
+	if err != nil {
+		return err
+	}
+	var v interface{} = params
+	if params == nil {
+		v = map[string]interface{}{}
+	} else if !isDecodedJSON(v) {
+		// parameters may have been built in Go (e.g., by triggers)
+		encoded, err := json.Marshal(params)
+		if err != nil {
+			return fmt.Errorf("%w: %v", InvalidInputErr, err)
+		}
+		if err = json.Unmarshal(encoded, &v); err != nil {
+			return fmt.Errorf("%w: %v", InvalidInputErr, err)
+		}
+	}
+	if err = s.Validate(v); err != nil {
+		return fmt.Errorf("%w: %v", InvalidInputErr, err)
+	}
+	return nil
+}
+
+// ValidateResult checks the result of an invocation against the output
+// schema of the function (if any). Results that are not valid JSON are
+// treated as strings.
+func (f *Function) ValidateResult(result string) error {
+	if len(f.OutputSchema) == 0 {
+		return nil
+	}
+	s, err := getSchema(f.outputSchema, f.OutputSchema)
+	if err != nil {
+		return err
+	}
+	var v interface{}
+	if err = json.Unmarshal([]byte(result), &v); err != nil {
+		v = result
+	}
+	if err = s.Validate(v); err != nil {
+		return fmt.Errorf("%w: %v", InvalidOutputErr, err)
+	}
+	return nil
+}
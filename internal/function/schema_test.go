@@ -0,0 +1,101 @@
+package function
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestSchemaValidation(t *testing.T) {
+	schema, err := ParseSchema(json.RawMessage(`{
+		"type": "object",
+		"required": ["n", "mode"],
+		"properties": {
+			"n": {"type": "integer", "minimum": 1},
+			"mode": {"enum": ["fast", "exact"]},
+			"tags": {"type": "array", "items": {"type": "string", "pattern": "^[a-z]+$"}, "maxItems": 2},
+			"ratio": {"anyOf": [{"type": "null"}, {"type": "number", "exclusiveMaximum": 1}]}
+		},
+		"additionalProperties": false
+	}`))
+	if err != nil {
+		t.Fatalf("could not parse schema: %v", err)
+	}
+
+	tests := []struct {
+		value string
+		valid bool
+	}{
+		{`{"n": 3, "mode": "fast"}`, true},
+		{`{"n": 3, "mode": "exact", "tags": ["a", "b"], "ratio": 0.5}`, true},
+		{`{"n": 3, "mode": "fast", "ratio": null}`, true},
+		{`{"n": 3}`, false},
+		{`{"n": 0, "mode": "fast"}`, false},
+		{`{"n": 2.5, "mode": "fast"}`, false},
+		{`{"n": 3, "mode": "slow"}`, false},
+		{`{"n": 3, "mode": "fast", "tags": ["A"]}`, false},
+		{`{"n": 3, "mode": "fast", "tags": ["a", "b", "c"]}`, false},
+		{`{"n": 3, "mode": "fast", "ratio": 1}`, false},
+		{`{"n": 3, "mode": "fast", "other": true}`, false},
+		{`[1, 2]`, false},
+	}
+	for _, tt := range tests {
+		var v interface{}
+		if err := json.Unmarshal([]byte(tt.value), &v); err != nil {
+			t.Fatalf("invalid test value: %s", tt.value)
+		}
+		if err := schema.Validate(v); (err == nil) != tt.valid {
+			t.Errorf("%s: expected valid=%v, got error %v", tt.value, tt.valid, err)
+		}
+	}
+}
+
+func TestParseSchemaErrors(t *testing.T) {
+	for _, s := range []string{`[]`, `{"type": "float"}`, `{"minLength": -1}`, `{"pattern": "("}`,
+		`{"$ref": "#/definitions/x"}`, `{"properties": {"a": 1}}`, `{"type": "string", "format": "email"}`,
+		`{"items": {"uniqueItems": true}}`, `{"properties": {"a": {"minProperties": 1}}}`,
+		`{"patternProperties": {"^x": {}}}`, `{"dependentRequired": {"a": ["b"]}}`} {
+		if _, err := ParseSchema(json.RawMessage(s)); err == nil {
+			t.Errorf("%s: expected an error", s)
+		}
+	}
+}
+
+func TestValidateParamsAndResult(t *testing.T) {
+	f := &Function{Name: "f",
+		InputSchema:  json.RawMessage(`{"type": "object", "required": ["x"]}`),
+		OutputSchema: json.RawMessage(`{"type": "string"}`)}
+
+	if err := f.ValidateParams(map[string]interface{}{"x": 1}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := f.ValidateParams(nil); !errors.Is(err, InvalidInputErr) {
+		t.Errorf("expected invalid input, got %v", err)
+	}
+	// results that are not JSON are treated as strings
+	if err := f.ValidateResult("hello"); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := f.ValidateResult(`{"y": 1}`); !errors.Is(err, InvalidOutputErr) {
+		t.Errorf("expected invalid output, got %v", err)
+	}
+	if err := (&Function{}).ValidateParams(nil); err != nil {
+		t.Errorf("unexpected error without schema: %v", err)
+	}
+
+	// schemas of cached versions are compiled once
+	f.compileSchemas()
+	if f.inputSchema == nil || f.outputSchema == nil {
+		t.Fatalf("schemas not compiled")
+	}
+	copied := *f
+	if copied.inputSchema != f.inputSchema {
+		t.Errorf("compiled schema not shared by copies")
+	}
+	if err := copied.ValidateParams(map[string]interface{}{"x": []string{"a"}}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := copied.ValidateParams(map[string]interface{}{"y": 1.0}); !errors.Is(err, InvalidInputErr) {
+		t.Errorf("expected invalid input, got %v", err)
+	}
+}
@@ -0,0 +1,216 @@
+package function
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/grussorusso/serverledge/internal/cache"
+	"github.com/grussorusso/serverledge/utils"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// ChangeHandlers are notified of the changes to functions made by any node.
+type ChangeHandlers struct {
+	// OnDelete is called when a function is deleted
+	OnDelete func(funcName string)
+	// OnRetire is called when the versions of a function preceding
+	// minVersion are retired (see Update)
+	OnRetire func(funcName string, minVersion int64)
+	// Known returns the functions with local state, which are reconciled
+	// with the registry if some changes are missed (optional)
+	Known func() []string
+}
+
+// watchRevisions are the last revisions seen by the watches of the function
+// registry, from which the watches are resumed after a failure.
+type watchRevisions struct {
+	functions int64
+	aliases   int64
+	retired   int64
+}
+
+// WatchChanges keeps the local cache consistent with the function registry in
+// Etcd, evicting entries as soon as functions (or their aliases) change,
+// and notifies the given handlers.
+// Watches are resumed after failures, so that no change is missed. If the
+// changes have been compacted meanwhile, the registry is read again and
+// reconciled with the functions known by handlers.
+// It blocks until ctx is canceled.
+func WatchChanges(ctx context.Context, handlers ChangeHandlers) error {
+	var revs watchRevisions
+	for ctx.Err() == nil {
+		err := watchChanges(ctx, handlers, &revs)
+		if ctx.Err() != nil {
+			break
+		}
+		log.Printf("Watching function changes failed: %v\n", err)
+
+		if errors.Is(err, rpctypes.ErrCompacted) {
+			// some events have been lost
+			cache.GetCacheInstance().DeleteFunc(func(string) bool { return true })
+			rev, err := resync(ctx, handlers)
+			if err != nil {
+				// retried, as resuming the watches fails again
+				log.Printf("Could not reconcile function changes: %v\n", err)
+			} else {
+				revs = watchRevisions{functions: rev, aliases: rev, retired: rev}
+			}
+		}
+		time.Sleep(1 * time.Second)
+	}
+
+	return ctx.Err()
+}
+
+func watchChanges(ctx context.Context, handlers ChangeHandlers, revs *watchRevisions) error {
+	cli, err := utils.GetEtcdClient()
+	if err != nil {
+		return err
+	}
+
+	if revs.functions == 0 {
+		// changes are watched from the current revision
+		getCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		resp, err := cli.Get(getCtx, functionPrefix, clientv3.WithPrefix(), clientv3.WithCountOnly())
+		cancel()
+		if err != nil {
+			return err
+		}
+		rev := resp.Header.Revision
+		*revs = watchRevisions{functions: rev, aliases: rev, retired: rev}
+	}
+
+	watchCtx, cancel := context.WithCancel(clientv3.WithRequireLeader(ctx))
+	defer cancel()
+	functionChan := cli.Watch(watchCtx, functionPrefix, clientv3.WithPrefix(), clientv3.WithRev(revs.functions+1))
+	aliasesChan := cli.Watch(watchCtx, aliasesPrefix, clientv3.WithPrefix(), clientv3.WithRev(revs.aliases+1))
+	retiredChan := cli.Watch(watchCtx, retiredPrefix, clientv3.WithPrefix(), clientv3.WithRev(revs.retired+1))
+
+	for {
+		var watchResp clientv3.WatchResponse
+		var ok bool
+		select {
+		case watchResp, ok = <-functionChan:
+			if ok && watchResp.Err() == nil {
+				handleFunctionEvents(watchResp.Events, handlers)
+				revs.functions = lastRevision(watchResp.Events, revs.functions)
+			}
+		case watchResp, ok = <-aliasesChan:
+			if ok && watchResp.Err() == nil {
+				handleAliasEvents(watchResp.Events)
+				revs.aliases = lastRevision(watchResp.Events, revs.aliases)
+			}
+		case watchResp, ok = <-retiredChan:
+			if ok && watchResp.Err() == nil {
+				handleRetiredEvents(watchResp.Events, handlers)
+				revs.retired = lastRevision(watchResp.Events, revs.retired)
+			}
+		}
+
+		if !ok {
+			return ctx.Err()
+		}
+		if err := watchResp.Err(); err != nil {
+			return err
+		}
+	}
+}
+
+// lastRevision returns the revision of the last event (if any).
+func lastRevision(events []*clientv3.Event, rev int64) int64 {
+	for _, event := range events {
+		rev = max(rev, event.Kv.ModRevision)
+	}
+	return rev
+}
+
+// resync reads the functions and the retired versions from Etcd, and
+// reconciles them with the functions known by handlers. The revision read
+// is returned.
+func resync(ctx context.Context, handlers ChangeHandlers) (int64, error) {
+	cli, err := utils.GetEtcdClient()
+	if err != nil {
+		return 0, err
+	}
+	getCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	functionsResp, err := cli.Get(getCtx, functionPrefix, clientv3.WithPrefix(), clientv3.WithKeysOnly())
+	if err != nil {
+		return 0, err
+	}
+	rev := functionsResp.Header.Revision
+	retiredResp, err := cli.Get(getCtx, retiredPrefix, clientv3.WithPrefix(), clientv3.WithRev(rev))
+	if err != nil {
+		return 0, err
+	}
+
+	existing := make(map[string]bool, len(functionsResp.Kvs))
+	for _, kv := range functionsResp.Kvs {
+		existing[string(kv.Key)[len(functionPrefix):]] = true
+	}
+	reconcile(existing, retiredResp.Kvs, handlers)
+	return rev, nil
+}
+
+// reconcile notifies handlers of the deletion of the known functions that do
+// not exist anymore, and of the retired versions of the existing ones.
+func reconcile(existing map[string]bool, retired []*mvccpb.KeyValue, handlers ChangeHandlers) {
+	if handlers.Known != nil && handlers.OnDelete != nil {
+		for _, name := range handlers.Known() {
+			if !existing[name] {
+				handlers.OnDelete(name)
+			}
+		}
+	}
+	events := make([]*clientv3.Event, 0, len(retired))
+	for _, kv := range retired {
+		if existing[string(kv.Key)[len(retiredPrefix):]] {
+			events = append(events, &clientv3.Event{Type: clientv3.EventTypePut, Kv: kv})
+		}
+	}
+	handleRetiredEvents(events, handlers)
+}
+
+func handleFunctionEvents(events []*clientv3.Event, handlers ChangeHandlers) {
+	for _, event := range events {
+		name := string(event.Kv.Key)[len(functionPrefix):]
+		if event.Type == clientv3.EventTypeDelete {
+			evictFromCache(name)
+			if handlers.OnDelete != nil {
+				handlers.OnDelete(name)
+			}
+		} else {
+			// the cached latest version is stale
+			cache.GetCacheInstance().Delete(name)
+		}
+	}
+}
+
+func handleAliasEvents(events []*clientv3.Event) {
+	for _, event := range events {
+		// keys have the form <prefix><name>@<alias>, i.e., the cached reference
+		cache.GetCacheInstance().Delete(string(event.Kv.Key)[len(aliasesPrefix):])
+	}
+}
+
+func handleRetiredEvents(events []*clientv3.Event, handlers ChangeHandlers) {
+	for _, event := range events {
+		if event.Type != clientv3.EventTypePut {
+			continue
+		}
+		name := string(event.Kv.Key)[len(retiredPrefix):]
+		minVersion, err := strconv.ParseInt(string(event.Kv.Value), 10, 64)
+		if err != nil {
+			continue
+		}
+		if handlers.OnRetire != nil {
+			handlers.OnRetire(name, minVersion)
+		}
+	}
+}
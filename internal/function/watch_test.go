@@ -0,0 +1,31 @@
+package function
+
+import (
+	"testing"
+
+	"go.etcd.io/etcd/api/v3/mvccpb"
+)
+
+func TestReconcile(t *testing.T) {
+	var deleted []string
+	retired := make(map[string]int64)
+	handlers := ChangeHandlers{
+		OnDelete: func(funcName string) { deleted = append(deleted, funcName) },
+		OnRetire: func(funcName string, minVersion int64) { retired[funcName] = minVersion },
+		Known:    func() []string { return []string{"f", "gone", "ns/g"} },
+	}
+
+	existing := map[string]bool{"f": true, "ns/g": true, "h": true}
+	kvs := []*mvccpb.KeyValue{
+		{Key: []byte(getRetiredEtcdKey("f")), Value: []byte("3")},
+		{Key: []byte(getRetiredEtcdKey("gone")), Value: []byte("2")},
+	}
+	reconcile(existing, kvs, handlers)
+
+	if len(deleted) != 1 || deleted[0] != "gone" {
+		t.Errorf("expected only 'gone' to be deleted, got %v", deleted)
+	}
+	if len(retired) != 1 || retired["f"] != 3 {
+		t.Errorf("unexpected retired versions: %v", retired)
+	}
+}
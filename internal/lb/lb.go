@@ -11,6 +11,7 @@ import (
 
 	"github.com/grussorusso/serverledge/internal/config"
 	"github.com/grussorusso/serverledge/internal/registration"
+	"github.com/grussorusso/serverledge/utils"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
 )
@@ -31,12 +32,25 @@ func StartReverseProxy(e *echo.Echo, region string) {
 	log.Printf("Initializing with %d targets.\n", len(targets))
 	balancer := newBalancer(targets)
 	currentTargets = targets
-	e.Use(middleware.Proxy(balancer))
+	clientTLSConfig, err := utils.ClientTLSConfig()
+	if err != nil {
+		log.Fatalf("Invalid TLS configuration: %v\n", err)
+	}
+	e.Use(middleware.ProxyWithConfig(middleware.ProxyConfig{
+		Balancer:  balancer,
+		Transport: &http.Transport{TLSClientConfig: clientTLSConfig},
+	}))
 
 	go updateTargets(balancer, region)
 
+	serverTLSConfig, err := utils.ServerTLSConfig()
+	if err != nil {
+		log.Fatalf("Invalid TLS configuration: %v\n", err)
+	}
 	portNumber := config.GetInt(config.API_PORT, 1323)
-	if err := e.Start(fmt.Sprintf(":%d", portNumber)); err != nil && !errors.Is(err, http.ErrServerClosed) {
+	e.Server.Addr = fmt.Sprintf(":%d", portNumber)
+	e.Server.TLSConfig = serverTLSConfig
+	if err := e.StartServer(e.Server); err != nil && !errors.Is(err, http.ErrServerClosed) {
 		e.Logger.Fatal("shutting down the server")
 	}
 }
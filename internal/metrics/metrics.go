@@ -51,9 +51,28 @@ var (
 		Buckets: durationBuckets,
 	},
 		[]string{"node", "function"})
+	AdmittedInvocations = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "sedge_admitted_total",
+		Help: "The total number of invocations admitted by admission control",
+	}, []string{"node", "function"})
+	RejectedInvocations = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "sedge_rejected_total",
+		Help: "The total number of invocations rejected by admission control",
+	}, []string{"node", "function", "reason"})
+	QueueLength = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "sedge_queue_length",
+		Help: "The number of requests waiting in the scheduler queue",
+	}, []string{"node"})
+	QueueTimes = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "sedge_queuetime",
+		Help:    "Time spent by requests in the scheduler queue",
+		Buckets: queueTimeBuckets,
+	},
+		[]string{"node", "function"})
 )
 
 var durationBuckets = []float64{0.002, 0.005, 0.010, 0.02, 0.03, 0.05, 0.1, 0.15, 0.3, 0.6, 1.0}
+var queueTimeBuckets = []float64{0.005, 0.010, 0.025, 0.05, 0.1, 0.25, 0.5, 1.0, 2.5, 5.0, 10.0, 30.0}
 
 func AddCompletedInvocation(funcName string) {
 	CompletedInvocations.With(prometheus.Labels{"function": funcName, "node": nodeIdentifier}).Inc()
@@ -62,7 +81,60 @@ func AddFunctionDurationValue(funcName string, duration float64) {
 	ExecutionTimes.With(prometheus.Labels{"function": funcName, "node": nodeIdentifier}).Observe(duration)
 }
 
+func AddAdmittedInvocation(funcName string) {
+	AdmittedInvocations.With(prometheus.Labels{"function": funcName, "node": nodeIdentifier}).Inc()
+}
+func AddRejectedInvocation(funcName string, reason string) {
+	RejectedInvocations.With(prometheus.Labels{"function": funcName, "node": nodeIdentifier, "reason": reason}).Inc()
+}
+
+func SetQueueLength(length int) {
+	QueueLength.With(prometheus.Labels{"node": nodeIdentifier}).Set(float64(length))
+}
+func AddQueueTimeValue(funcName string, queueTime float64) {
+	QueueTimes.With(prometheus.Labels{"function": funcName, "node": nodeIdentifier}).Observe(queueTime)
+}
+
 func registerGlobalMetrics() {
 	registry.MustRegister(CompletedInvocations)
 	registry.MustRegister(ExecutionTimes)
+	registry.MustRegister(AdmittedInvocations)
+	registry.MustRegister(RejectedInvocations)
+	registry.MustRegister(QueueLength)
+	registry.MustRegister(QueueTimes)
+	registry.MustRegister(prewarmCollector{})
+}
+
+// prewarmCollector exports the decisions of the prewarming controller.
+type prewarmCollector struct{}
+
+var (
+	prewarmRateDesc = prometheus.NewDesc("sedge_prewarm_rate",
+		"Arrival rate forecast by the prewarming controller", []string{"node", "function"}, nil)
+	prewarmTargetDesc = prometheus.NewDesc("sedge_prewarm_target",
+		"Number of containers targeted by the prewarming controller", []string{"node", "function"}, nil)
+	prewarmHitRatioDesc = prometheus.NewDesc("sedge_warm_hit_ratio",
+		"Fraction of requests served by warm containers", []string{"node", "function"}, nil)
+	prewarmSpawnedDesc = prometheus.NewDesc("sedge_prewarm_spawned_total",
+		"The total number of containers spawned by the prewarming controller", []string{"node", "function"}, nil)
+	prewarmRetiredDesc = prometheus.NewDesc("sedge_prewarm_retired_total",
+		"The total number of containers retired by the prewarming controller", []string{"node", "function"}, nil)
+)
+
+func (prewarmCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- prewarmRateDesc
+	ch <- prewarmTargetDesc
+	ch <- prewarmHitRatioDesc
+	ch <- prewarmSpawnedDesc
+	ch <- prewarmRetiredDesc
+}
+
+func (prewarmCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, s := range node.GetPrewarmStatus() {
+		ch <- prometheus.MustNewConstMetric(prewarmRateDesc, prometheus.GaugeValue, s.Rate, nodeIdentifier, s.Function)
+		ch <- prometheus.MustNewConstMetric(prewarmTargetDesc, prometheus.GaugeValue, float64(s.Target), nodeIdentifier, s.Function)
+		ch <- prometheus.MustNewConstMetric(prewarmHitRatioDesc, prometheus.GaugeValue, s.HitRatio, nodeIdentifier, s.Function)
+		ch <- prometheus.MustNewConstMetric(prewarmSpawnedDesc, prometheus.CounterValue, float64(s.Spawned), nodeIdentifier, s.Function)
+		ch <- prometheus.MustNewConstMetric(prewarmRetiredDesc, prometheus.CounterValue, float64(s.Retired), nodeIdentifier, s.Function)
+	}
 }
@@ -0,0 +1,203 @@
+package node
+
+import (
+	"log"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/grussorusso/serverledge/internal/config"
+	"github.com/grussorusso/serverledge/internal/function"
+)
+
+// KeepAlivePolicy decides how long idle containers of a function are kept warm.
+// Functions may override the policy by setting their KeepAlive.
+type KeepAlivePolicy interface {
+	// KeepAlive returns how long an idle container of the function is kept.
+	KeepAlive(f *function.Function) time.Duration
+	// OnArrival notifies the policy of a new request for the function.
+	OnArrival(f *function.Function, arrival time.Time)
+}
+
+// EvictionCandidate describes an idle container that may be evicted.
+type EvictionCandidate struct {
+	Function  *function.Function
+	IdleSince time.Time
+	Uses      int64   // requests served by the containers of the function
+	ColdStart float64 // estimated cold start cost (seconds)
+}
+
+// EvictionPolicy ranks idle containers when memory must be reclaimed.
+type EvictionPolicy interface {
+	// Rank returns the priority of a container that has just become idle:
+	// containers with the lowest priority are evicted first.
+	Rank(c *EvictionCandidate) float64
+	// Evicted notifies the policy of the eviction of a container.
+	Evicted(priority float64)
+}
+
+var keepAlivePolicy KeepAlivePolicy = &FixedKeepAlive{}
+var evictionPolicy EvictionPolicy = &LRUEviction{}
+
+// true if idle warm containers are paused
+var pauseIdleContainers = false
+
+// InitContainerPolicies configures the snapshot mode, the pausing of idle
+// containers, and the keep-alive and eviction policies.
+func InitContainerPolicies() {
+	initSnapshots()
+	pauseIdleContainers = config.GetBool(config.CONTAINER_PAUSE_IDLE, false)
+
+	switch policy := config.GetString(config.KEEPALIVE_POLICY, "fixed"); policy {
+	case "adaptive":
+		keepAlivePolicy = NewAdaptiveKeepAlive(
+			config.GetFloat(config.KEEPALIVE_PERCENTILE, 99),
+			time.Duration(config.GetFloat(config.KEEPALIVE_MIN, 60)*float64(time.Second)),
+			time.Duration(config.GetFloat(config.KEEPALIVE_MAX, 3600)*float64(time.Second)))
+	case "fixed":
+		keepAlivePolicy = &FixedKeepAlive{}
+	default:
+		log.Printf("Unknown keep-alive policy: %s\n", policy)
+		keepAlivePolicy = &FixedKeepAlive{}
+	}
+
+	switch policy := config.GetString(config.EVICTION_POLICY, "lru"); policy {
+	case "greedydual":
+		evictionPolicy = &GreedyDualEviction{}
+	case "lru":
+		evictionPolicy = &LRUEviction{}
+	default:
+		log.Printf("Unknown eviction policy: %s\n", policy)
+		evictionPolicy = &LRUEviction{}
+	}
+}
+
+// keepAliveFor returns the keep-alive time of the idle containers of a function.
+func keepAliveFor(f *function.Function) time.Duration {
+	if f.KeepAlive > 0 {
+		return time.Duration(f.KeepAlive * float64(time.Second))
+	}
+	return keepAlivePolicy.KeepAlive(f)
+}
+
+// FixedKeepAlive keeps every idle container for container.expiration seconds.
+type FixedKeepAlive struct{}
+
+func (p *FixedKeepAlive) KeepAlive(_ *function.Function) time.Duration {
+	return time.Duration(config.GetInt(config.CONTAINER_EXPIRATION_TIME, 600)) * time.Second
+}
+
+func (p *FixedKeepAlive) OnArrival(_ *function.Function, _ time.Time) {}
+
+// maximum number of inter-arrival times kept for each function
+const interArrivalSamples = 128
+
+// minimum number of samples to learn the keep-alive time of a function
+const minInterArrivalSamples = 5
+
+type interArrivalHistory struct {
+	lastArrival time.Time
+	samples     []time.Duration
+	next        int
+}
+
+// AdaptiveKeepAlive learns the keep-alive time of each function from the
+// distribution of its inter-arrival times, keeping idle containers long enough
+// to serve the given percentile of the next arrivals.
+type AdaptiveKeepAlive struct {
+	sync.Mutex
+	Percentile float64
+	Min        time.Duration
+	Max        time.Duration
+	history    map[string]*interArrivalHistory
+}
+
+func NewAdaptiveKeepAlive(percentile float64, min time.Duration, max time.Duration) *AdaptiveKeepAlive {
+	if percentile <= 0 || percentile > 100 {
+		percentile = 99
+	}
+	return &AdaptiveKeepAlive{
+		Percentile: percentile,
+		Min:        min,
+		Max:        max,
+		history:    make(map[string]*interArrivalHistory),
+	}
+}
+
+func (p *AdaptiveKeepAlive) OnArrival(f *function.Function, arrival time.Time) {
+	p.Lock()
+	defer p.Unlock()
+
+	h, ok := p.history[f.Name]
+	if !ok {
+		p.history[f.Name] = &interArrivalHistory{lastArrival: arrival}
+		return
+	}
+	if arrival.Before(h.lastArrival) {
+		return
+	}
+	sample := arrival.Sub(h.lastArrival)
+	h.lastArrival = arrival
+	if len(h.samples) < interArrivalSamples {
+		h.samples = append(h.samples, sample)
+	} else {
+		h.samples[h.next] = sample
+		h.next = (h.next + 1) % interArrivalSamples
+	}
+}
+
+func (p *AdaptiveKeepAlive) KeepAlive(f *function.Function) time.Duration {
+	p.Lock()
+	h, ok := p.history[f.Name]
+	if !ok || len(h.samples) < minInterArrivalSamples {
+		p.Unlock()
+		return (&FixedKeepAlive{}).KeepAlive(f)
+	}
+	sorted := make([]time.Duration, len(h.samples))
+	copy(sorted, h.samples)
+	p.Unlock()
+
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	i := int(math.Ceil(p.Percentile/100*float64(len(sorted)))) - 1
+	keepAlive := sorted[max(i, 0)]
+	if keepAlive < p.Min {
+		keepAlive = p.Min
+	}
+	if p.Max > 0 && keepAlive > p.Max {
+		keepAlive = p.Max
+	}
+	return keepAlive
+}
+
+// LRUEviction evicts the least recently used containers first.
+type LRUEviction struct{}
+
+func (p *LRUEviction) Rank(c *EvictionCandidate) float64 {
+	return float64(c.IdleSince.UnixNano()) / float64(time.Second)
+}
+
+func (p *LRUEviction) Evicted(_ float64) {}
+
+// GreedyDualEviction implements the Greedy-Dual-Size-Frequency policy:
+// containers of frequently invoked functions with expensive cold starts and
+// small memory footprints are kept longer, while the priority of the other
+// containers ages as evictions occur.
+// Policy methods are invoked with the node resources locked.
+type GreedyDualEviction struct {
+	clock float64
+}
+
+func (p *GreedyDualEviction) Rank(c *EvictionCandidate) float64 {
+	memory := float64(c.Function.MemoryMB)
+	if memory <= 0 {
+		memory = 1
+	}
+	return p.clock + float64(max(c.Uses, 1))*c.ColdStart/memory
+}
+
+func (p *GreedyDualEviction) Evicted(priority float64) {
+	if priority > p.clock {
+		p.clock = priority
+	}
+}
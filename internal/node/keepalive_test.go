@@ -0,0 +1,79 @@
+package node
+
+import (
+	"testing"
+	"time"
+
+	"github.com/grussorusso/serverledge/internal/function"
+)
+
+func TestAdaptiveKeepAlive(t *testing.T) {
+	p := NewAdaptiveKeepAlive(90, time.Second, time.Minute)
+	f := newTestFunction("f", 128)
+
+	if p.KeepAlive(f) != (&FixedKeepAlive{}).KeepAlive(f) {
+		t.Errorf("expected the default keep-alive without samples")
+	}
+
+	// inter-arrival times: 1, 2, ..., 10 s
+	arrival := time.Now()
+	p.OnArrival(f, arrival)
+	for i := 1; i <= 10; i++ {
+		arrival = arrival.Add(time.Duration(i) * time.Second)
+		p.OnArrival(f, arrival)
+	}
+	if keepAlive := p.KeepAlive(f); keepAlive != 9*time.Second {
+		t.Errorf("expected 9s keep-alive, got %v", keepAlive)
+	}
+
+	p.OnArrival(f, arrival.Add(time.Hour))
+	p.Percentile = 100
+	if keepAlive := p.KeepAlive(f); keepAlive != time.Minute {
+		t.Errorf("keep-alive not bounded: %v", keepAlive)
+	}
+
+	// functions may override the policy
+	keepAlivePolicy = p
+	t.Cleanup(func() { keepAlivePolicy = &FixedKeepAlive{} })
+	f.KeepAlive = 2.5
+	if keepAlive := keepAliveFor(f); keepAlive != 2500*time.Millisecond {
+		t.Errorf("keep-alive of the function ignored: %v", keepAlive)
+	}
+}
+
+func TestEvictionPolicies(t *testing.T) {
+	t.Cleanup(func() { evictionPolicy = &LRUEviction{} })
+	cheap := newTestFunction("cheap", 128)
+	expensive := newTestFunction("expensive", 128)
+	other := newTestFunction("other", 128)
+
+	// fills the memory with idle containers, the expensive one released first
+	fill := func() {
+		setupPool(t, 256, 4.0)
+		getFunctionPool(expensive).coldStart = 5.0
+		getFunctionPool(cheap).coldStart = 0.1
+		for _, f := range []*function.Function{expensive, cheap} {
+			contID, err := NewContainer(f)
+			if err != nil {
+				t.Fatalf("cold start failed: %v", err)
+			}
+			ReleaseContainer(contID, f)
+			time.Sleep(time.Millisecond)
+		}
+		if _, err := NewContainer(other); err != nil {
+			t.Fatalf("no container evicted: %v", err)
+		}
+	}
+
+	evictionPolicy = &LRUEviction{}
+	fill()
+	if WarmStatus()["expensive"] != 0 || WarmStatus()["cheap"] != 1 {
+		t.Errorf("LRU: unexpected warm pools: %v", WarmStatus())
+	}
+
+	evictionPolicy = &GreedyDualEviction{}
+	fill()
+	if WarmStatus()["expensive"] != 1 || WarmStatus()["cheap"] != 0 {
+		t.Errorf("greedy-dual: unexpected warm pools: %v", WarmStatus())
+	}
+}
@@ -5,62 +5,150 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"sort"
+	"sync"
 	"time"
 
-	"github.com/grussorusso/serverledge/internal/config"
 	"github.com/grussorusso/serverledge/internal/container"
 	"github.com/grussorusso/serverledge/internal/function"
 )
 
 type ContainerPool struct {
-	busy  *list.List // list of ContainerID
-	ready *list.List // list of warmContainer
+	busy           *list.List                     // list of ContainerID
+	ready          *list.List                     // list of warmContainer
+	uses           int64                          // requests served by warm containers
+	coldStart      float64                        // estimated cold start time (seconds)
+	maxConcurrency int                            // max. requests served at once by each container
+	inFlight       map[container.ContainerID]int  // requests being served by busy containers
+	discarded      map[container.ContainerID]bool // busy containers to destroy once released
+	resuming       map[container.ContainerID]bool // paused containers acquired, not resumed yet
 }
 
 type warmContainer struct {
 	Expiration int64
 	contID     container.ContainerID
+	memoryMB   int64
+	priority   float64 // eviction priority (see EvictionPolicy)
+	paused     bool
 }
 
+// cold start time assumed for functions never started on the node
+const defaultColdStart = 1.0
+
 var NoWarmFoundErr = errors.New("no warm container is available")
 
+// retiredVersions keeps, for each function, the oldest version that can
+// still be used (i.e., older versions have been retired).
+var retiredVersions = make(map[string]int64)
+
 // getFunctionPool retrieves (or creates) the container pool for a function.
+// Each version of a function has its own pool.
 func getFunctionPool(f *function.Function) *ContainerPool {
-	if fp, ok := Resources.ContainerPools[f.Name]; ok {
+	if fp, ok := Resources.ContainerPools[f.VersionedName()]; ok {
 		return fp
 	}
 
 	fp := newFunctionPool(f)
-	Resources.ContainerPools[f.Name] = fp
+	Resources.ContainerPools[f.VersionedName()] = fp
 	return fp
 }
 
-func (fp *ContainerPool) getWarmContainer() (container.ContainerID, bool) {
+// canShare returns true if a busy container can serve another request.
+// Idle containers being released are not shared.
+func (fp *ContainerPool) canShare(contID container.ContainerID) bool {
+	n := fp.inFlight[contID]
+	return n > 0 && n < fp.maxConcurrency && !fp.discarded[contID] && !fp.resuming[contID]
+}
+
+// getSharedContainer returns a busy container that can serve another request.
+func (fp *ContainerPool) getSharedContainer() (container.ContainerID, bool) {
+	if fp.maxConcurrency <= 1 {
+		return "", false
+	}
+	for elem := fp.busy.Front(); elem != nil; elem = elem.Next() {
+		contID := elem.Value.(container.ContainerID)
+		if fp.canShare(contID) {
+			return contID, true
+		}
+	}
+	return "", false
+}
+
+// hasWarmContainer returns true if a request can be served by a warm container.
+func (fp *ContainerPool) hasWarmContainer() bool {
+	if fp.ready.Len() > 0 {
+		return true
+	}
+	_, found := fp.getSharedContainer()
+	return found
+}
+
+// getWarmContainer picks a warm container for a request, preferring busy
+// containers that can serve more requests at once.
+func (fp *ContainerPool) getWarmContainer() (warmContainer, bool) {
+	if contID, found := fp.getSharedContainer(); found {
+		fp.inFlight[contID]++
+		fp.uses++
+		return warmContainer{contID: contID}, true
+	}
+
 	// TODO: picking most-recent / least-recent container might be better?
 	elem := fp.ready.Front()
 	if elem == nil {
-		return "", false
+		return warmContainer{}, false
 	}
 
 	wc := fp.ready.Remove(elem).(warmContainer)
 	fp.putBusyContainer(wc.contID)
+	fp.uses++
 
-	return wc.contID, true
+	return wc, true
 }
 
 func (fp *ContainerPool) putBusyContainer(contID container.ContainerID) {
 	fp.busy.PushBack(contID)
+	fp.inFlight[contID] = 1
 }
 
-func (fp *ContainerPool) putReadyContainer(contID container.ContainerID, expiration int64) {
+// releaseRequest decrements the requests being served by a container,
+// returning true if the container became idle.
+func (fp *ContainerPool) releaseRequest(contID container.ContainerID) bool {
+	fp.inFlight[contID]--
+	if fp.inFlight[contID] > 0 {
+		return false
+	}
+	delete(fp.inFlight, contID)
+	return true
+}
+
+func (fp *ContainerPool) putReadyContainer(contID container.ContainerID, f *function.Function, now time.Time, paused bool) {
+	candidate := EvictionCandidate{Function: f, IdleSince: now, Uses: fp.uses, ColdStart: fp.coldStart}
 	fp.ready.PushBack(warmContainer{
 		contID:     contID,
-		Expiration: expiration,
+		Expiration: now.Add(keepAliveFor(f)).UnixNano(),
+		memoryMB:   f.MemoryMB,
+		priority:   evictionPolicy.Rank(&candidate),
+		paused:     paused,
 	})
 }
 
-func newFunctionPool(_ *function.Function) *ContainerPool {
-	fp := &ContainerPool{}
+// removeBusyContainer removes a container from the busy list.
+// The function is NOT thread-safe.
+func (fp *ContainerPool) removeBusyContainer(contID container.ContainerID) {
+	for elem := fp.busy.Front(); elem != nil; elem = elem.Next() {
+		if elem.Value.(container.ContainerID) == contID {
+			fp.busy.Remove(elem)
+			return
+		}
+	}
+	panic("Failed to release container")
+}
+
+func newFunctionPool(f *function.Function) *ContainerPool {
+	fp := &ContainerPool{coldStart: defaultColdStart, maxConcurrency: f.Concurrency()}
+	fp.inFlight = make(map[container.ContainerID]int)
+	fp.discarded = make(map[container.ContainerID]bool)
+	fp.resuming = make(map[container.ContainerID]bool)
 	fp.busy = list.New()
 	fp.ready = list.New()
 
@@ -106,7 +194,10 @@ func releaseResources(cpuDemand float64, memDemand int64) {
 
 // AcquireWarmContainer acquires a warm container for a given function (if any).
 // A warm container is in running/paused state and has already been initialized
-// with the function code.
+// with the function code. Paused containers must be resumed through
+// ResumeContainer before use, which is left to the caller as it may take a while.
+// If the function allows concurrent requests, a busy container may be
+// returned as well (CPU is acquired for each request).
 // The acquired container is already in the busy pool.
 // The function returns an error if either:
 // (i) the warm container does not exist
@@ -116,8 +207,7 @@ func AcquireWarmContainer(f *function.Function) (container.ContainerID, error) {
 	defer Resources.Unlock()
 
 	fp := getFunctionPool(f)
-	contID, found := fp.getWarmContainer()
-	if !found {
+	if !fp.hasWarmContainer() {
 		return "", NoWarmFoundErr
 	}
 
@@ -125,41 +215,118 @@ func AcquireWarmContainer(f *function.Function) (container.ContainerID, error) {
 		//log.Printf("Not enough CPU to start a warm container for %s", f)
 		return "", OutOfResourcesErr
 	}
+	wc, _ := fp.getWarmContainer()
+	if wc.paused {
+		fp.resuming[wc.contID] = true
+	}
 
 	//log.Printf("Using warm %s for %s. Now: %v", contID, f, Resources)
-	return contID, nil
+	return wc.contID, nil
 }
 
-// ReleaseContainer puts a container in the ready pool for a function.
-func ReleaseContainer(contID container.ContainerID, f *function.Function) {
-	// setup Expiration as time duration from now
-	d := time.Duration(config.GetInt(config.CONTAINER_EXPIRATION_TIME, 600)) * time.Second
-	expTime := time.Now().Add(d).UnixNano()
+// ResumeContainer unpauses a warm container acquired in paused state (if
+// needed). Containers that cannot be resumed are discarded.
+func ResumeContainer(contID container.ContainerID, f *function.Function) error {
+	Resources.Lock()
+	fp := getFunctionPool(f)
+	paused := fp.resuming[contID]
+	Resources.Unlock()
+	if !paused {
+		return nil
+	}
+
+	if err := container.Unpause(contID); err != nil {
+		log.Printf("Could not unpause container %s: %v\n", contID, err)
+		Resources.Lock()
+		delete(fp.resuming, contID)
+		Resources.Unlock()
+		DiscardContainer(contID, f)
+		return err
+	}
 
 	Resources.Lock()
 	defer Resources.Unlock()
+	delete(fp.resuming, contID)
+	return nil
+}
 
+// ReleaseContainer releases a container at the end of a request. Once it is
+// not serving any request, the container is put in the ready pool for the
+// function. If idle containers are paused, this happens in background, and
+// the container becomes ready once paused.
+func ReleaseContainer(contID container.ContainerID, f *function.Function) {
+	now := time.Now()
+
+	Resources.Lock()
 	fp := getFunctionPool(f)
+	releaseResources(f.CPUDemand, 0)
+	if !fp.releaseRequest(contID) {
+		// still serving other requests
+		Resources.Unlock()
+		return
+	}
+	delete(restoredContainers, contID)
+	if !pauseIdleContainers || fp.discarded[contID] || isRetired(f) {
+		fp.putIdleContainer(contID, f, now, false)
+		Resources.Unlock()
+		return
+	}
+	Resources.Unlock()
 
-	// we must update the busy list by removing this element
-	var removed container.ContainerID
-	elem := fp.busy.Front()
-	for ok := elem != nil; ok; ok = elem != nil {
-		if elem.Value.(container.ContainerID) == contID {
-			removed = fp.busy.Remove(elem).(container.ContainerID)
-			break
+	// idle containers do not need CPU (meanwhile, the container stays
+	// in the busy pool, without serving requests)
+	inBackground(func() {
+		paused := true
+		if err := container.Pause(contID); err != nil {
+			log.Printf("Could not pause container %s: %v\n", contID, err)
+			paused = false
 		}
-		elem = elem.Next()
-	}
-	if removed != contID {
-		panic("Failed to release container")
+
+		Resources.Lock()
+		defer Resources.Unlock()
+		fp.putIdleContainer(contID, f, now, paused)
+	})
+}
+
+// putIdleContainer moves a busy container that is not serving requests to
+// the ready pool, unless it must be destroyed.
+// The function is NOT thread-safe.
+func (fp *ContainerPool) putIdleContainer(contID container.ContainerID, f *function.Function, now time.Time, paused bool) {
+	fp.removeBusyContainer(contID)
+
+	if fp.discarded[contID] || isRetired(f) {
+		log.Printf("Removing container %s of %s\n", contID, f.VersionedName())
+		delete(fp.discarded, contID)
+		releaseResources(0, f.MemoryMB)
+		destroyInBackground([]container.ContainerID{contID})
+		return
 	}
 
-	fp.putReadyContainer(contID, expTime)
+	// the container expires after the keep-alive time of the function
+	fp.putReadyContainer(contID, f, now, paused)
 
+	//log.Printf("Released resources. Now: %v", Resources)
+}
+
+// DiscardContainer destroys a busy container that cannot be reused (e.g.,
+// because it may still be running a timed out request). Containers still
+// serving other requests are destroyed when released.
+func DiscardContainer(contID container.ContainerID, f *function.Function) {
+	Resources.Lock()
+	defer Resources.Unlock()
+
+	fp := getFunctionPool(f)
 	releaseResources(f.CPUDemand, 0)
+	if !fp.releaseRequest(contID) {
+		fp.discarded[contID] = true
+		return
+	}
 
-	//log.Printf("Released resources. Now: %v", Resources)
+	fp.removeBusyContainer(contID)
+	delete(fp.discarded, contID)
+	delete(restoredContainers, contID)
+	releaseResources(0, f.MemoryMB)
+	destroyInBackground([]container.ContainerID{contID})
 }
 
 // NewContainer creates and starts a new container for the given function.
@@ -198,15 +365,18 @@ func getImageForFunction(fun *function.Function) (string, error) {
 // function, assuming that the required CPU and memory resources have been
 // already been acquired.
 func NewContainerWithAcquiredResources(fun *function.Function) (container.ContainerID, error) {
+	if contID, ok := restoreFromSnapshot(fun); ok {
+		return contID, nil
+	}
+
 	image, err := getImageForFunction(fun)
 	if err != nil {
 		return "", err
 	}
 
-	contID, err := container.NewContainer(image, fun.TarFunctionCode, &container.ContainerOptions{
-		MemoryMB: fun.MemoryMB,
-		CPUQuota: fun.CPUDemand,
-	})
+	t0 := time.Now()
+	contID, err := container.NewContainer(image, fun.TarFunctionCode, containerOptions(fun))
+	coldStart := time.Since(t0).Seconds()
 
 	if err != nil {
 		log.Printf("Failed container creation: %v\n", err)
@@ -221,73 +391,100 @@ func NewContainerWithAcquiredResources(fun *function.Function) (container.Contai
 
 	fp := getFunctionPool(fun)
 	fp.putBusyContainer(contID) // We immediately mark it as busy
+	fp.coldStart = 0.5*fp.coldStart + 0.5*coldStart
+
+	// the next containers may be restored from a snapshot
+	if snapshotMode != SNAPSHOT_NONE {
+		inBackground(func() { prepareSnapshot(fun) })
+	}
 
 	return contID, nil
 }
 
+// containerOptions returns the options for the containers of a function,
+// which may serve multiple requests at once.
+func containerOptions(fun *function.Function) *container.ContainerOptions {
+	return &container.ContainerOptions{
+		MemoryMB: fun.MemoryMB,
+		CPUQuota: fun.CPUDemand * float64(fun.Concurrency()),
+	}
+}
+
 type itemToDismiss struct {
-	contID container.ContainerID
-	pool   *ContainerPool
-	elem   *list.Element
-	memory int64
+	contID   container.ContainerID
+	pool     *ContainerPool
+	elem     *list.Element
+	memory   int64
+	priority float64
+	snapshot string // versioned name of the function, for paused snapshots
 }
 
 // dismissContainer ... this function is used to get free memory used for a new container
-// 2-phases: first, we find ready container and collect them as a slice, second (cleanup phase) we delete the container only and only if
-// the sum of their memory is >= requiredMemoryMB is
+// 2-phases: first, we rank ready containers according to the eviction policy, second (cleanup phase) we delete the
+// lowest-priority containers only and only if the sum of their memory is >= requiredMemoryMB
 func dismissContainer(requiredMemoryMB int64) (bool, error) {
 	var cleanedMB int64 = 0
-	var containerToDismiss []itemToDismiss
-	res := false
+	var candidates []itemToDismiss
 
 	//first phase, research
 	for _, funPool := range Resources.ContainerPools {
-		if funPool.ready.Len() > 0 {
-			// every container into the funPool has the same memory (same function)
-			//so it is not important which one you destroy
-			elem := funPool.ready.Front()
-			contID := elem.Value.(warmContainer).contID
-			// container in the same pool need same memory
-			memory, _ := container.GetMemoryMB(contID)
-			for ok := true; ok; ok = elem != nil {
-				containerToDismiss = append(containerToDismiss,
-					itemToDismiss{contID: contID, pool: funPool, elem: elem, memory: memory})
-				cleanedMB += memory
-				if cleanedMB >= requiredMemoryMB {
-					goto cleanup
-				}
-				//go on to the next one
-				elem = elem.Next()
-			}
+		for elem := funPool.ready.Front(); elem != nil; elem = elem.Next() {
+			wc := elem.Value.(warmContainer)
+			candidates = append(candidates,
+				itemToDismiss{contID: wc.contID, pool: funPool, elem: elem, memory: wc.memoryMB, priority: wc.priority})
+		}
+	}
+	// paused snapshots hold memory as well
+	for versionedName, s := range snapshots {
+		if s.ready && s.memoryMB > 0 {
+			candidates = append(candidates,
+				itemToDismiss{contID: s.contID, memory: s.memoryMB, priority: s.priority, snapshot: versionedName})
 		}
 	}
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].priority < candidates[j].priority })
 
-cleanup: // second phase, cleanup
-	// memory check
-	if cleanedMB >= requiredMemoryMB {
-		for _, item := range containerToDismiss {
-			item.pool.ready.Remove(item.elem)     // remove the container from the funPool
-			err := container.Destroy(item.contID) // destroy the container
-			if err != nil {
-				res = false
-				return res, nil
-			}
-			Resources.AvailableMemMB += item.memory
+	var containerToDismiss []itemToDismiss
+	for _, item := range candidates {
+		if cleanedMB >= requiredMemoryMB {
+			break
 		}
+		containerToDismiss = append(containerToDismiss, item)
+		cleanedMB += item.memory
+	}
 
-		res = true
+	// second phase, cleanup
+	// memory check
+	if cleanedMB < requiredMemoryMB {
+		return false, nil
 	}
-	return res, nil
+	for _, item := range containerToDismiss {
+		if item.snapshot != "" {
+			removeSnapshot(snapshots[item.snapshot])
+			delete(snapshots, item.snapshot)
+			evictionPolicy.Evicted(item.priority)
+			continue
+		}
+		item.pool.ready.Remove(item.elem)     // remove the container from the funPool
+		err := container.Destroy(item.contID) // destroy the container
+		if err != nil {
+			return false, nil
+		}
+		evictionPolicy.Evicted(item.priority)
+		Resources.AvailableMemMB += item.memory
+	}
+	return true, nil
 }
 
 // DeleteExpiredContainer is called by the container cleaner
-// Deletes expired warm container
+// Deletes expired warm containers and snapshots
 func DeleteExpiredContainer() {
 	now := time.Now().UnixNano()
 
 	Resources.Lock()
 	defer Resources.Unlock()
 
+	removeExpiredSnapshots(now)
+
 	for _, pool := range Resources.ContainerPools {
 		elem := pool.ready.Front()
 		for ok := elem != nil; ok; ok = elem != nil {
@@ -314,41 +511,131 @@ func DeleteExpiredContainer() {
 }
 
 // ShutdownWarmContainersFor destroys warm containers of a given function
+// (all its versions).
 // Actual termination happens asynchronously.
 func ShutdownWarmContainersFor(f *function.Function) {
 	Resources.Lock()
 	defer Resources.Unlock()
 
-	fp, ok := Resources.ContainerPools[f.Name]
-	if !ok {
+	delete(retiredVersions, f.Name)
+	shutdownWarmContainers(func(name string, _ int64) bool {
+		return name == f.Name
+	})
+}
+
+// LocalFunctions returns the (plain) names of the functions having pools,
+// snapshots or retired versions on this node.
+func LocalFunctions() []string {
+	Resources.RLock()
+	defer Resources.RUnlock()
+
+	names := make(map[string]bool)
+	for poolName := range Resources.ContainerPools {
+		name, _, _, _ := function.ParseReference(poolName)
+		names[name] = true
+	}
+	for versionedName := range snapshots {
+		name, _, _, _ := function.ParseReference(versionedName)
+		names[name] = true
+	}
+	for name := range retiredVersions {
+		names[name] = true
+	}
+	list := make([]string, 0, len(names))
+	for name := range names {
+		list = append(list, name)
+	}
+	sort.Strings(list)
+	return list
+}
+
+// RetireVersionsBefore destroys warm containers of the versions of a function
+// that precede minVersion. Busy containers of those versions are destroyed
+// as soon as they are released.
+// Actual termination happens asynchronously.
+func RetireVersionsBefore(funcName string, minVersion int64) {
+	Resources.Lock()
+	defer Resources.Unlock()
+
+	if retiredVersions[funcName] >= minVersion {
 		return
 	}
+	retiredVersions[funcName] = minVersion
+	log.Printf("Retiring versions of %s before %d\n", funcName, minVersion)
+
+	shutdownWarmContainers(func(name string, version int64) bool {
+		return name == funcName && version < minVersion
+	})
+}
 
+// isRetired returns true if the version of the function has been retired.
+// The function is NOT thread-safe.
+func isRetired(f *function.Function) bool {
+	return f.Version < retiredVersions[f.Name]
+}
+
+// shutdownWarmContainers destroys warm containers in the pools of the function
+// versions that satisfy the given predicate.
+// The function is NOT thread-safe.
+func shutdownWarmContainers(match func(funcName string, version int64) bool) {
 	containersToDelete := make([]container.ContainerID, 0)
 
-	elem := fp.ready.Front()
-	for ok := elem != nil; ok; ok = elem != nil {
-		warmed := elem.Value.(warmContainer)
-		temp := elem
-		elem = elem.Next()
-		log.Printf("Removing container with ID %s\n", warmed.contID)
-		fp.ready.Remove(temp)
-
-		memory, _ := container.GetMemoryMB(warmed.contID)
-		Resources.AvailableMemMB += memory
-		containersToDelete = append(containersToDelete, warmed.contID)
-	}
-
-	go func(contIDs []container.ContainerID) {
-		for _, contID := range contIDs {
-			// No need to update available resources here
-			if err := container.Destroy(contID); err != nil {
-				log.Printf("An error occurred while deleting %s: %v\n", contID, err)
-			} else {
-				log.Printf("Deleted %s\n", contID)
-			}
+	for poolName, fp := range Resources.ContainerPools {
+		name, version, _, _ := function.ParseReference(poolName)
+		if !match(name, version) {
+			continue
+		}
+
+		elem := fp.ready.Front()
+		for ok := elem != nil; ok; ok = elem != nil {
+			warmed := elem.Value.(warmContainer)
+			temp := elem
+			elem = elem.Next()
+			log.Printf("Removing container with ID %s\n", warmed.contID)
+			fp.ready.Remove(temp)
+
+			memory, _ := container.GetMemoryMB(warmed.contID)
+			Resources.AvailableMemMB += memory
+			containersToDelete = append(containersToDelete, warmed.contID)
+		}
+	}
+
+	removeSnapshots(match)
+
+	destroyInBackground(containersToDelete)
+}
+
+// backgroundTasks tracks the container operations running in background.
+var backgroundTasks sync.WaitGroup
+
+// inBackground runs a container operation in a new goroutine.
+func inBackground(task func()) {
+	backgroundTasks.Add(1)
+	go func() {
+		defer backgroundTasks.Done()
+		task()
+	}()
+}
+
+// WaitBackgroundTasks waits for the container operations running in
+// background (e.g., the destruction of containers) to complete.
+func WaitBackgroundTasks() {
+	backgroundTasks.Wait()
+}
+
+func destroyInBackground(contIDs []container.ContainerID) {
+	inBackground(func() { destroyContainers(contIDs) })
+}
+
+func destroyContainers(contIDs []container.ContainerID) {
+	for _, contID := range contIDs {
+		// No need to update available resources here
+		if err := container.Destroy(contID); err != nil {
+			log.Printf("An error occurred while deleting %s: %v\n", contID, err)
+		} else {
+			log.Printf("Deleted %s\n", contID)
 		}
-	}(containersToDelete)
+	}
 }
 
 // ShutdownAllContainers destroys all container (usually on termination)
@@ -356,6 +643,21 @@ func ShutdownAllContainers() {
 	Resources.Lock()
 	defer Resources.Unlock()
 
+	for versionedName, s := range snapshots {
+		delete(snapshots, versionedName)
+		if !s.ready {
+			continue
+		}
+		log.Printf("Removing snapshot container with ID %s\n", s.contID)
+		if s.checkpointID != "" {
+			_ = container.DeleteCheckpoint(s.contID, s.checkpointID)
+		}
+		if err := container.Destroy(s.contID); err != nil {
+			log.Printf("Error while destroying container %s: %s", s.contID, err)
+		}
+		Resources.AvailableMemMB += s.memoryMB
+	}
+
 	for fun, pool := range Resources.ContainerPools {
 		elem := pool.ready.Front()
 		for ok := elem != nil; ok; ok = elem != nil {
@@ -389,18 +691,24 @@ func ShutdownAllContainers() {
 				log.Printf("Error while destroying container %s: %s", contID, err)
 			}
 			Resources.AvailableMemMB += memory
-			Resources.AvailableCPUs += functionDescriptor.CPUDemand
+			Resources.AvailableCPUs += functionDescriptor.CPUDemand * float64(pool.inFlight[contID])
 		}
 	}
 }
 
-// WarmStatus foreach function returns the corresponding number of warm container available
+// WarmStatus foreach function (version) returns the corresponding number of warm container available,
+// including busy containers that can serve more requests at once
 func WarmStatus() map[string]int {
 	Resources.RLock()
 	defer Resources.RUnlock()
 	warmPool := make(map[string]int)
 	for funcName, pool := range Resources.ContainerPools {
 		warmPool[funcName] = pool.ready.Len()
+		for contID := range pool.inFlight {
+			if pool.canShare(contID) {
+				warmPool[funcName]++
+			}
+		}
 	}
 
 	return warmPool
@@ -418,11 +726,13 @@ func PrewarmInstances(f *function.Function, count int64, forcePull bool) (int64,
 
 	var spawned int64 = 0
 	for spawned < count {
-		_, err = NewContainer(f)
+		contID, err := NewContainer(f)
 		if err != nil {
 			log.Printf("Prespawning failed: %v\n", err)
 			return spawned, err
 		}
+		// the new container is ready for requests
+		ReleaseContainer(contID, f)
 		spawned += 1
 	}
 
@@ -0,0 +1,253 @@
+package node
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/grussorusso/serverledge/internal/container"
+	"github.com/grussorusso/serverledge/internal/container/containertest"
+	"github.com/grussorusso/serverledge/internal/function"
+)
+
+// setupPool resets the node resources and installs a fake container factory.
+func setupPool(t *testing.T, memMB int64, cpus float64) *containertest.FakeFactory {
+	Resources.AvailableMemMB = memMB
+	Resources.AvailableCPUs = cpus
+	Resources.ContainerPools = make(map[string]*ContainerPool)
+	retiredVersions = make(map[string]int64)
+	snapshots = make(map[string]*functionSnapshot)
+	restoredContainers = make(map[container.ContainerID]bool)
+
+	factory := containertest.InitFakeContainerFactory(0, 0)
+	t.Cleanup(func() {
+		WaitBackgroundTasks()
+		factory.Close()
+	})
+	return factory
+}
+
+func newTestFunction(name string, memMB int64) *function.Function {
+	return &function.Function{Name: name, Runtime: container.CUSTOM_RUNTIME, CustomImage: "fake", MemoryMB: memMB, CPUDemand: 1.0}
+}
+
+func TestWarmContainerReuse(t *testing.T) {
+	factory := setupPool(t, 256, 2.0)
+	f := newTestFunction("f", 128)
+
+	if _, err := AcquireWarmContainer(f); !errors.Is(err, NoWarmFoundErr) {
+		t.Fatalf("expected no warm container, got: %v", err)
+	}
+
+	contID, err := NewContainer(f)
+	if err != nil {
+		t.Fatalf("cold start failed: %v", err)
+	}
+	if Resources.AvailableMemMB != 128 || Resources.AvailableCPUs != 1.0 {
+		t.Fatalf("unexpected resources after cold start: %v", &Resources)
+	}
+
+	ReleaseContainer(contID, f)
+	if WarmStatus()["f"] != 1 {
+		t.Fatalf("expected 1 warm container, got %d", WarmStatus()["f"])
+	}
+	if Resources.AvailableCPUs != 2.0 {
+		t.Fatalf("CPUs not released: %v", &Resources)
+	}
+
+	warmID, err := AcquireWarmContainer(f)
+	if err != nil || warmID != contID {
+		t.Fatalf("expected warm container %s, got %s (%v)", contID, warmID, err)
+	}
+	if factory.Created != 1 {
+		t.Fatalf("expected 1 container to be created, got %d", factory.Created)
+	}
+}
+
+func TestOutOfResources(t *testing.T) {
+	setupPool(t, 100, 2.0)
+	f := newTestFunction("f", 128)
+
+	if _, err := NewContainer(f); !errors.Is(err, OutOfResourcesErr) {
+		t.Fatalf("expected OutOfResourcesErr, got: %v", err)
+	}
+	if Resources.AvailableMemMB != 100 || Resources.AvailableCPUs != 2.0 {
+		t.Fatalf("resources leaked: %v", &Resources)
+	}
+}
+
+func TestBusyContainersNotDismissed(t *testing.T) {
+	setupPool(t, 256, 4.0)
+	f := newTestFunction("f", 128)
+	g := newTestFunction("g", 256)
+
+	for i := 0; i < 2; i++ {
+		contID, err := NewContainer(f)
+		if err != nil {
+			t.Fatalf("cold start failed: %v", err)
+		}
+		defer ReleaseContainer(contID, f)
+	}
+
+	// busy containers cannot be dismissed
+	if _, err := NewContainer(g); !errors.Is(err, OutOfResourcesErr) {
+		t.Fatalf("expected OutOfResourcesErr, got: %v", err)
+	}
+}
+
+func TestIdleContainersDismissed(t *testing.T) {
+	factory := setupPool(t, 256, 4.0)
+	f := newTestFunction("f", 128)
+	g := newTestFunction("g", 256)
+
+	ids := make([]container.ContainerID, 0)
+	for i := 0; i < 2; i++ {
+		contID, err := NewContainer(f)
+		if err != nil {
+			t.Fatalf("cold start failed: %v", err)
+		}
+		ids = append(ids, contID)
+	}
+	for _, contID := range ids {
+		ReleaseContainer(contID, f)
+	}
+
+	if _, err := NewContainer(g); err != nil {
+		t.Fatalf("expected idle containers to be dismissed, got: %v", err)
+	}
+	if factory.Destroyed != 2 || WarmStatus()["f"] != 0 {
+		t.Fatalf("expected 2 dismissed containers, got %d", factory.Destroyed)
+	}
+	if Resources.AvailableMemMB != 0 {
+		t.Fatalf("unexpected resources: %v", &Resources)
+	}
+}
+
+func TestRetiredVersions(t *testing.T) {
+	factory := setupPool(t, 512, 4.0)
+	v1 := newTestFunction("f", 128)
+	v1.Version = 1
+	v2 := newTestFunction("f", 128)
+	v2.Version = 2
+
+	idle, _ := NewContainer(v1)
+	busy, _ := NewContainer(v1)
+	current, _ := NewContainer(v2)
+	ReleaseContainer(idle, v1)
+	ReleaseContainer(current, v2)
+
+	RetireVersionsBefore("f", 2)
+	if WarmStatus()["f:1"] != 0 || WarmStatus()["f:2"] != 1 {
+		t.Fatalf("unexpected warm pools: %v", WarmStatus())
+	}
+
+	// busy containers of retired versions are not reused
+	ReleaseContainer(busy, v1)
+	if WarmStatus()["f:1"] != 0 {
+		t.Fatalf("retired container released to the pool")
+	}
+	if Resources.AvailableMemMB != 384 || Resources.AvailableCPUs != 4.0 {
+		t.Fatalf("unexpected resources: %v", &Resources)
+	}
+
+	// destruction is asynchronous
+	for i := 0; i < 100 && factory.Count() > 1; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if factory.Count() != 1 {
+		t.Fatalf("expected 1 container alive, got %d", factory.Count())
+	}
+}
+
+func TestPausedIdleContainers(t *testing.T) {
+	factory := setupPool(t, 256, 2.0)
+	pauseIdleContainers = true
+	t.Cleanup(func() { pauseIdleContainers = false })
+	f := newTestFunction("f", 128)
+
+	contID, err := NewContainer(f)
+	if err != nil {
+		t.Fatalf("cold start failed: %v", err)
+	}
+	ReleaseContainer(contID, f)
+	// the container is paused in background
+	WaitBackgroundTasks()
+	if !factory.IsPaused(contID) {
+		t.Fatalf("idle container not paused")
+	}
+
+	warmID, err := AcquireWarmContainer(f)
+	if err != nil || warmID != contID {
+		t.Fatalf("expected warm container %s, got %s (%v)", contID, warmID, err)
+	}
+	if err := ResumeContainer(warmID, f); err != nil || factory.IsPaused(warmID) {
+		t.Fatalf("acquired container still paused: %v", err)
+	}
+
+	// containers that cannot be resumed are discarded
+	ReleaseContainer(warmID, f)
+	WaitBackgroundTasks()
+	if err := factory.Unpause(warmID); err != nil {
+		t.Fatalf("unpause failed: %v", err)
+	}
+	if warmID, err = AcquireWarmContainer(f); err != nil {
+		t.Fatalf("expected a warm container, got: %v", err)
+	}
+	if err := ResumeContainer(warmID, f); err == nil {
+		t.Fatalf("expected the resume to fail")
+	}
+	if WarmStatus()["f"] != 0 || Resources.AvailableMemMB != 256 || Resources.AvailableCPUs != 2.0 {
+		t.Fatalf("container not discarded: %v", &Resources)
+	}
+}
+
+func TestConcurrentRequests(t *testing.T) {
+	factory := setupPool(t, 256, 4.0)
+	f := newTestFunction("f", 128)
+	f.MaxConcurrency = 2
+
+	contID, err := NewContainer(f)
+	if err != nil {
+		t.Fatalf("cold start failed: %v", err)
+	}
+	if WarmStatus()["f"] != 1 {
+		t.Fatalf("expected the busy container to be shared")
+	}
+	sharedID, err := AcquireWarmContainer(f)
+	if err != nil || sharedID != contID {
+		t.Fatalf("expected shared container %s, got %s (%v)", contID, sharedID, err)
+	}
+	if Resources.AvailableCPUs != 2.0 || Resources.AvailableMemMB != 128 {
+		t.Fatalf("unexpected resources: %v", &Resources)
+	}
+	if _, err := AcquireWarmContainer(f); !errors.Is(err, NoWarmFoundErr) {
+		t.Fatalf("expected no warm container, got: %v", err)
+	}
+
+	ReleaseContainer(contID, f)
+	if Resources.AvailableCPUs != 3.0 || WarmStatus()["f"] != 1 {
+		t.Fatalf("unexpected resources: %v", &Resources)
+	}
+	ReleaseContainer(contID, f)
+	if Resources.AvailableCPUs != 4.0 || WarmStatus()["f"] != 1 {
+		t.Fatalf("unexpected resources: %v", &Resources)
+	}
+
+	// discarded containers are destroyed once every request is completed
+	for i := 0; i < 2; i++ {
+		if _, err := AcquireWarmContainer(f); err != nil {
+			t.Fatalf("warm start failed: %v", err)
+		}
+	}
+	DiscardContainer(contID, f)
+	if _, err := AcquireWarmContainer(f); !errors.Is(err, NoWarmFoundErr) {
+		t.Fatalf("discarded container shared: %v", err)
+	}
+	if factory.Destroyed != 0 || Resources.AvailableCPUs != 3.0 {
+		t.Fatalf("container discarded while serving a request: %v", &Resources)
+	}
+	ReleaseContainer(contID, f)
+	if WarmStatus()["f"] != 0 || Resources.AvailableCPUs != 4.0 || Resources.AvailableMemMB != 256 {
+		t.Fatalf("container not discarded: %v", &Resources)
+	}
+}
@@ -0,0 +1,354 @@
+package node
+
+import (
+	"log"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/grussorusso/serverledge/internal/config"
+	"github.com/grussorusso/serverledge/internal/container"
+	"github.com/grussorusso/serverledge/internal/function"
+)
+
+// FunctionStats summarizes the invocations of a function (version) in the
+// last period of the prewarming controller.
+type FunctionStats struct {
+	Function    *function.Function
+	Period      time.Duration
+	Arrivals    int64
+	WarmStarts  int64
+	ColdStarts  int64
+	AvgDuration float64 // seconds (0 -> no completions in the period)
+	Containers  int     // current number of (ready or busy) containers
+}
+
+// PrewarmPolicy decides how many containers should be kept for a function.
+type PrewarmPolicy interface {
+	// Target returns the number of (ready or busy) containers to keep for
+	// the function, along with the forecast arrival rate (req/s).
+	Target(stats *FunctionStats) (target int, rate float64)
+	// Forget discards the state kept for a function.
+	Forget(versionedName string)
+}
+
+// PrewarmStatus reports the last decision of the controller for a function.
+type PrewarmStatus struct {
+	Function string // versioned name
+	Rate     float64
+	HitRatio float64 // fraction of warm starts over all time
+	Target   int
+	Spawned  int64 // containers spawned by the controller over all time
+	Retired  int64 // containers retired by the controller over all time
+}
+
+type prewarmTracker struct {
+	fun           *function.Function
+	arrivals      int64
+	warmStarts    int64
+	coldStarts    int64
+	completions   int64
+	totalDuration float64
+	status        PrewarmStatus
+	totalWarm     int64
+	totalStarts   int64
+}
+
+type prewarmController struct {
+	sync.Mutex
+	policy   PrewarmPolicy
+	interval time.Duration
+	max      int
+	trackers map[string]*prewarmTracker
+	stop     chan bool
+}
+
+var prewarmer *prewarmController
+
+// StartPrewarming starts the controller that spawns and retires warm
+// containers according to the forecast demand, if enabled.
+func StartPrewarming() {
+	policy := createPrewarmPolicy(config.GetString(config.PREWARM_POLICY, "none"))
+	if policy == nil {
+		return
+	}
+	interval := time.Duration(config.GetFloat(config.PREWARM_INTERVAL, 30) * float64(time.Second))
+	log.Printf("Prewarming enabled (interval: %v)\n", interval)
+	prewarmer = &prewarmController{
+		policy:   policy,
+		interval: interval,
+		max:      config.GetInt(config.PREWARM_MAX_CONTAINERS, 10),
+		trackers: make(map[string]*prewarmTracker),
+		stop:     make(chan bool),
+	}
+	go prewarmer.run()
+}
+
+// StopPrewarming stops the prewarming controller (if running).
+func StopPrewarming() {
+	if prewarmer != nil {
+		prewarmer.stop <- true
+	}
+}
+
+func createPrewarmPolicy(name string) PrewarmPolicy {
+	switch name {
+	case "ewma":
+		return NewEWMAPrewarmPolicy(config.GetFloat(config.PREWARM_EWMA_ALPHA, 0.3))
+	case "none", "":
+		return nil
+	default:
+		log.Printf("Unknown prewarming policy: %s\n", name)
+		return nil
+	}
+}
+
+func (pc *prewarmController) tracker(f *function.Function) *prewarmTracker {
+	t, ok := pc.trackers[f.VersionedName()]
+	if !ok {
+		t = &prewarmTracker{fun: f}
+		t.status.Function = f.VersionedName()
+		pc.trackers[f.VersionedName()] = t
+	}
+	return t
+}
+
+// RecordArrival notifies the keep-alive policy and the prewarming controller
+// of a new request.
+func RecordArrival(f *function.Function) {
+	keepAlivePolicy.OnArrival(f, time.Now())
+	if prewarmer == nil {
+		return
+	}
+	prewarmer.Lock()
+	defer prewarmer.Unlock()
+	prewarmer.tracker(f).arrivals++
+}
+
+// RecordCompletion notifies the prewarming controller of a request that
+// has been executed locally.
+func RecordCompletion(f *function.Function, warmStart bool, duration float64) {
+	if prewarmer == nil {
+		return
+	}
+	prewarmer.Lock()
+	defer prewarmer.Unlock()
+	t := prewarmer.tracker(f)
+	t.completions++
+	t.totalDuration += duration
+	if warmStart {
+		t.warmStarts++
+	} else {
+		t.coldStarts++
+	}
+}
+
+// GetPrewarmStatus returns the last decisions of the prewarming controller.
+func GetPrewarmStatus() []PrewarmStatus {
+	if prewarmer == nil {
+		return nil
+	}
+	prewarmer.Lock()
+	defer prewarmer.Unlock()
+	statuses := make([]PrewarmStatus, 0, len(prewarmer.trackers))
+	for _, t := range prewarmer.trackers {
+		statuses = append(statuses, t.status)
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Function < statuses[j].Function })
+	return statuses
+}
+
+func (pc *prewarmController) run() {
+	ticker := time.NewTicker(pc.interval)
+	for {
+		select {
+		case <-ticker.C:
+			pc.update()
+		case <-pc.stop:
+			ticker.Stop()
+			return
+		}
+	}
+}
+
+// update collects the statistics of the last period and applies the
+// decisions of the policy.
+func (pc *prewarmController) update() {
+	pc.Lock()
+	stats := make([]*FunctionStats, 0, len(pc.trackers))
+	for name, t := range pc.trackers {
+		s := &FunctionStats{
+			Function:   t.fun,
+			Period:     pc.interval,
+			Arrivals:   t.arrivals,
+			WarmStarts: t.warmStarts,
+			ColdStarts: t.coldStarts,
+			Containers: countContainers(t.fun),
+		}
+		if t.completions > 0 {
+			s.AvgDuration = t.totalDuration / float64(t.completions)
+		}
+		t.totalWarm += t.warmStarts
+		t.totalStarts += t.warmStarts + t.coldStarts
+		t.arrivals, t.warmStarts, t.coldStarts, t.completions, t.totalDuration = 0, 0, 0, 0, 0
+		if isRetiredVersion(t.fun) {
+			delete(pc.trackers, name)
+			pc.policy.Forget(name)
+			continue
+		}
+		stats = append(stats, s)
+	}
+	pc.Unlock()
+
+	for _, s := range stats {
+		target, rate := pc.policy.Target(s)
+		if target > pc.max {
+			target = pc.max
+		}
+
+		var spawned, retired int64
+		if target > s.Containers {
+			spawned = spawnWarmContainers(s.Function, int64(target-s.Containers))
+		} else if target < s.Containers {
+			retired = retireWarmContainers(s.Function, s.Containers-target)
+		}
+		if spawned > 0 || retired > 0 {
+			log.Printf("Prewarming %s: rate %.3f req/s, target %d (spawned: %d, retired: %d)\n",
+				s.Function.VersionedName(), rate, target, spawned, retired)
+		}
+
+		pc.Lock()
+		if t, ok := pc.trackers[s.Function.VersionedName()]; ok {
+			t.status.Rate = rate
+			t.status.Target = target
+			t.status.Spawned += spawned
+			t.status.Retired += retired
+			if t.totalStarts > 0 {
+				t.status.HitRatio = float64(t.totalWarm) / float64(t.totalStarts)
+			}
+		}
+		if target == 0 && s.Arrivals == 0 && s.Containers == 0 {
+			// no demand left
+			delete(pc.trackers, s.Function.VersionedName())
+			pc.policy.Forget(s.Function.VersionedName())
+		}
+		pc.Unlock()
+	}
+}
+
+// countContainers returns the number of ready or busy containers of a function.
+func countContainers(f *function.Function) int {
+	Resources.RLock()
+	defer Resources.RUnlock()
+	fp, ok := Resources.ContainerPools[f.VersionedName()]
+	if !ok {
+		return 0
+	}
+	return fp.ready.Len() + fp.busy.Len()
+}
+
+func isRetiredVersion(f *function.Function) bool {
+	Resources.RLock()
+	defer Resources.RUnlock()
+	return isRetired(f)
+}
+
+// spawnWarmContainers creates up to count ready containers for a function,
+// using free resources only (i.e., without evicting other containers).
+func spawnWarmContainers(f *function.Function, count int64) int64 {
+	var spawned int64 = 0
+	for spawned < count {
+		if !AcquireResources(f.CPUDemand, f.MemoryMB, false) {
+			break
+		}
+		contID, err := NewContainerWithAcquiredResources(f)
+		if err != nil {
+			log.Printf("Prewarming failed: %v\n", err)
+			break
+		}
+		ReleaseContainer(contID, f)
+		spawned++
+	}
+	return spawned
+}
+
+// retireWarmContainers destroys up to count ready containers of a function,
+// starting from the least recently used ones.
+func retireWarmContainers(f *function.Function, count int) int64 {
+	Resources.Lock()
+	defer Resources.Unlock()
+
+	fp, ok := Resources.ContainerPools[f.VersionedName()]
+	if !ok {
+		return 0
+	}
+	var retired int64 = 0
+	for int(retired) < count && fp.ready.Len() > 0 {
+		wc := fp.ready.Remove(fp.ready.Front()).(warmContainer)
+		releaseResources(0, f.MemoryMB)
+		destroyInBackground([]container.ContainerID{wc.contID})
+		retired++
+	}
+	return retired
+}
+
+// EWMAPrewarmPolicy forecasts the arrival rate and the duration of each
+// function through an exponentially weighted moving average, and keeps
+// enough containers to serve the expected concurrent requests (Little's law),
+// given the number of requests each container serves at once.
+type EWMAPrewarmPolicy struct {
+	Alpha     float64
+	MinRate   float64 // rates below this value are considered 0
+	rates     map[string]float64
+	durations map[string]float64
+}
+
+func NewEWMAPrewarmPolicy(alpha float64) *EWMAPrewarmPolicy {
+	if alpha <= 0 || alpha > 1 {
+		alpha = 0.3
+	}
+	return &EWMAPrewarmPolicy{
+		Alpha:     alpha,
+		MinRate:   1.0 / 3600,
+		rates:     make(map[string]float64),
+		durations: make(map[string]float64),
+	}
+}
+
+func (p *EWMAPrewarmPolicy) Target(stats *FunctionStats) (int, float64) {
+	name := stats.Function.VersionedName()
+	observedRate := float64(stats.Arrivals) / stats.Period.Seconds()
+	rate, ok := p.rates[name]
+	if ok {
+		rate = p.Alpha*observedRate + (1-p.Alpha)*rate
+	} else {
+		rate = observedRate
+	}
+	if rate < p.MinRate {
+		rate = 0
+	}
+	p.rates[name] = rate
+
+	duration, ok := p.durations[name]
+	if stats.AvgDuration > 0 {
+		if ok {
+			duration = p.Alpha*stats.AvgDuration + (1-p.Alpha)*duration
+		} else {
+			duration = stats.AvgDuration
+		}
+		p.durations[name] = duration
+	}
+
+	if rate == 0 {
+		return 0, 0
+	}
+	// at least one container while the function is being invoked
+	concurrency := float64(stats.Function.Concurrency())
+	return int(math.Max(1, math.Ceil(rate*duration/concurrency))), rate
+}
+
+func (p *EWMAPrewarmPolicy) Forget(versionedName string) {
+	delete(p.rates, versionedName)
+	delete(p.durations, versionedName)
+}
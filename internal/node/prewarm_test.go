@@ -0,0 +1,52 @@
+package node
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPrewarmController(t *testing.T) {
+	setupPool(t, 384, 4.0)
+	f := newTestFunction("f", 128)
+	prewarmer = &prewarmController{
+		policy:   NewEWMAPrewarmPolicy(0.5),
+		interval: time.Second,
+		max:      10,
+		trackers: make(map[string]*prewarmTracker),
+	}
+	t.Cleanup(func() { prewarmer = nil })
+
+	// 4 req/s lasting 0.5 s -> 2 concurrent requests
+	for i := 0; i < 4; i++ {
+		RecordArrival(f)
+		RecordCompletion(f, false, 0.5)
+	}
+	prewarmer.update()
+	if WarmStatus()["f"] != 2 {
+		t.Fatalf("expected 2 warm containers, got %d", WarmStatus()["f"])
+	}
+	if Resources.AvailableMemMB != 128 || Resources.AvailableCPUs != 4.0 {
+		t.Fatalf("unexpected resources: %v", &Resources)
+	}
+
+	// no arrivals: the forecast rate halves
+	prewarmer.update()
+	status := GetPrewarmStatus()
+	if len(status) != 1 || status[0].Target != 1 || status[0].Spawned != 2 || status[0].Retired != 1 {
+		t.Fatalf("unexpected status: %+v", status)
+	}
+	if WarmStatus()["f"] != 1 || Resources.AvailableMemMB != 256 {
+		t.Fatalf("expected 1 warm container, got %d", WarmStatus()["f"])
+	}
+
+	// the budget is never exceeded
+	g := newTestFunction("g", 128)
+	for i := 0; i < 20; i++ {
+		RecordArrival(g)
+		RecordCompletion(g, true, 1.0)
+	}
+	prewarmer.update()
+	if WarmStatus()["g"] != 2 || Resources.AvailableMemMB != 0 {
+		t.Fatalf("unexpected warm containers: %v", WarmStatus())
+	}
+}
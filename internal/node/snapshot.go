@@ -0,0 +1,244 @@
+package node
+
+import (
+	"log"
+	"strings"
+	"time"
+
+	"github.com/grussorusso/serverledge/internal/config"
+	"github.com/grussorusso/serverledge/internal/container"
+	"github.com/grussorusso/serverledge/internal/function"
+)
+
+// Snapshot modes (see config.SNAPSHOT_MODE)
+const (
+	SNAPSHOT_NONE       = "none"
+	SNAPSHOT_PAUSE      = "pause"      // a paused initialized container is kept for each function
+	SNAPSHOT_CHECKPOINT = "checkpoint" // a checkpoint of an initialized container is kept for each function
+)
+
+// max. time to wait for the initialization of a container to snapshot
+const snapshotInitTimeout = 30 * time.Second
+
+// functionSnapshot is an initialized container of a function version, used
+// to replace the creation of new containers.
+type functionSnapshot struct {
+	contID       container.ContainerID // paused or checkpointed container
+	checkpointID string
+	memoryMB     int64   // memory reserved by the paused container
+	ready        bool    // false while the snapshot is being prepared
+	expiration   int64   // the snapshot is removed if not used before
+	priority     float64 // eviction priority (see EvictionPolicy)
+}
+
+var snapshotMode = SNAPSHOT_NONE
+
+// snapshots of function versions, protected by the Resources lock
+var snapshots = make(map[string]*functionSnapshot)
+
+// containers restored from a snapshot, not used yet, protected by the Resources lock
+// (entries are removed by WasRestored or once the container is released)
+var restoredContainers = make(map[container.ContainerID]bool)
+
+func initSnapshots() {
+	snapshotMode = config.GetString(config.SNAPSHOT_MODE, SNAPSHOT_NONE)
+	switch snapshotMode {
+	case SNAPSHOT_NONE, SNAPSHOT_PAUSE:
+	case SNAPSHOT_CHECKPOINT:
+		if !container.SupportsCheckpoint() {
+			log.Printf("Checkpoints not supported by the container factory: snapshots disabled\n")
+			snapshotMode = SNAPSHOT_NONE
+		}
+	default:
+		log.Printf("Unknown snapshot mode: %s\n", snapshotMode)
+		snapshotMode = SNAPSHOT_NONE
+	}
+}
+
+// WasRestored returns true if a container has been restored from a snapshot
+// rather than created from scratch, and has not been used before.
+func WasRestored(contID container.ContainerID) bool {
+	Resources.Lock()
+	defer Resources.Unlock()
+	restored := restoredContainers[contID]
+	delete(restoredContainers, contID)
+	return restored
+}
+
+// restoreFromSnapshot replaces the creation of a container for the function
+// with the restore of its snapshot (if available), assuming that the required
+// resources have been already acquired.
+func restoreFromSnapshot(fun *function.Function) (container.ContainerID, bool) {
+	if snapshotMode == SNAPSHOT_NONE {
+		return "", false
+	}
+
+	Resources.Lock()
+	s, ok := snapshots[fun.VersionedName()]
+	if !ok || !s.ready {
+		Resources.Unlock()
+		return "", false
+	}
+	if snapshotMode == SNAPSHOT_PAUSE {
+		// the snapshot is consumed, and its memory handed over to the new container
+		delete(snapshots, fun.VersionedName())
+		releaseResources(0, s.memoryMB)
+	} else {
+		s.expiration = time.Now().Add(keepAliveFor(fun)).UnixNano()
+	}
+	Resources.Unlock()
+
+	var contID container.ContainerID
+	var err error
+	if snapshotMode == SNAPSHOT_PAUSE {
+		contID = s.contID
+		err = container.Unpause(contID)
+		if err != nil {
+			destroyInBackground([]container.ContainerID{contID})
+		}
+		// a new snapshot replaces the consumed one
+		inBackground(func() { prepareSnapshot(fun) })
+	} else {
+		var image string
+		image, err = getImageForFunction(fun)
+		if err == nil {
+			contID, err = container.RestoreContainer(image, fun.TarFunctionCode, containerOptions(fun), s.checkpointID)
+		}
+	}
+	if err != nil {
+		log.Printf("Restore from snapshot failed for %s: %v\n", fun.VersionedName(), err)
+		return "", false
+	}
+
+	Resources.Lock()
+	defer Resources.Unlock()
+	restoredContainers[contID] = true
+	getFunctionPool(fun).putBusyContainer(contID)
+	return contID, true
+}
+
+// prepareSnapshot creates the snapshot of a function version, if missing,
+// using free resources only.
+func prepareSnapshot(fun *function.Function) {
+	if snapshotMode == SNAPSHOT_NONE {
+		return
+	}
+
+	Resources.Lock()
+	if _, ok := snapshots[fun.VersionedName()]; ok || isRetired(fun) {
+		Resources.Unlock()
+		return
+	}
+	if !acquireResources(fun.CPUDemand, fun.MemoryMB, false) {
+		Resources.Unlock()
+		return
+	}
+	s := &functionSnapshot{}
+	snapshots[fun.VersionedName()] = s
+	Resources.Unlock()
+
+	contID, err := createSnapshotContainer(fun, s)
+
+	Resources.Lock()
+	defer Resources.Unlock()
+	if err != nil {
+		log.Printf("Could not snapshot %s: %v\n", fun.VersionedName(), err)
+		delete(snapshots, fun.VersionedName())
+		releaseResources(fun.CPUDemand, fun.MemoryMB)
+		if contID != "" {
+			destroyInBackground([]container.ContainerID{contID})
+		}
+		return
+	}
+
+	now := time.Now()
+	fp := getFunctionPool(fun)
+	candidate := EvictionCandidate{Function: fun, IdleSince: now, Uses: fp.uses, ColdStart: fp.coldStart}
+	s.contID = contID
+	s.ready = true
+	s.expiration = now.Add(keepAliveFor(fun)).UnixNano()
+	s.priority = evictionPolicy.Rank(&candidate)
+	if snapshotMode == SNAPSHOT_PAUSE {
+		// paused containers do not use CPU
+		s.memoryMB = fun.MemoryMB
+		releaseResources(fun.CPUDemand, 0)
+	} else {
+		// checkpointed containers are stopped
+		releaseResources(fun.CPUDemand, fun.MemoryMB)
+	}
+
+	if snapshots[fun.VersionedName()] != s {
+		// the function has been removed in the meantime
+		removeSnapshot(s)
+	} else {
+		log.Printf("Created snapshot of %s (%s)\n", fun.VersionedName(), snapshotMode)
+	}
+}
+
+// createSnapshotContainer starts a container and, once initialized, pauses or
+// checkpoints it.
+func createSnapshotContainer(fun *function.Function, s *functionSnapshot) (container.ContainerID, error) {
+	image, err := getImageForFunction(fun)
+	if err != nil {
+		return "", err
+	}
+	contID, err := container.NewContainer(image, fun.TarFunctionCode, containerOptions(fun))
+	if err != nil {
+		return "", err
+	}
+	if err = container.WaitReady(contID, snapshotInitTimeout); err != nil {
+		return contID, err
+	}
+
+	if snapshotMode == SNAPSHOT_PAUSE {
+		return contID, container.Pause(contID)
+	}
+	s.checkpointID = "sedge-" + strings.NewReplacer("/", "-", ":", "-").Replace(fun.VersionedName())
+	return contID, container.Checkpoint(contID, s.checkpointID)
+}
+
+// removeSnapshot destroys a snapshot, releasing its resources.
+// The function is NOT thread-safe.
+func removeSnapshot(s *functionSnapshot) {
+	releaseResources(0, s.memoryMB)
+	s.memoryMB = 0
+	contID, checkpointID := s.contID, s.checkpointID
+	inBackground(func() {
+		if checkpointID != "" {
+			if err := container.DeleteCheckpoint(contID, checkpointID); err != nil {
+				log.Printf("Could not delete checkpoint %s: %v\n", checkpointID, err)
+			}
+		}
+		destroyContainers([]container.ContainerID{contID})
+	})
+}
+
+// removeSnapshots destroys the snapshots of the function versions that
+// satisfy the given predicate. Snapshots being prepared are discarded
+// when ready.
+// The function is NOT thread-safe.
+func removeSnapshots(match func(funcName string, version int64) bool) {
+	for versionedName, s := range snapshots {
+		name, version, _, _ := function.ParseReference(versionedName)
+		if !match(name, version) {
+			continue
+		}
+		delete(snapshots, versionedName)
+		if s.ready {
+			removeSnapshot(s)
+		}
+	}
+}
+
+// removeExpiredSnapshots destroys the snapshots that have not been used
+// within the keep-alive time of their function.
+// The function is NOT thread-safe.
+func removeExpiredSnapshots(now int64) {
+	for versionedName, s := range snapshots {
+		if s.ready && now > s.expiration {
+			log.Printf("cleaner: Removing snapshot of %s\n", versionedName)
+			delete(snapshots, versionedName)
+			removeSnapshot(s)
+		}
+	}
+}
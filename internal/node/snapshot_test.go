@@ -0,0 +1,160 @@
+package node
+
+import (
+	"testing"
+	"time"
+
+	"github.com/grussorusso/serverledge/internal/function"
+)
+
+// waitSnapshot waits until the snapshot of a function is ready.
+func waitSnapshot(t *testing.T, f *function.Function) *functionSnapshot {
+	for i := 0; i < 100; i++ {
+		Resources.RLock()
+		s, ok := snapshots[f.VersionedName()]
+		ready := ok && s.ready
+		Resources.RUnlock()
+		if ready {
+			return s
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("snapshot of %s not ready", f.VersionedName())
+	return nil
+}
+
+func TestPauseSnapshot(t *testing.T) {
+	// reset after the background tasks complete (see setupPool)
+	snapshotMode = SNAPSHOT_PAUSE
+	t.Cleanup(func() { snapshotMode = SNAPSHOT_NONE })
+	factory := setupPool(t, 512, 4.0)
+	f := newTestFunction("f", 128)
+
+	first, err := NewContainer(f)
+	if err != nil || WasRestored(first) {
+		t.Fatalf("expected a regular cold start: %v", err)
+	}
+	s := waitSnapshot(t, f)
+	if !factory.IsPaused(s.contID) {
+		t.Fatalf("snapshot container not paused")
+	}
+	if Resources.AvailableMemMB != 256 || Resources.AvailableCPUs != 3.0 {
+		t.Fatalf("unexpected resources: %v", &Resources)
+	}
+
+	restored, err := NewContainer(f)
+	if err != nil || restored != s.contID || !WasRestored(restored) {
+		t.Fatalf("expected the snapshot to be restored: %v", err)
+	}
+	if factory.IsPaused(restored) {
+		t.Fatalf("restored container still paused")
+	}
+
+	// a new snapshot is prepared
+	waitSnapshot(t, f)
+	if factory.Created != 3 || Resources.AvailableMemMB != 128 || Resources.AvailableCPUs != 2.0 {
+		t.Fatalf("unexpected resources: %v (%d containers)", &Resources, factory.Created)
+	}
+
+	ShutdownWarmContainersFor(f)
+	if len(snapshots) != 0 || Resources.AvailableMemMB != 256 {
+		t.Fatalf("snapshot not removed: %v", &Resources)
+	}
+}
+
+func TestCheckpointSnapshot(t *testing.T) {
+	snapshotMode = SNAPSHOT_CHECKPOINT
+	t.Cleanup(func() { snapshotMode = SNAPSHOT_NONE })
+	factory := setupPool(t, 512, 4.0)
+	f := newTestFunction("f", 128)
+
+	if _, err := NewContainer(f); err != nil {
+		t.Fatalf("cold start failed: %v", err)
+	}
+	waitSnapshot(t, f)
+	// checkpointed containers do not hold resources
+	if Resources.AvailableMemMB != 384 || Resources.AvailableCPUs != 3.0 {
+		t.Fatalf("unexpected resources: %v", &Resources)
+	}
+
+	restored, err := NewContainer(f)
+	if err != nil || !WasRestored(restored) || factory.Restored != 1 {
+		t.Fatalf("expected a container restored from the checkpoint: %v", err)
+	}
+	if Resources.AvailableMemMB != 256 || Resources.AvailableCPUs != 2.0 {
+		t.Fatalf("unexpected resources: %v", &Resources)
+	}
+}
+
+func TestPauseSnapshotEviction(t *testing.T) {
+	snapshotMode = SNAPSHOT_PAUSE
+	t.Cleanup(func() { snapshotMode = SNAPSHOT_NONE })
+	setupPool(t, 256, 4.0)
+	f := newTestFunction("f", 128)
+
+	contID, err := NewContainer(f)
+	if err != nil {
+		t.Fatalf("cold start failed: %v", err)
+	}
+	waitSnapshot(t, f)
+	ReleaseContainer(contID, f)
+	if Resources.AvailableMemMB != 0 {
+		t.Fatalf("unexpected resources: %v", &Resources)
+	}
+
+	// both the warm container and the snapshot are evicted
+	g := newTestFunction("g", 256)
+	if _, err := NewContainer(g); err != nil {
+		t.Fatalf("snapshot not evicted: %v", err)
+	}
+	if len(snapshots) != 0 || WarmStatus()["f"] != 0 {
+		t.Fatalf("unexpected snapshots: %v", snapshots)
+	}
+}
+
+func TestPauseSnapshotExpiration(t *testing.T) {
+	snapshotMode = SNAPSHOT_PAUSE
+	t.Cleanup(func() { snapshotMode = SNAPSHOT_NONE })
+	setupPool(t, 256, 4.0)
+	f := newTestFunction("f", 128)
+	f.KeepAlive = 60
+
+	contID, err := NewContainer(f)
+	if err != nil {
+		t.Fatalf("cold start failed: %v", err)
+	}
+	s := waitSnapshot(t, f)
+	DiscardContainer(contID, f)
+
+	DeleteExpiredContainer()
+	if len(snapshots) != 1 {
+		t.Fatalf("snapshot removed before its expiration")
+	}
+	Resources.Lock()
+	s.expiration = time.Now().Add(-time.Second).UnixNano()
+	Resources.Unlock()
+	DeleteExpiredContainer()
+	if len(snapshots) != 0 || Resources.AvailableMemMB != 256 {
+		t.Fatalf("expired snapshot not removed: %v", &Resources)
+	}
+}
+
+func TestRestoredContainerDiscarded(t *testing.T) {
+	snapshotMode = SNAPSHOT_CHECKPOINT
+	t.Cleanup(func() { snapshotMode = SNAPSHOT_NONE })
+	setupPool(t, 512, 4.0)
+	f := newTestFunction("f", 128)
+
+	if _, err := NewContainer(f); err != nil {
+		t.Fatalf("cold start failed: %v", err)
+	}
+	waitSnapshot(t, f)
+	restored, err := NewContainer(f)
+	if err != nil {
+		t.Fatalf("restore failed: %v", err)
+	}
+	DiscardContainer(restored, f)
+	if len(restoredContainers) != 0 {
+		t.Errorf("restored container not forgotten")
+	}
+}
@@ -68,7 +68,7 @@ func handleUDPConnection(conn *net.UDPConn) {
 
 func getCurrentStatusInformation() (status []byte, err error) {
 	portNumber := config.GetInt("api.port", 1323)
-	url := fmt.Sprintf("http://%s:%d", utils.GetIpAddress().String(), portNumber)
+	url := fmt.Sprintf("%s://%s:%d", utils.APIScheme(), utils.GetIpAddress().String(), portNumber)
 	response := StatusInformation{
 		Url:                     url,
 		AvailableWarmContainers: node.WarmStatus(),
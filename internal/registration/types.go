@@ -23,7 +23,7 @@ type Registry struct {
 
 type StatusInformation struct {
 	Url                     string
-	AvailableWarmContainers map[string]int // <k, v> = <function name, warm container number>
+	AvailableWarmContainers map[string]int // <k, v> = <function versioned name, warm container number>
 	AvailableMemMB          int64
 	AvailableCPUs           float64
 	DropCount               int64
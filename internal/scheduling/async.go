@@ -3,39 +3,524 @@ package scheduling
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"math"
+	"sync/atomic"
+	"time"
 
+	"github.com/grussorusso/serverledge/internal/config"
 	"github.com/grussorusso/serverledge/internal/function"
+	"github.com/grussorusso/serverledge/internal/node"
 	"github.com/grussorusso/serverledge/utils"
 	clientv3 "go.etcd.io/etcd/client/v3"
 )
 
-func publishAsyncResponse(reqId string, response function.Response) {
+// Async requests are persisted in Etcd until they are served. A pending
+// request is claimed by a node through a key bound to the node lease: if the
+// node crashes, the claim expires and the request is recovered by any node
+// (including the restarted one). Requests are served at least once.
+const asyncResultsPrefix = "async/"
+const asyncPendingPrefix = "async-pending/"
+const asyncClaimsPrefix = "async-claims/"
+const asyncDeadPrefix = "async-dead/"
+
+// lease TTL (seconds) for the claims of this node
+const asyncClaimTTL = 10
+
+// period of the scan for unclaimed pending requests
+const asyncScanInterval = 5 * time.Second
+
+// Status of async requests
+const ASYNC_QUEUED = "queued"
+const ASYNC_SCHEDULED = "scheduled"
+const ASYNC_RUNNING = "running"
+const ASYNC_DONE = "done"
+
+// asyncJob is the persisted representation of an async request.
+type asyncJob struct {
+	ReqId           string
+	Namespace       string // namespace of the function, which owns the request
+	Function        string // function reference (see function.GetFunction)
+	Params          map[string]interface{}
+	Class           function.ServiceClass
+	MaxRespT        float64
+	CanDoOffloading bool
+	ReturnOutput    bool
+	CallbackURL     string
+	CallbackSecret  string // encrypted (see SealSecret)
+	TimeoutSeconds  float64
+	Arrival         time.Time
+	Status          string
+	Attempts        int
+	NextAttempt     time.Time
+	LastError       string
+
+	release func() // releases the admission slot of the request (if held by this node)
+}
+
+var asyncJobs chan *asyncJob
+
+var AsyncRequestExistsErr = errors.New("async request already exists")
+
+// asyncLease is the lease of the claims of this node (0 until obtained)
+var asyncLease atomic.Int64
+
+func pendingKey(reqId string) string {
+	return asyncPendingPrefix + reqId
+}
+
+func claimKey(reqId string) string {
+	return asyncClaimsPrefix + reqId
+}
+
+// startAsyncWorkers starts the workers that serve async requests. Pending
+// requests are recovered once a lease is obtained from Etcd, retrying
+// until it is reachable.
+func startAsyncWorkers() {
+	asyncJobs = make(chan *asyncJob, 500)
+	workers := config.GetInt(config.ASYNC_WORKERS, 16)
+	for i := 0; i < workers; i++ {
+		go asyncWorker()
+	}
+	log.Printf("Started %d async workers\n", workers)
+
+	go maintainAsyncLease()
+}
+
+// maintainAsyncLease obtains the lease of the claims of this node, and a new
+// one whenever it is lost (e.g., after Etcd has been unreachable for longer
+// than its TTL). Pending requests are scanned as long as a lease is held.
+func maintainAsyncLease() {
+	scanning := false
+	for {
+		var expired <-chan struct{}
+		for attempt := 1; ; attempt++ {
+			leaseID, lost, err := grantAsyncLease()
+			if err == nil {
+				asyncLease.Store(int64(leaseID))
+				expired = lost
+				break
+			}
+			backoff := asyncBackoff(attempt)
+			log.Printf("Async invocations not available (retrying in %v): %v\n", backoff, err)
+			time.Sleep(backoff)
+		}
+		log.Println("Async invocations available")
+		if !scanning {
+			go scanPendingRequests()
+			scanning = true
+		} else if err := claimPendingRequests(); err != nil {
+			// requests claimed through the lost lease are recovered
+			log.Printf("Scan of pending async requests failed: %v\n", err)
+		}
+
+		<-expired
+		asyncLease.Store(0)
+		log.Println("Lost the lease for async requests: claims will expire")
+	}
+}
+
+// grantAsyncLease obtains the lease of the claims of this node, and keeps
+// it alive. The returned channel is closed once the lease is lost.
+func grantAsyncLease() (clientv3.LeaseID, <-chan struct{}, error) {
 	etcdClient, err := utils.GetEtcdClient()
 	if err != nil {
-		log.Fatal("Client not available")
-		return
+		return 0, nil, err
 	}
 
-	ctx := context.Background()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	lease, err := etcdClient.Grant(ctx, asyncClaimTTL)
+	if err != nil {
+		return 0, nil, fmt.Errorf("could not obtain a lease: %v", err)
+	}
+	keepAliveCh, err := etcdClient.KeepAlive(context.Background(), lease.ID)
+	if err != nil {
+		return 0, nil, fmt.Errorf("could not keep the lease alive: %v", err)
+	}
+	lost := make(chan struct{})
+	go func() {
+		for range keepAliveCh {
+			// eat messages until keep alive channel closes
+		}
+		close(lost)
+	}()
+	return lease.ID, lost, nil
+}
 
-	resp, err := etcdClient.Grant(ctx, 1800)
+// EnqueueAsyncRequest persists a newly arrived async request, which will be
+// served by the workers of this node. Pending requests with the same ID are
+// not replaced (AsyncRequestExistsErr). If the request is enqueued, release
+// (if not nil) is called once it has been served (or moved to the
+// dead-letter area), so that the request holds its admission slot meanwhile.
+func EnqueueAsyncRequest(r *function.Request, release func()) error {
+	leaseID := clientv3.LeaseID(asyncLease.Load())
+	if leaseID == 0 {
+		return fmt.Errorf("async invocations are not available")
+	}
+	if err := r.Fun.ValidateParams(r.Params); err != nil {
+		return err
+	}
+	callbackSecret, err := SealSecret(r.CallbackSecret)
 	if err != nil {
-		log.Fatal(err)
+		return fmt.Errorf("%w: %v", InvalidCallbackErr, err)
+	}
+
+	job := &asyncJob{
+		ReqId:           r.Id(),
+		Namespace:       r.Fun.Namespace(),
+		Function:        r.Fun.VersionedName(),
+		Params:          r.Params,
+		Class:           r.Class,
+		MaxRespT:        r.MaxRespT,
+		CanDoOffloading: r.CanDoOffloading,
+		ReturnOutput:    r.ReturnOutput,
+		CallbackURL:     r.CallbackURL,
+		CallbackSecret:  callbackSecret,
+		TimeoutSeconds:  r.TimeoutSeconds,
+		Arrival:         r.Arrival,
+		Status:          ASYNC_QUEUED,
+		release:         release,
+	}
+
+	etcdClient, err := utils.GetEtcdClient()
+	if err != nil {
+		return err
+	}
+	payload, err := json.Marshal(job)
+	if err != nil {
+		return fmt.Errorf("could not marshal request: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	txnResp, err := etcdClient.Txn(ctx).
+		If(clientv3.Compare(clientv3.CreateRevision(pendingKey(job.ReqId)), "=", 0)).
+		Then(clientv3.OpPut(pendingKey(job.ReqId), string(payload)),
+			clientv3.OpPut(claimKey(job.ReqId), node.NodeIdentifier, clientv3.WithLease(leaseID))).
+		Commit()
+	if err != nil {
+		return fmt.Errorf("could not persist request: %v", err)
+	}
+	if !txnResp.Succeeded {
+		return AsyncRequestExistsErr
+	}
+
+	go func() { asyncJobs <- job }()
+	return nil
+}
+
+func asyncWorker() {
+	for job := range asyncJobs {
+		serveAsyncJob(job)
+	}
+}
+
+// serveAsyncJob executes a claimed request, possibly scheduling a retry.
+func serveAsyncJob(job *asyncJob) {
+	job.Attempts++
+	response, err := executeAsyncJob(job)
+	if err == nil {
+		if response != nil {
+			err = publishAsyncResponse(job, *response)
+		}
+		if err == nil {
+			completeAsyncJob(job)
+			job.releaseAdmission()
+			if response != nil {
+				notifyCallback(job, *response)
+			}
+			return
+		}
+	}
+
+	job.LastError = err.Error()
+	if !isRetriable(err) {
+		log.Printf("[%s] Async request failed: %v\n", job.ReqId, err)
+		deadLetterAsyncJob(job)
 		return
 	}
+	maxAttempts := config.GetInt(config.ASYNC_MAX_ATTEMPTS, 3)
+	if job.Attempts >= maxAttempts {
+		log.Printf("[%s] Async request failed %d times: %v\n", job.ReqId, job.Attempts, err)
+		deadLetterAsyncJob(job)
+		return
+	}
+
+	backoff := asyncBackoff(job.Attempts)
+	job.NextAttempt = time.Now().Add(backoff)
+	job.Status = ASYNC_QUEUED
+	log.Printf("[%s] Async request failed (attempt %d), retrying in %v: %v\n", job.ReqId, job.Attempts, backoff, err)
+	if err := updateAsyncJob(job); err != nil {
+		log.Printf("[%s] Could not update async request: %v\n", job.ReqId, err)
+	}
+	time.AfterFunc(backoff, func() { asyncJobs <- job })
+}
+
+// releaseAdmission releases the admission slot held by the request, if any.
+func (job *asyncJob) releaseAdmission() {
+	if job.release != nil {
+		job.release()
+		job.release = nil
+	}
+}
+
+// isRetriable returns false for the failures that would occur again if the
+// request were retried (e.g., invalid requests or failed functions).
+func isRetriable(err error) bool {
+	return !errors.Is(err, function.NotFoundErr) &&
+		!errors.Is(err, function.InvalidInputErr) &&
+		!errors.Is(err, function.InvalidOutputErr) &&
+		!errors.Is(err, QueueDeadlineErr) &&
+		!errors.Is(err, FunctionErr)
+}
 
-	key := fmt.Sprintf("async/%s", reqId)
-	payload, err := json.Marshal(response)
+// asyncBackoff returns the delay before the next attempt, which doubles
+// after every failure.
+func asyncBackoff(attempts int) time.Duration {
+	initial := config.GetFloat(config.ASYNC_BACKOFF, 1.0)
+	maxBackoff := config.GetFloat(config.ASYNC_MAX_BACKOFF, 60.0)
+	backoff := math.Min(initial*math.Pow(2, float64(attempts-1)), maxBackoff)
+	return time.Duration(backoff * float64(time.Second))
+}
+
+// executeAsyncJob schedules the request. A nil response is returned if the
+// request has been offloaded, as the response is published by the remote node.
+func executeAsyncJob(job *asyncJob) (*function.Response, error) {
+	fun, ok := function.GetFunction(job.Function)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", function.NotFoundErr, job.Function)
+	}
+	// the secret is needed in plain text if the request is offloaded
+	callbackSecret, err := OpenSecret(job.CallbackSecret)
 	if err != nil {
-		log.Printf("Could not marshal response: %v\n", err)
+		return nil, err
+	}
+
+	r := &function.Request{
+		Ctx:             context.WithValue(context.Background(), "ReqId", job.ReqId),
+		Fun:             fun,
+		Params:          job.Params,
+		Arrival:         time.Now(),
+		RequestQoS:      function.RequestQoS{Class: job.Class, MaxRespT: job.MaxRespT},
+		CanDoOffloading: job.CanDoOffloading,
+		Async:           true,
+		ReturnOutput:    job.ReturnOutput,
+		CallbackURL:     job.CallbackURL,
+		CallbackSecret:  callbackSecret,
+		TimeoutSeconds:  job.TimeoutSeconds,
+	}
+	return executeAsyncRequest(r, func(status string) { setAsyncStatus(job, status) })
+}
+
+// executeAsyncRequest schedules an async request, reporting its status
+// through setStatus once scheduled and once running.
+func executeAsyncRequest(r *function.Request, setStatus func(string)) (*function.Response, error) {
+	defer withDeadline(r)()
+
+	schedRequest := scheduledRequest{
+		Request:         r,
+		decisionChannel: make(chan schedDecision, 1)}
+	requests <- &schedRequest
+
+	// wait on channel for scheduling action
+	schedDecision, ok := <-schedRequest.decisionChannel
+	if !ok {
+		return nil, fmt.Errorf("could not schedule the request")
+	}
+
+	if schedDecision.action == DROP {
+		return nil, node.OutOfResourcesErr
+	} else if schedDecision.action == EXPIRE {
+		return nil, QueueDeadlineErr
+	}
+
+	setStatus(ASYNC_SCHEDULED)
+	if schedDecision.action == EXEC_REMOTE {
+		//log.Printf("Offloading request")
+		err := OffloadAsync(r, schedDecision.remoteHost)
+		completions <- &completionNotification{fun: r.Fun, remoteHost: schedDecision.remoteHost, offloadErr: err}
+		return nil, err
+	} else {
+		setStatus(ASYNC_RUNNING)
+		report, err := executeLocally(&schedRequest, schedDecision)
+		if err != nil {
+			return nil, err
+		}
+		return &function.Response{Success: true, ExecutionReport: report}, nil
+	}
+}
+
+// updateAsyncJob stores the current state of a claimed request.
+func updateAsyncJob(job *asyncJob) error {
+	etcdClient, err := utils.GetEtcdClient()
+	if err != nil {
+		return err
+	}
+	payload, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	_, err = etcdClient.Put(ctx, pendingKey(job.ReqId), string(payload))
+	return err
+}
+
+// setAsyncStatus updates the status of a request. Failures are not critical,
+// as they only affect the status reported to clients.
+func setAsyncStatus(job *asyncJob, status string) {
+	job.Status = status
+	if err := updateAsyncJob(job); err != nil {
+		log.Printf("[%s] Could not update async request status: %v\n", job.ReqId, err)
+	}
+}
+
+// completeAsyncJob removes a served request, unless it has been taken over
+// by another node (i.e., offloaded).
+func completeAsyncJob(job *asyncJob) {
+	etcdClient, err := utils.GetEtcdClient()
+	if err != nil {
+		log.Printf("[%s] Could not remove async request: %v\n", job.ReqId, err)
 		return
 	}
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	_, err = etcdClient.Txn(ctx).
+		If(clientv3.Compare(clientv3.Value(claimKey(job.ReqId)), "=", node.NodeIdentifier)).
+		Then(clientv3.OpDelete(pendingKey(job.ReqId)),
+			clientv3.OpDelete(claimKey(job.ReqId))).
+		Commit()
+	if err != nil {
+		log.Printf("[%s] Could not remove async request: %v\n", job.ReqId, err)
+	}
+}
 
-	_, err = etcdClient.Put(ctx, key, string(payload), clientv3.WithLease(resp.ID))
+// deadLetterAsyncJob moves a request that cannot be served to the
+// dead-letter area, and publishes a failure response.
+func deadLetterAsyncJob(job *asyncJob) {
+	job.releaseAdmission()
+	response := function.Response{Success: false}
+	if err := publishAsyncResponse(job, response); err != nil {
+		log.Printf("[%s] Could not publish failure: %v\n", job.ReqId, err)
+	}
+	notifyCallback(job, response)
+
+	etcdClient, err := utils.GetEtcdClient()
+	if err != nil {
+		log.Printf("[%s] Could not move async request to dead-letters: %v\n", job.ReqId, err)
+		return
+	}
+	payload, err := json.Marshal(job)
 	if err != nil {
-		log.Fatal(err)
+		log.Printf("[%s] Could not marshal async request: %v\n", job.ReqId, err)
 		return
 	}
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	_, err = etcdClient.Txn(ctx).Then(
+		clientv3.OpPut(asyncDeadPrefix+job.ReqId, string(payload)),
+		clientv3.OpDelete(pendingKey(job.ReqId)),
+		clientv3.OpDelete(claimKey(job.ReqId))).
+		Commit()
+	if err != nil {
+		log.Printf("[%s] Could not move async request to dead-letters: %v\n", job.ReqId, err)
+	}
+}
+
+// scanPendingRequests periodically claims pending requests that are not
+// owned by any node (e.g., after a crash).
+func scanPendingRequests() {
+	for {
+		if err := claimPendingRequests(); err != nil {
+			log.Printf("Scan of pending async requests failed: %v\n", err)
+		}
+		time.Sleep(asyncScanInterval)
+	}
+}
+
+func claimPendingRequests() error {
+	leaseID := clientv3.LeaseID(asyncLease.Load())
+	if leaseID == 0 {
+		return fmt.Errorf("no lease for claims")
+	}
+	etcdClient, err := utils.GetEtcdClient()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	resp, err := etcdClient.Get(ctx, asyncPendingPrefix, clientv3.WithPrefix())
+	if err != nil {
+		return err
+	}
+
+	for _, kv := range resp.Kvs {
+		var job asyncJob
+		if err := json.Unmarshal(kv.Value, &job); err != nil {
+			log.Printf("Invalid pending async request %s: %v\n", kv.Key, err)
+			continue
+		}
+
+		txnResp, err := etcdClient.Txn(ctx).
+			If(clientv3.Compare(clientv3.CreateRevision(claimKey(job.ReqId)), "=", 0),
+				clientv3.Compare(clientv3.ModRevision(pendingKey(job.ReqId)), "=", kv.ModRevision)).
+			Then(clientv3.OpPut(claimKey(job.ReqId), node.NodeIdentifier,
+				clientv3.WithLease(leaseID))).
+			Commit()
+		if err != nil {
+			return err
+		}
+		if !txnResp.Succeeded {
+			continue // owned by some node
+		}
+
+		log.Printf("[%s] Recovered pending async request\n", job.ReqId)
+		job.Status = ASYNC_QUEUED
+		delay := time.Until(job.NextAttempt)
+		if delay > 0 {
+			time.AfterFunc(delay, func() { asyncJobs <- &job })
+		} else {
+			go func() { asyncJobs <- &job }()
+		}
+	}
+
+	return nil
+}
+
+// asyncResult is the persisted representation of the response of an async
+// request.
+type asyncResult struct {
+	Namespace string // namespace owning the request (see asyncJob)
+	Response  json.RawMessage
+}
+
+func publishAsyncResponse(job *asyncJob, response function.Response) error {
+	etcdClient, err := utils.GetEtcdClient()
+	if err != nil {
+		return errors.New("etcd client not available")
+	}
+
+	ctx := context.Background()
+
+	resp, err := etcdClient.Grant(ctx, 1800)
+	if err != nil {
+		return err
+	}
+
+	key := asyncResultsPrefix + job.ReqId
+	encoded, err := json.Marshal(response)
+	if err != nil {
+		return fmt.Errorf("could not marshal response: %v", err)
+	}
+	payload, err := json.Marshal(asyncResult{Namespace: job.Namespace, Response: encoded})
+	if err != nil {
+		return fmt.Errorf("could not marshal response: %v", err)
+	}
+
+	_, err = etcdClient.Put(ctx, key, string(payload), clientv3.WithLease(resp.ID))
+	return err
 }
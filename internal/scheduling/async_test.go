@@ -0,0 +1,57 @@
+package scheduling
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/grussorusso/serverledge/internal/admission"
+	"github.com/grussorusso/serverledge/internal/function"
+)
+
+func TestAsyncJobHoldsAdmission(t *testing.T) {
+	c := admission.NewController(func(string) admission.Limits { return admission.Limits{MaxConcurrency: 1} },
+		func(string) admission.Limits { return admission.Limits{} })
+	release, err := c.Admit("f", "")
+	if err != nil {
+		t.Fatalf("request not admitted: %v", err)
+	}
+
+	job := &asyncJob{ReqId: "f-1", Function: "f:1", release: release}
+	if _, err := c.Admit("f", ""); err == nil {
+		t.Fatalf("expected the slot to be held by the async request")
+	}
+
+	// the slot is released only once
+	job.releaseAdmission()
+	job.releaseAdmission()
+	if _, err := c.Admit("f", ""); err != nil {
+		t.Errorf("slot not released after serving the async request: %v", err)
+	}
+	if _, err := c.Admit("f", ""); err == nil {
+		t.Errorf("slot released twice")
+	}
+}
+
+func TestDecodeAsyncResult(t *testing.T) {
+	value, _ := json.Marshal(asyncResult{Namespace: "ns", Response: json.RawMessage(`{"Success":true}`)})
+	if response := decodeAsyncResult(value, "ns"); string(response) != `{"Success":true}` {
+		t.Errorf("unexpected response: %s", response)
+	}
+	if response := decodeAsyncResult(value, "other"); response != nil {
+		t.Errorf("response visible from another namespace: %s", response)
+	}
+}
+
+func TestIsRetriable(t *testing.T) {
+	for _, err := range []error{function.NotFoundErr, function.InvalidInputErr, function.InvalidOutputErr,
+		QueueDeadlineErr, FunctionErr} {
+		if isRetriable(fmt.Errorf("%w: details", err)) {
+			t.Errorf("%v: expected a non-retriable error", err)
+		}
+	}
+	if !isRetriable(errors.New("node unavailable")) {
+		t.Errorf("expected a retriable error")
+	}
+}
@@ -0,0 +1,166 @@
+package scheduling
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/grussorusso/serverledge/utils"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+var AsyncRequestNotFoundErr = errors.New("async request not found")
+
+// AsyncStatusUpdate reports the status of an async request.
+type AsyncStatusUpdate struct {
+	Status   string
+	Response json.RawMessage `json:",omitempty"` // available when Status is done
+}
+
+// decodeAsyncResult returns the (JSON-encoded) response stored in a result
+// record, provided that the request is owned by the namespace.
+func decodeAsyncResult(value []byte, namespace string) []byte {
+	var result asyncResult
+	if err := json.Unmarshal(value, &result); err != nil || result.Namespace != namespace {
+		return nil
+	}
+	return result.Response
+}
+
+// GetAsyncResult returns the (JSON-encoded) response of an async request
+// owned by the namespace, waiting up to the given time for it to be
+// published. It returns nil if the response is not available.
+func GetAsyncResult(ctx context.Context, reqId string, namespace string, wait time.Duration) ([]byte, error) {
+	etcdClient, err := utils.GetEtcdClient()
+	if err != nil {
+		return nil, err
+	}
+
+	key := asyncResultsPrefix + reqId
+	res, err := etcdClient.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if len(res.Kvs) == 1 {
+		return decodeAsyncResult(res.Kvs[0].Value, namespace), nil
+	}
+	if wait <= 0 {
+		return nil, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, wait)
+	defer cancel()
+	watchChan := etcdClient.Watch(clientv3.WithRequireLeader(ctx), key, clientv3.WithRev(res.Header.Revision+1))
+	for watchResp := range watchChan {
+		if err := watchResp.Err(); err != nil {
+			return nil, err
+		}
+		for _, event := range watchResp.Events {
+			if event.Type == clientv3.EventTypePut {
+				return decodeAsyncResult(event.Kv.Value, namespace), nil
+			}
+		}
+	}
+
+	// timeout
+	return nil, nil
+}
+
+// WatchAsyncStatus returns a channel reporting the status transitions of an
+// async request owned by the namespace. The channel is closed once the
+// request is done, or ctx is canceled.
+func WatchAsyncStatus(ctx context.Context, reqId string, namespace string) (<-chan AsyncStatusUpdate, error) {
+	etcdClient, err := utils.GetEtcdClient()
+	if err != nil {
+		return nil, err
+	}
+
+	// atomically retrieve the current status
+	resultKey := asyncResultsPrefix + reqId
+	jobKey := pendingKey(reqId)
+	txnResp, err := etcdClient.Txn(ctx).Then(clientv3.OpGet(resultKey), clientv3.OpGet(jobKey)).Commit()
+	if err != nil {
+		return nil, err
+	}
+	results := txnResp.Responses[0].GetResponseRange().Kvs
+	jobs := txnResp.Responses[1].GetResponseRange().Kvs
+
+	updates := make(chan AsyncStatusUpdate, 1)
+	if len(results) > 0 {
+		response := decodeAsyncResult(results[0].Value, namespace)
+		if response == nil {
+			return nil, AsyncRequestNotFoundErr
+		}
+		updates <- AsyncStatusUpdate{Status: ASYNC_DONE, Response: response}
+		close(updates)
+		return updates, nil
+	}
+	if len(jobs) == 0 {
+		return nil, AsyncRequestNotFoundErr
+	}
+	var job asyncJob
+	if err := json.Unmarshal(jobs[0].Value, &job); err != nil {
+		return nil, fmt.Errorf("invalid async request: %v", err)
+	}
+	if job.Namespace != namespace {
+		return nil, AsyncRequestNotFoundErr
+	}
+	updates <- AsyncStatusUpdate{Status: job.Status}
+
+	ctx, cancel := context.WithCancel(clientv3.WithRequireLeader(ctx))
+	watchOpt := clientv3.WithRev(txnResp.Header.Revision + 1)
+	resultChan := etcdClient.Watch(ctx, resultKey, watchOpt)
+	jobChan := etcdClient.Watch(ctx, jobKey, watchOpt)
+
+	go func() {
+		defer close(updates)
+		defer cancel()
+
+		lastStatus := job.Status
+		send := func(u AsyncStatusUpdate) bool {
+			select {
+			case updates <- u:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		for {
+			select {
+			case watchResp, ok := <-resultChan:
+				if !ok || watchResp.Err() != nil {
+					return
+				}
+				for _, event := range watchResp.Events {
+					if event.Type == clientv3.EventTypePut {
+						send(AsyncStatusUpdate{Status: ASYNC_DONE, Response: decodeAsyncResult(event.Kv.Value, namespace)})
+						return
+					}
+				}
+			case watchResp, ok := <-jobChan:
+				if !ok || watchResp.Err() != nil {
+					return
+				}
+				for _, event := range watchResp.Events {
+					// deletions follow the publication of the result
+					if event.Type != clientv3.EventTypePut {
+						continue
+					}
+					var job asyncJob
+					if err := json.Unmarshal(event.Kv.Value, &job); err != nil || job.Status == lastStatus {
+						continue
+					}
+					lastStatus = job.Status
+					if !send(AsyncStatusUpdate{Status: job.Status}) {
+						return
+					}
+				}
+			}
+		}
+	}()
+
+	return updates, nil
+}
@@ -0,0 +1,290 @@
+package scheduling
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/grussorusso/serverledge/internal/config"
+	"github.com/grussorusso/serverledge/internal/function"
+	"golang.org/x/crypto/hkdf"
+)
+
+// HTTP headers of callback notifications
+const CALLBACK_REQID_HEADER = "X-Serverledge-Request-Id"
+const CALLBACK_TIMESTAMP_HEADER = "X-Serverledge-Timestamp"
+const CALLBACK_SIGNATURE_HEADER = "X-Serverledge-Signature"
+
+var InvalidCallbackErr = errors.New("invalid callback")
+var HostNotAllowedErr = errors.New("host not allowed")
+
+// addresses that are not public, besides loopback, private and link-local ones
+var reservedNetworks = []string{
+	"100.64.0.0/10", // shared address space (e.g., some metadata services)
+	"192.0.0.0/24",  // IETF protocol assignments
+	"198.18.0.0/15", // benchmarking
+}
+
+// SignCallback returns the signature of a callback payload sent at the given
+// time (Unix seconds), i.e., the hex-encoded HMAC-SHA256 of the timestamp,
+// a dot and the payload, computed with the given secret.
+func SignCallback(payload []byte, timestamp int64, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10) + "."))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// ValidateCallback checks that a callback URL uses HTTP(S) and refers to
+// an allowed host (see ValidateHost).
+// Secrets are accepted only if they can be encrypted (see SealSecret).
+func ValidateCallback(callbackURL string, secret string) error {
+	if callbackURL == "" {
+		return nil
+	}
+	u, err := url.Parse(callbackURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return fmt.Errorf("%w: only HTTP(S) URLs are allowed", InvalidCallbackErr)
+	}
+	if err = ValidateHost(u.Hostname()); err != nil {
+		return fmt.Errorf("%w: %v", InvalidCallbackErr, err)
+	}
+	if secret != "" && !SecretsEnabled() {
+		return fmt.Errorf("%w: secrets are not accepted, as %s is not configured", InvalidCallbackErr,
+			config.CALLBACK_KEY)
+	}
+	return nil
+}
+
+// ValidateHost checks that a host given by users (e.g., in callback URLs or
+// trigger sources) can be contacted by nodes: either it is listed in
+// config.CALLBACK_ALLOWED_HOSTS or, if the list is not configured, it only
+// has public addresses.
+func ValidateHost(hostname string) error {
+	if allowedHosts := config.GetStringSlice(config.CALLBACK_ALLOWED_HOSTS, nil); allowedHosts != nil {
+		for _, host := range allowedHosts {
+			if host == hostname {
+				return nil
+			}
+		}
+		return fmt.Errorf("host %s is not allowed", hostname)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, hostname)
+	if err != nil {
+		return err
+	}
+	for _, addr := range addrs {
+		if !isPublicIP(addr.IP) {
+			return fmt.Errorf("host %s is not public", hostname)
+		}
+	}
+	return nil
+}
+
+// RestrictDialer makes a dialer only connect to public addresses, unless
+// allowed hosts are configured (see ValidateHost), as DNS answers may change
+// after the validation of a host.
+func RestrictDialer(dialer *net.Dialer) *net.Dialer {
+	dialer.Control = func(network, address string, _ syscall.RawConn) error {
+		if config.GetStringSlice(config.CALLBACK_ALLOWED_HOSTS, nil) != nil {
+			return nil
+		}
+		host, _, err := net.SplitHostPort(address)
+		if err != nil {
+			return err
+		}
+		if ip := net.ParseIP(host); ip == nil || !isPublicIP(ip) {
+			return fmt.Errorf("%w: address %s is not public", HostNotAllowedErr, host)
+		}
+		return nil
+	}
+	return dialer
+}
+
+func isPublicIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() {
+		return false
+	}
+	for _, cidr := range reservedNetworks {
+		if _, network, _ := net.ParseCIDR(cidr); network.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// SecretsEnabled tells whether secrets can be encrypted (see SealSecret).
+func SecretsEnabled() bool {
+	return callbackKey() != nil
+}
+
+// label of the key derived from the cluster key to encrypt secrets
+const callbackKeyLabel = "serverledge callback secrets"
+
+// callbackKey returns the key used to encrypt secrets (nil if not
+// configured). Unless a dedicated key is configured, a key is derived from
+// the cluster key, so that the latter is not used for different purposes.
+func callbackKey() []byte {
+	if key := config.GetString(config.CALLBACK_KEY, ""); key != "" {
+		hash := sha256.Sum256([]byte(key))
+		return hash[:]
+	}
+	clusterKey := config.GetString(config.AUTH_CLUSTER_KEY, "")
+	if clusterKey == "" {
+		return nil
+	}
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, []byte(clusterKey), nil, []byte(callbackKeyLabel)), key); err != nil {
+		return nil
+	}
+	return key
+}
+
+func callbackCipher() (cipher.AEAD, error) {
+	key := callbackKey()
+	if key == nil {
+		return nil, fmt.Errorf("%s is not configured", config.CALLBACK_KEY)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// SealSecret encrypts a secret (e.g., of a callback or a trigger source), so
+// that it can be stored in Etcd and decrypted by any node (sharing the same key).
+func SealSecret(secret string) (string, error) {
+	if secret == "" {
+		return "", nil
+	}
+	aead, err := callbackCipher()
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(aead.Seal(nonce, nonce, []byte(secret), nil)), nil
+}
+
+// OpenSecret decrypts a secret encrypted by SealSecret.
+func OpenSecret(sealed string) (string, error) {
+	if sealed == "" {
+		return "", nil
+	}
+	aead, err := callbackCipher()
+	if err != nil {
+		return "", err
+	}
+	data, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil || len(data) < aead.NonceSize() {
+		return "", fmt.Errorf("invalid secret")
+	}
+	secret, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], nil)
+	if err != nil {
+		return "", fmt.Errorf("could not decrypt secret: %v", err)
+	}
+	return string(secret), nil
+}
+
+// notifyCallback asynchronously POSTs the response of an async request to its
+// callback URL (if any), retrying upon failure.
+func notifyCallback(job *asyncJob, response function.Response) {
+	if job.CallbackURL == "" {
+		return
+	}
+
+	payload, err := json.Marshal(response)
+	if err != nil {
+		log.Printf("[%s] Could not marshal callback payload: %v\n", job.ReqId, err)
+		return
+	}
+	secret, err := OpenSecret(job.CallbackSecret)
+	if err != nil {
+		log.Printf("[%s] Could not notify callback: %v\n", job.ReqId, err)
+		return
+	}
+
+	go func() {
+		maxAttempts := config.GetInt(config.CALLBACK_MAX_ATTEMPTS, 5)
+		for attempt := 1; ; attempt++ {
+			err := deliverCallback(job.ReqId, job.CallbackURL, secret, payload)
+			if err == nil {
+				return
+			}
+			if attempt >= maxAttempts || errors.Is(err, InvalidCallbackErr) || errors.Is(err, HostNotAllowedErr) {
+				log.Printf("[%s] Callback failed %d times: %v\n", job.ReqId, attempt, err)
+				return
+			}
+			time.Sleep(asyncBackoff(attempt))
+		}
+	}()
+}
+
+func deliverCallback(reqId string, callbackURL string, secret string, payload []byte) error {
+	// the URL may have been accepted by another node
+	if err := ValidateCallback(callbackURL, ""); err != nil {
+		return err
+	}
+	timeout := time.Duration(config.GetInt(config.CALLBACK_TIMEOUT, 10)) * time.Second
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, callbackURL, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(CALLBACK_REQID_HEADER, reqId)
+	if secret != "" {
+		timestamp := time.Now().Unix()
+		req.Header.Set(CALLBACK_TIMESTAMP_HEADER, strconv.FormatInt(timestamp, 10))
+		req.Header.Set(CALLBACK_SIGNATURE_HEADER, SignCallback(payload, timestamp, secret))
+	}
+
+	resp, err := callbackClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("callback returned: %v", resp.StatusCode)
+	}
+	return nil
+}
+
+// callbackClient is the HTTP client of callbacks, which does not follow
+// redirects and, unless allowed hosts are configured, only connects to public
+// addresses (see RestrictDialer). Deliveries are bounded by their context.
+var callbackClient = &http.Client{
+	Transport: &http.Transport{
+		DialContext:     RestrictDialer(&net.Dialer{}).DialContext,
+		IdleConnTimeout: 90 * time.Second,
+		MaxIdleConns:    100,
+	},
+	CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
@@ -0,0 +1,114 @@
+package scheduling
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/grussorusso/serverledge/internal/config"
+	"github.com/spf13/viper"
+)
+
+// allowCallbackHosts configures the hosts callbacks may refer to.
+func allowCallbackHosts(t *testing.T, hosts ...string) {
+	viper.Set(config.CALLBACK_ALLOWED_HOSTS, hosts)
+	t.Cleanup(func() { viper.Set(config.CALLBACK_ALLOWED_HOSTS, nil) })
+}
+
+func TestDeliverCallback(t *testing.T) {
+	allowCallbackHosts(t, "127.0.0.1")
+	payload := []byte(`{"Success":true}`)
+	var signature, timestamp, reqId string
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		signature = r.Header.Get(CALLBACK_SIGNATURE_HEADER)
+		timestamp = r.Header.Get(CALLBACK_TIMESTAMP_HEADER)
+		reqId = r.Header.Get(CALLBACK_REQID_HEADER)
+		body, _ = io.ReadAll(r.Body)
+	}))
+	defer server.Close()
+
+	if err := deliverCallback("req-1", server.URL, "secret", payload); err != nil {
+		t.Fatalf("delivery failed: %v", err)
+	}
+	if reqId != "req-1" || string(body) != string(payload) {
+		t.Errorf("unexpected notification: %s %s", reqId, body)
+	}
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		t.Fatalf("invalid timestamp: %s", timestamp)
+	}
+	if signature != SignCallback(payload, ts, "secret") || signature == SignCallback(payload, ts, "other") ||
+		signature == SignCallback(payload, ts+1, "secret") {
+		t.Errorf("unexpected signature: %s", signature)
+	}
+}
+
+func TestDeliverCallbackFailure(t *testing.T) {
+	allowCallbackHosts(t, "127.0.0.1")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	if err := deliverCallback("req-1", server.URL, "", []byte("{}")); err == nil {
+		t.Fatalf("expected the delivery to fail")
+	}
+}
+
+func TestValidateCallback(t *testing.T) {
+	for _, u := range []string{"ftp://93.184.216.34/", "http://127.0.0.1:8080/", "http://localhost/",
+		"http://169.254.169.254/latest/meta-data", "http://10.0.0.1/", "http://[::1]/", "/relative"} {
+		if err := ValidateCallback(u, ""); !errors.Is(err, InvalidCallbackErr) {
+			t.Errorf("%s: expected InvalidCallbackErr, got %v", u, err)
+		}
+	}
+	if err := ValidateCallback("https://93.184.216.34/hook", ""); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	// internal hosts can be explicitly allowed
+	allowCallbackHosts(t, "127.0.0.1")
+	if err := ValidateCallback("http://127.0.0.1:8080/", ""); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := ValidateCallback("https://93.184.216.34/hook", ""); !errors.Is(err, InvalidCallbackErr) {
+		t.Errorf("expected InvalidCallbackErr, got %v", err)
+	}
+}
+
+func TestSealSecret(t *testing.T) {
+	if _, err := SealSecret("secret"); err == nil {
+		t.Errorf("expected an error without key")
+	}
+	viper.Set(config.CALLBACK_KEY, "key")
+	t.Cleanup(func() { viper.Set(config.CALLBACK_KEY, nil) })
+
+	sealed, err := SealSecret("secret")
+	if err != nil || sealed == "" || sealed == "secret" {
+		t.Fatalf("unexpected sealed secret: %s (%v)", sealed, err)
+	}
+	if secret, err := OpenSecret(sealed); err != nil || secret != "secret" {
+		t.Errorf("unexpected secret: %s (%v)", secret, err)
+	}
+}
+
+func TestCallbackKeyDerivation(t *testing.T) {
+	viper.Set(config.AUTH_CLUSTER_KEY, "cluster")
+	t.Cleanup(func() { viper.Set(config.AUTH_CLUSTER_KEY, nil) })
+
+	// the cluster key is not used as it is
+	derived := callbackKey()
+	hash := sha256.Sum256([]byte("cluster"))
+	if len(derived) != 32 || bytes.Equal(derived, hash[:]) {
+		t.Errorf("expected a derived key, got %x", derived)
+	}
+	if !bytes.Equal(derived, callbackKey()) {
+		t.Errorf("expected a deterministic key")
+	}
+}
@@ -1,20 +1,29 @@
 package scheduling
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"github.com/grussorusso/serverledge/internal/function"
 	"time"
 
 	"github.com/grussorusso/serverledge/internal/container"
 	"github.com/grussorusso/serverledge/internal/executor"
+	"github.com/grussorusso/serverledge/internal/node"
 )
 
 const HANDLER_DIR = "/app"
 
+var TimeoutErr = errors.New("function execution timed out")
+var FunctionErr = errors.New("function execution failed")
+
 // Execute serves a request on the specified container.
 func Execute(contID container.ContainerID, r *scheduledRequest, isWarm bool) (function.ExecutionReport, error) {
 	//log.Printf("[%s] Executing on container: %v", r.Fun, contID)
 
+	// checked upfront, as the container is marked as used
+	restored := !isWarm && node.WasRestored(contID)
+
 	var req executor.InvocationRequest
 	if r.Fun.Runtime == container.CUSTOM_RUNTIME {
 		req = executor.InvocationRequest{
@@ -32,27 +41,54 @@ func Execute(contID container.ContainerID, r *scheduledRequest, isWarm bool) (fu
 		}
 	}
 
+	// the executor kills the function when the deadline expires
+	if deadline, ok := r.Ctx.Deadline(); ok {
+		req.Timeout = time.Until(deadline).Seconds()
+		if req.Timeout <= 0 {
+			completions <- &completionNotification{fun: r.Fun, contID: contID, executionReport: nil}
+			return function.ExecutionReport{}, TimeoutErr
+		}
+	}
+
 	t0 := time.Now()
 	initTime := t0.Sub(r.Arrival).Seconds()
 
-	response, invocationWait, err := container.Execute(contID, &req)
+	response, invocationWait, err := container.Execute(r.Ctx, contID, &req)
 	if err != nil {
+		// the executor may still be running the function: the container
+		// cannot be reused
+		discard := r.Ctx.Err() != nil
 		// notify scheduler
-		completions <- &completionNotification{fun: r.Fun, contID: contID, executionReport: nil}
+		completions <- &completionNotification{fun: r.Fun, contID: contID, executionReport: nil, discard: discard}
+		if errors.Is(err, context.DeadlineExceeded) {
+			return function.ExecutionReport{}, TimeoutErr
+		}
 		return function.ExecutionReport{}, fmt.Errorf("[%s] Execution failed: %v", r, err)
 	}
 
 	if !response.Success {
 		// notify scheduler
 		completions <- &completionNotification{fun: r.Fun, contID: contID, executionReport: nil}
-		return function.ExecutionReport{}, fmt.Errorf("Function execution failed")
+		if response.TimedOut {
+			return function.ExecutionReport{}, TimeoutErr
+		}
+		return function.ExecutionReport{}, FunctionErr
+	}
+
+	startType := function.COLD_START
+	if isWarm {
+		startType = function.WARM_START
+	} else if restored {
+		startType = function.RESTORED_START
 	}
 
 	report := function.ExecutionReport{Result: response.Result,
 		Output:       response.Output,
 		IsWarmStart:  isWarm,
+		StartType:    startType,
 		Duration:     time.Now().Sub(t0).Seconds() - invocationWait.Seconds(),
-		ResponseTime: time.Now().Sub(r.Arrival).Seconds()}
+		ResponseTime: time.Now().Sub(r.Arrival).Seconds(),
+		QueueTime:    r.queueWait.Seconds()}
 
 	// initializing containers may require invocation retries, adding
 	// latency
@@ -61,5 +97,8 @@ func Execute(contID container.ContainerID, r *scheduledRequest, isWarm bool) (fu
 	// notify scheduler
 	completions <- &completionNotification{fun: r.Fun, contID: contID, executionReport: &report}
 
+	if err = r.Fun.ValidateResult(report.Result); err != nil {
+		return function.ExecutionReport{}, err
+	}
 	return report, nil
 }
@@ -2,20 +2,31 @@ package scheduling
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/grussorusso/serverledge/internal/client"
+	"github.com/grussorusso/serverledge/internal/config"
 	"github.com/grussorusso/serverledge/internal/function"
 	"github.com/grussorusso/serverledge/internal/node"
 	"github.com/grussorusso/serverledge/internal/registration"
 )
 
 const SCHED_ACTION_OFFLOAD = "O"
+const SCHED_ACTION_OFFLOAD_CLOUD = SCHED_ACTION_OFFLOAD + "C"
+const SCHED_ACTION_OFFLOAD_EDGE = SCHED_ACTION_OFFLOAD + "E"
+
+// isOffloaded returns true if the report refers to a request served by a remote node.
+func isOffloaded(report *function.ExecutionReport) bool {
+	return strings.HasPrefix(report.SchedAction, SCHED_ACTION_OFFLOAD)
+}
 
 func pickEdgeNodeForOffloading(r *scheduledRequest) (url string) {
 	nearbyServersMap := registration.Reg.NearbyServersMap
@@ -24,7 +35,7 @@ func pickEdgeNodeForOffloading(r *scheduledRequest) (url string) {
 	}
 	//first, search for warm container
 	for _, v := range nearbyServersMap {
-		if v.AvailableWarmContainers[r.Fun.Name] != 0 && v.AvailableCPUs >= r.Request.Fun.CPUDemand {
+		if v.AvailableWarmContainers[r.Fun.VersionedName()] != 0 && v.AvailableCPUs >= r.Request.Fun.CPUDemand {
 			return v.Url
 		}
 	}
@@ -37,25 +48,54 @@ func pickEdgeNodeForOffloading(r *scheduledRequest) (url string) {
 	return ""
 }
 
+// newOffloadingRequest prepares a request to invoke a function on a remote node.
+func newOffloadingRequest(ctx context.Context, r *function.Request, serverUrl string, body []byte) (*http.Request, error) {
+	namespace, ref := function.SplitName(r.Fun.VersionedName())
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, serverUrl+"/invoke/"+ref, bytes.NewBuffer(body))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set(client.NAMESPACE_HEADER, namespace)
+	if clusterKey := config.GetString(config.AUTH_CLUSTER_KEY, ""); clusterKey != "" {
+		httpReq.Header.Set(client.API_KEY_HEADER, clusterKey)
+	}
+	return httpReq, nil
+}
+
 func Offload(r *function.Request, serverUrl string) (function.ExecutionReport, error) {
 	// Prepare request
 	request := client.InvocationRequest{Params: r.Params, QoSClass: int64(r.Class), QoSMaxRespT: r.MaxRespT}
+	if deadline, ok := r.Ctx.Deadline(); ok {
+		// the remote node enforces the remaining time
+		request.TimeoutSeconds = time.Until(deadline).Seconds()
+		if request.TimeoutSeconds <= 0 {
+			return function.ExecutionReport{}, TimeoutErr
+		}
+	}
 	invocationBody, err := json.Marshal(request)
 	if err != nil {
 		log.Print(err)
 		return function.ExecutionReport{}, err
 	}
+	httpReq, err := newOffloadingRequest(r.Ctx, r, serverUrl, invocationBody)
+	if err != nil {
+		return function.ExecutionReport{}, err
+	}
 	sendingTime := time.Now() // used to compute latency later on
-	resp, err := offloadingClient.Post(serverUrl+"/invoke/"+r.Fun.Name, "application/json",
-		bytes.NewBuffer(invocationBody))
+	resp, err := offloadingClient.Do(httpReq)
 
-	if err != nil {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return function.ExecutionReport{}, TimeoutErr
+	} else if err != nil {
 		log.Print(err)
 		return function.ExecutionReport{}, err
 	}
 	if resp.StatusCode != http.StatusOK {
 		if resp.StatusCode == http.StatusTooManyRequests {
 			return function.ExecutionReport{}, node.OutOfResourcesErr
+		} else if resp.StatusCode == http.StatusGatewayTimeout {
+			return function.ExecutionReport{}, TimeoutErr
 		}
 		return function.ExecutionReport{}, fmt.Errorf("Remote returned: %v", resp.StatusCode)
 	}
@@ -76,10 +116,13 @@ func Offload(r *function.Request, serverUrl string) (function.ExecutionReport, e
 	execReport := &response.ExecutionReport
 	execReport.ResponseTime = now.Sub(r.Arrival).Seconds()
 
-	// TODO: check how this is used in the QoSAware policy
 	// It was originially computed as "report.Arrival - sendingTime"
 	execReport.OffloadLatency = now.Sub(sendingTime).Seconds() - execReport.Duration - execReport.InitTime
-	execReport.SchedAction = SCHED_ACTION_OFFLOAD
+	if serverUrl == remoteServerUrl {
+		execReport.SchedAction = SCHED_ACTION_OFFLOAD_CLOUD
+	} else {
+		execReport.SchedAction = SCHED_ACTION_OFFLOAD_EDGE
+	}
 
 	return response.ExecutionReport, nil
 }
@@ -87,16 +130,24 @@ func Offload(r *function.Request, serverUrl string) (function.ExecutionReport, e
 func OffloadAsync(r *function.Request, serverUrl string) error {
 	// Prepare request
 	request := client.InvocationRequest{Params: r.Params,
-		QoSClass:    int64(r.Class),
-		QoSMaxRespT: r.MaxRespT,
-		Async:       true}
+		QoSClass:       int64(r.Class),
+		QoSMaxRespT:    r.MaxRespT,
+		Async:          true,
+		ReturnOutput:   r.ReturnOutput,
+		CallbackURL:    r.CallbackURL,
+		CallbackSecret: r.CallbackSecret,
+		ReqId:          r.Id(),
+		TimeoutSeconds: r.TimeoutSeconds}
 	invocationBody, err := json.Marshal(request)
 	if err != nil {
 		log.Print(err)
 		return err
 	}
-	resp, err := offloadingClient.Post(serverUrl+"/invoke/"+r.Fun.Name, "application/json",
-		bytes.NewBuffer(invocationBody))
+	httpReq, err := newOffloadingRequest(context.Background(), r, serverUrl, invocationBody)
+	if err != nil {
+		return err
+	}
+	resp, err := offloadingClient.Do(httpReq)
 
 	if err != nil {
 		log.Print(err)
@@ -106,6 +157,6 @@ func OffloadAsync(r *function.Request, serverUrl string) error {
 		return fmt.Errorf("Remote returned: %v", resp.StatusCode)
 	}
 
-	// there is nothing to wait for
+	// there is nothing to wait for: the remote node took over the request
 	return nil
 }
@@ -7,3 +7,9 @@ type Policy interface {
 	OnCompletion(fun *function.Function, executionReport *function.ExecutionReport)
 	OnArrival(request *scheduledRequest)
 }
+
+// OffloadObserver is implemented by the policies that track the outcome of
+// offloading requests to each node (err is nil upon success).
+type OffloadObserver interface {
+	OnOffload(remoteHost string, err error)
+}
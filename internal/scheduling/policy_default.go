@@ -2,27 +2,41 @@ package scheduling
 
 import (
 	"errors"
-	"github.com/grussorusso/serverledge/internal/function"
 	"log"
+	"time"
+
+	"github.com/grussorusso/serverledge/internal/function"
 
 	"github.com/grussorusso/serverledge/internal/config"
+	"github.com/grussorusso/serverledge/internal/metrics"
 	"github.com/grussorusso/serverledge/internal/node"
 )
 
 type DefaultLocalPolicy struct {
-	queue queue
+	queue   queue
+	maxWait time.Duration // max. time spent in the queue (0 -> unbounded)
 }
 
 func (p *DefaultLocalPolicy) Init() {
 	queueCapacity := config.GetInt(config.SCHEDULER_QUEUE_CAPACITY, 0)
 	if queueCapacity > 0 {
-		log.Printf("Configured queue with capacity %d\n", queueCapacity)
-		p.queue = NewFIFOQueue(queueCapacity)
+		queuePolicy := config.GetString(config.SCHEDULER_QUEUE_POLICY, "priority")
+		log.Printf("Configured %s queue with capacity %d\n", queuePolicy, queueCapacity)
+		if queuePolicy == "fifo" {
+			p.queue = NewFIFOQueue(queueCapacity)
+		} else {
+			p.queue = NewPriorityQueue(queueCapacity)
+		}
+		maxWait := config.GetFloat(config.SCHEDULER_QUEUE_MAX_WAIT, 0)
+		p.maxWait = time.Duration(maxWait * float64(time.Second))
 	} else {
 		p.queue = nil
 	}
 }
 
+// OnCompletion serves queued requests in order, skipping those that cannot
+// be placed with the available resources, so that they do not block
+// the others.
 func (p *DefaultLocalPolicy) OnCompletion(_ *function.Function, _ *function.ExecutionReport) {
 	if p.queue == nil {
 		return
@@ -34,20 +48,38 @@ func (p *DefaultLocalPolicy) OnCompletion(_ *function.Function, _ *function.Exec
 		return
 	}
 
-	req := p.queue.Front()
+	now := time.Now()
+	blocked := make(map[string]bool) // functions that cannot be placed
+	for _, req := range p.queue.Requests() {
+		if !req.queueDeadline.IsZero() && now.After(req.queueDeadline) {
+			p.expire(req)
+			continue
+		}
+		if blocked[req.Fun.Name] {
+			continue
+		}
+		if !p.tryDequeue(req) {
+			blocked[req.Fun.Name] = true
+		}
+	}
+}
 
+// tryDequeue tries to place a queued request, removing it from the queue
+// unless resources are not available.
+// The function is NOT thread-safe.
+func (p *DefaultLocalPolicy) tryDequeue(req *scheduledRequest) bool {
 	containerID, err := node.AcquireWarmContainer(req.Fun)
 	if err == nil {
-		p.queue.Dequeue()
+		p.dequeue(req)
 		log.Printf("[%s] Warm start from the queue (length=%d)\n", req, p.queue.Len())
 		execLocally(req, containerID, true)
-		return
+		return true
 	}
 
 	if errors.Is(err, node.NoWarmFoundErr) {
 		if node.AcquireResources(req.Fun.CPUDemand, req.Fun.MemoryMB, true) {
 			log.Printf("[%s] Cold start from the queue\n", req)
-			p.queue.Dequeue()
+			p.dequeue(req)
 
 			// This avoids blocking the thread during the cold
 			// start, but also allows us to check for resource
@@ -60,13 +92,16 @@ func (p *DefaultLocalPolicy) OnCompletion(_ *function.Function, _ *function.Exec
 					execLocally(req, newContainer, false)
 				}
 			}()
-			return
+			return true
 		}
+		return false
 	} else if errors.Is(err, node.OutOfResourcesErr) {
+		return false
 	} else {
 		// other error
-		p.queue.Dequeue()
+		p.dequeue(req)
 		dropRequest(req)
+		return true
 	}
 }
 
@@ -93,7 +128,7 @@ func (p *DefaultLocalPolicy) OnArrival(r *scheduledRequest) {
 	if p.queue != nil {
 		p.queue.Lock()
 		defer p.queue.Unlock()
-		if p.queue.Enqueue(r) {
+		if p.enqueue(r) {
 			log.Printf("[%s] Added to queue (length=%d)\n", r, p.queue.Len())
 			return
 		}
@@ -101,3 +136,69 @@ func (p *DefaultLocalPolicy) OnArrival(r *scheduledRequest) {
 
 	dropRequest(r)
 }
+
+// enqueue adds a request to the queue, and makes it expire once its
+// deadline (if any) or the max. waiting time has passed.
+// The function is NOT thread-safe.
+func (p *DefaultLocalPolicy) enqueue(r *scheduledRequest) bool {
+	if !p.queue.Enqueue(r) {
+		return false
+	}
+	if metrics.Enabled {
+		metrics.SetQueueLength(p.queue.Len())
+	}
+
+	r.queued = time.Now()
+	r.dequeued = make(chan struct{})
+	r.queueDeadline = time.Time{}
+	if deadline, ok := r.Deadline(); ok {
+		r.queueDeadline = deadline
+	}
+	if p.maxWait > 0 && (r.queueDeadline.IsZero() || r.queued.Add(p.maxWait).Before(r.queueDeadline)) {
+		r.queueDeadline = r.queued.Add(p.maxWait)
+	}
+
+	go func() {
+		var expiration <-chan time.Time
+		if !r.queueDeadline.IsZero() {
+			timer := time.NewTimer(time.Until(r.queueDeadline))
+			defer timer.Stop()
+			expiration = timer.C
+		}
+		select {
+		case <-expiration:
+		case <-r.Ctx.Done():
+		case <-r.dequeued:
+			return
+		}
+		p.queue.Lock()
+		defer p.queue.Unlock()
+		p.expire(r)
+	}()
+	return true
+}
+
+// dequeue removes a request from the queue, returning false if it is
+// not queued anymore.
+// The function is NOT thread-safe.
+func (p *DefaultLocalPolicy) dequeue(r *scheduledRequest) bool {
+	if !p.queue.Remove(r) {
+		return false
+	}
+	close(r.dequeued)
+	r.queueWait = time.Since(r.queued)
+	if metrics.Enabled {
+		metrics.SetQueueLength(p.queue.Len())
+		metrics.AddQueueTimeValue(r.Fun.Name, r.queueWait.Seconds())
+	}
+	return true
+}
+
+// expire drops a request that waited too long in the queue.
+// The function is NOT thread-safe.
+func (p *DefaultLocalPolicy) expire(r *scheduledRequest) {
+	if p.dequeue(r) {
+		log.Printf("[%s] Deadline exceeded in the queue\n", r)
+		expireRequest(r)
+	}
+}
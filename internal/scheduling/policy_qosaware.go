@@ -0,0 +1,247 @@
+package scheduling
+
+import (
+	"log"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/grussorusso/serverledge/internal/config"
+	"github.com/grussorusso/serverledge/internal/function"
+	"github.com/grussorusso/serverledge/internal/node"
+)
+
+// smoothing factor for the exponential moving averages of the estimates
+const qosEstimateAlpha = 0.2
+
+// offloading options not learned yet are explored by one request out of
+// qosExploreEvery, so that unreachable nodes are not tried by every request
+const qosExploreEvery = 10
+
+// max. time offloading to a failing node is avoided
+const qosMaxOffloadBackoff = 60 * time.Second
+
+// execOption identifies one of the possible ways to serve a request.
+type execOption int
+
+const (
+	optLocalWarm execOption = iota
+	optLocalCold
+	optEdgeOffload
+	optCloudOffload
+)
+
+// candidate is a feasible execution option, along with its expected response time.
+type candidate struct {
+	option   execOption
+	respTime float64
+}
+
+// ema is an exponential moving average that tracks whether it has observed any sample.
+type ema struct {
+	value   float64
+	samples int64
+}
+
+func (e *ema) update(sample float64) {
+	if e.samples == 0 {
+		e.value = sample
+	} else {
+		e.value = qosEstimateAlpha*sample + (1-qosEstimateAlpha)*e.value
+	}
+	e.samples++
+}
+
+// functionEstimates contains the learned performance figures of a function.
+type functionEstimates struct {
+	coldStart     ema   // local initialization time on cold start
+	duration      ema   // local execution time
+	edgeRespTime  ema   // response time when offloaded to an Edge node
+	cloudRespTime ema   // response time when offloaded to the Cloud
+	arrivals      int64 // requests evaluated so far
+}
+
+// offloadTarget tracks the consecutive failures of offloading to a node.
+type offloadTarget struct {
+	failures int
+	retryAt  time.Time // offloading to the node is avoided until then
+}
+
+// QoSAwarePolicy picks, for every request, the execution option expected to
+// meet the request deadline (i.e., MaxRespT) according to per-function
+// estimates learned from completed invocations.
+// Nodes that fail to serve offloaded requests are avoided for a time that
+// doubles after every consecutive failure.
+type QoSAwarePolicy struct {
+	mu        sync.Mutex
+	estimates map[string]*functionEstimates
+	targets   map[string]*offloadTarget // failing nodes
+	cloudURL  string
+}
+
+func (p *QoSAwarePolicy) Init() {
+	p.estimates = make(map[string]*functionEstimates)
+	p.targets = make(map[string]*offloadTarget)
+	p.cloudURL = config.GetString(config.CLOUD_URL, "")
+}
+
+func (p *QoSAwarePolicy) OnOffload(remoteHost string, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err == nil {
+		delete(p.targets, remoteHost)
+		return
+	}
+	t, ok := p.targets[remoteHost]
+	if !ok {
+		t = &offloadTarget{}
+		p.targets[remoteHost] = t
+	}
+	t.failures++
+	backoff := math.Min(math.Pow(2, float64(t.failures-1)), qosMaxOffloadBackoff.Seconds())
+	t.retryAt = time.Now().Add(time.Duration(backoff * float64(time.Second)))
+}
+
+// canOffload returns false if offloading to the node is being avoided.
+// The function is NOT thread-safe.
+func (p *QoSAwarePolicy) canOffload(remoteHost string, now time.Time) bool {
+	t, ok := p.targets[remoteHost]
+	return !ok || !now.Before(t.retryAt)
+}
+
+func (p *QoSAwarePolicy) OnCompletion(fun *function.Function, report *function.ExecutionReport) {
+	if report == nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	est := p.getEstimates(fun.VersionedName())
+	switch report.SchedAction {
+	case SCHED_ACTION_OFFLOAD_EDGE:
+		est.edgeRespTime.update(report.ResponseTime)
+	case SCHED_ACTION_OFFLOAD_CLOUD:
+		est.cloudRespTime.update(report.ResponseTime)
+	default:
+		if !report.IsWarmStart {
+			est.coldStart.update(report.InitTime)
+		}
+		est.duration.update(report.Duration)
+	}
+}
+
+func (p *QoSAwarePolicy) OnArrival(r *scheduledRequest) {
+	edgeURL := ""
+	if r.CanDoOffloading {
+		edgeURL = pickEdgeNodeForOffloading(r)
+	}
+
+	candidates := p.evaluateOptions(r, edgeURL)
+	for _, c := range rankCandidates(candidates, r.Class, r.MaxRespT) {
+		if p.tryOption(r, c.option, edgeURL) {
+			return
+		}
+	}
+
+	dropRequest(r)
+}
+
+// getEstimates retrieves (or creates) the estimates for a function.
+// The function is NOT thread-safe.
+func (p *QoSAwarePolicy) getEstimates(funcName string) *functionEstimates {
+	est, ok := p.estimates[funcName]
+	if !ok {
+		est = &functionEstimates{}
+		p.estimates[funcName] = est
+	}
+	return est
+}
+
+// evaluateOptions returns the options available to serve r, along with
+// their expected response time. Options whose estimates have not been learned
+// yet are optimistically assigned a zero cost, so that they get explored
+// (offloading options, by one request out of qosExploreEvery).
+// Failing nodes are not considered (see OnOffload).
+func (p *QoSAwarePolicy) evaluateOptions(r *scheduledRequest, edgeURL string) []candidate {
+	now := time.Now()
+	p.mu.Lock()
+	estimates := p.getEstimates(r.Fun.VersionedName())
+	estimates.arrivals++
+	est := *estimates
+	edgeAvailable := edgeURL != "" && p.canOffload(edgeURL, now)
+	cloudAvailable := r.CanDoOffloading && p.cloudURL != "" && p.canOffload(p.cloudURL, now)
+	p.mu.Unlock()
+	explore := est.arrivals%qosExploreEvery == 1
+
+	candidates := make([]candidate, 0, 4)
+	if node.WarmStatus()[r.Fun.VersionedName()] > 0 {
+		candidates = append(candidates, candidate{optLocalWarm, est.duration.value})
+	}
+	candidates = append(candidates, candidate{optLocalCold, est.coldStart.value + est.duration.value})
+	if edgeAvailable && (est.edgeRespTime.samples > 0 || explore) {
+		candidates = append(candidates, candidate{optEdgeOffload, est.edgeRespTime.value})
+	}
+	if cloudAvailable && (est.cloudRespTime.samples > 0 || explore) {
+		candidates = append(candidates, candidate{optCloudOffload, est.cloudRespTime.value})
+	}
+	return candidates
+}
+
+// tryOption attempts to serve r using the given option.
+// It returns false if the option turned out to be unavailable.
+func (p *QoSAwarePolicy) tryOption(r *scheduledRequest, option execOption, edgeURL string) bool {
+	switch option {
+	case optLocalWarm:
+		containerID, err := node.AcquireWarmContainer(r.Fun)
+		if err != nil {
+			return false
+		}
+		execLocally(r, containerID, true)
+		return true
+	case optLocalCold:
+		return handleColdStart(r)
+	case optEdgeOffload:
+		handleOffload(r, edgeURL)
+		return true
+	case optCloudOffload:
+		handleCloudOffload(r)
+		return true
+	default:
+		log.Printf("Unknown execution option: %d\n", option)
+		return false
+	}
+}
+
+// rankCandidates orders the candidate options according to the service class
+// of the request. Options that are not expected to meet the deadline are
+// discarded, unless the request belongs to the HIGH_AVAILABILITY class, which
+// is always served on a best-effort basis.
+func rankCandidates(candidates []candidate, class function.ServiceClass, deadline float64) []candidate {
+	feasible := make([]candidate, 0, len(candidates))
+	unfeasible := make([]candidate, 0, len(candidates))
+	for _, c := range candidates {
+		if deadline <= 0.0 || c.respTime <= deadline {
+			feasible = append(feasible, c)
+		} else {
+			unfeasible = append(unfeasible, c)
+		}
+	}
+
+	if class == function.HIGH_PERFORMANCE {
+		// fastest option first
+		sort.SliceStable(feasible, func(i, j int) bool { return feasible[i].respTime < feasible[j].respTime })
+	} else {
+		// local execution first, Cloud offloading as last resort
+		sort.SliceStable(feasible, func(i, j int) bool { return feasible[i].option < feasible[j].option })
+	}
+
+	if class == function.HIGH_AVAILABILITY {
+		sort.SliceStable(unfeasible, func(i, j int) bool { return unfeasible[i].respTime < unfeasible[j].respTime })
+		feasible = append(feasible, unfeasible...)
+	}
+
+	return feasible
+}
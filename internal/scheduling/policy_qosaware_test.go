@@ -0,0 +1,106 @@
+package scheduling
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/grussorusso/serverledge/internal/function"
+)
+
+func optionsOf(candidates []candidate) []execOption {
+	options := make([]execOption, len(candidates))
+	for i, c := range candidates {
+		options[i] = c.option
+	}
+	return options
+}
+
+func TestRankCandidates(t *testing.T) {
+	candidates := []candidate{
+		{optLocalWarm, 0.5},
+		{optLocalCold, 2.0},
+		{optEdgeOffload, 0.3},
+		{optCloudOffload, 1.0},
+	}
+
+	tests := []struct {
+		name     string
+		class    function.ServiceClass
+		deadline float64
+		expected []execOption
+	}{
+		{"low, no deadline", function.LOW, -1.0, []execOption{optLocalWarm, optLocalCold, optEdgeOffload, optCloudOffload}},
+		{"low, deadline", function.LOW, 0.8, []execOption{optLocalWarm, optEdgeOffload}},
+		{"performance, deadline", function.HIGH_PERFORMANCE, 1.5, []execOption{optEdgeOffload, optLocalWarm, optCloudOffload}},
+		{"availability, deadline", function.HIGH_AVAILABILITY, 0.4, []execOption{optEdgeOffload, optLocalWarm, optCloudOffload, optLocalCold}},
+		{"performance, unfeasible", function.HIGH_PERFORMANCE, 0.1, []execOption{}},
+	}
+
+	for _, tt := range tests {
+		got := optionsOf(rankCandidates(candidates, tt.class, tt.deadline))
+		if len(got) != len(tt.expected) {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.expected, got)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.expected[i] {
+				t.Errorf("%s: expected %v, got %v", tt.name, tt.expected, got)
+				break
+			}
+		}
+	}
+}
+
+func hasOption(candidates []candidate, option execOption) bool {
+	for _, c := range candidates {
+		if c.option == option {
+			return true
+		}
+	}
+	return false
+}
+
+func TestOffloadExploration(t *testing.T) {
+	p := &QoSAwarePolicy{}
+	p.Init()
+	p.cloudURL = "http://cloud:1323"
+	r := &scheduledRequest{Request: &function.Request{Fun: newTestFunction("f"), CanDoOffloading: true}}
+
+	probes := 0
+	for i := 0; i < 3*qosExploreEvery; i++ {
+		if hasOption(p.evaluateOptions(r, ""), optCloudOffload) {
+			probes++
+		}
+	}
+	if probes != 3 {
+		t.Errorf("expected 3 probes of the unlearned cloud option, got %d", probes)
+	}
+}
+
+func TestOffloadBackoff(t *testing.T) {
+	p := &QoSAwarePolicy{}
+	p.Init()
+	p.cloudURL = "http://cloud:1323"
+	r := &scheduledRequest{Request: &function.Request{Fun: newTestFunction("f"), CanDoOffloading: true}}
+	p.getEstimates(r.Fun.VersionedName()).cloudRespTime.update(0.1)
+
+	if !hasOption(p.evaluateOptions(r, ""), optCloudOffload) {
+		t.Fatalf("expected the cloud option to be available")
+	}
+
+	p.OnOffload(p.cloudURL, errors.New("unreachable"))
+	p.OnOffload(p.cloudURL, errors.New("unreachable"))
+	if hasOption(p.evaluateOptions(r, ""), optCloudOffload) {
+		t.Errorf("expected the failing cloud node to be avoided")
+	}
+	retryAt := p.targets[p.cloudURL].retryAt
+	if d := time.Until(retryAt); d <= time.Second || d > 2*time.Second {
+		t.Errorf("expected a 2s backoff after 2 failures, got %v", d)
+	}
+
+	p.OnOffload(p.cloudURL, nil)
+	if !hasOption(p.evaluateOptions(r, ""), optCloudOffload) {
+		t.Errorf("expected the cloud option to be available after a success")
+	}
+}
@@ -0,0 +1,117 @@
+package scheduling
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/grussorusso/serverledge/internal/function"
+)
+
+// PriorityQueue defines a bounded queue ordered by service class and, within
+// the same class, by deadline (Arrival + MaxRespT). Requests without a
+// deadline follow those with one; ties are broken in FIFO order.
+type PriorityQueue struct {
+	sync.Mutex
+	data     []*scheduledRequest
+	capacity int
+}
+
+// NewPriorityQueue creates a queue
+func NewPriorityQueue(n int) *PriorityQueue {
+	if n < 1 {
+		return nil
+	}
+	return &PriorityQueue{
+		data:     make([]*scheduledRequest, 0, n),
+		capacity: n,
+	}
+}
+
+// classPriority returns the priority of a service class (the lower, the sooner).
+func classPriority(c function.ServiceClass) int {
+	switch c {
+	case function.HIGH_PERFORMANCE:
+		return 0
+	case function.HIGH_AVAILABILITY:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// precedes returns true if a must be served strictly before b.
+func precedes(a *scheduledRequest, b *scheduledRequest) bool {
+	pa, pb := classPriority(a.Class), classPriority(b.Class)
+	if pa != pb {
+		return pa < pb
+	}
+	da, okA := a.Deadline()
+	db, okB := b.Deadline()
+	if okA != okB {
+		return okA
+	}
+	return okA && da.Before(db)
+}
+
+// IsFull returns true if queue is full
+func (q *PriorityQueue) IsFull() bool {
+	return len(q.data) == q.capacity
+}
+
+// Enqueue inserts an element according to its priority
+func (q *PriorityQueue) Enqueue(v *scheduledRequest) bool {
+	if q.IsFull() {
+		return false
+	}
+
+	// insert after every element that does not follow v
+	i := sort.Search(len(q.data), func(i int) bool { return precedes(v, q.data[i]) })
+	q.data = append(q.data, nil)
+	copy(q.data[i+1:], q.data[i:])
+	q.data[i] = v
+	return true
+}
+
+// Dequeue fetches the element with the highest priority
+func (q *PriorityQueue) Dequeue() *scheduledRequest {
+	if len(q.data) == 0 {
+		return nil
+	}
+	v := q.data[0]
+	copy(q.data, q.data[1:])
+	q.data[len(q.data)-1] = nil
+	q.data = q.data[:len(q.data)-1]
+	return v
+}
+
+func (q *PriorityQueue) Front() *scheduledRequest {
+	if len(q.data) == 0 {
+		return nil
+	}
+	return q.data[0]
+}
+
+// Len returns the current length of the queue
+func (q *PriorityQueue) Len() int {
+	return len(q.data)
+}
+
+// Requests returns the queued requests, by decreasing priority
+func (q *PriorityQueue) Requests() []*scheduledRequest {
+	reqs := make([]*scheduledRequest, len(q.data))
+	copy(reqs, q.data)
+	return reqs
+}
+
+// Remove removes an element from the queue
+func (q *PriorityQueue) Remove(v *scheduledRequest) bool {
+	for i, r := range q.data {
+		if r == v {
+			copy(q.data[i:], q.data[i+1:])
+			q.data[len(q.data)-1] = nil
+			q.data = q.data[:len(q.data)-1]
+			return true
+		}
+	}
+	return false
+}
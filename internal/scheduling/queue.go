@@ -7,6 +7,10 @@ type queue interface {
 	Dequeue() *scheduledRequest
 	Front() *scheduledRequest
 	Len() int
+	// Requests returns the queued requests, in the order they should be served
+	Requests() []*scheduledRequest
+	// Remove removes a request from any position in the queue
+	Remove(r *scheduledRequest) bool
 	Lock()
 	Unlock()
 }
@@ -80,3 +84,30 @@ func (q *FIFOQueue) Front() *scheduledRequest {
 func (q *FIFOQueue) Len() int {
 	return q.size
 }
+
+// Requests returns the queued requests, from the front to the back
+func (q *FIFOQueue) Requests() []*scheduledRequest {
+	reqs := make([]*scheduledRequest, 0, q.size)
+	for i := 0; i < q.size; i++ {
+		reqs = append(reqs, q.data[(q.head+i)%q.capacity])
+	}
+	return reqs
+}
+
+// Remove removes an element, preserving the order of the others
+func (q *FIFOQueue) Remove(v *scheduledRequest) bool {
+	for i := 0; i < q.size; i++ {
+		if q.data[(q.head+i)%q.capacity] != v {
+			continue
+		}
+		// shift the following elements back
+		for j := i; j < q.size-1; j++ {
+			q.data[(q.head+j)%q.capacity] = q.data[(q.head+j+1)%q.capacity]
+		}
+		q.tail = (q.tail - 1 + q.capacity) % q.capacity
+		q.data[q.tail] = nil
+		q.size = q.size - 1
+		return true
+	}
+	return false
+}
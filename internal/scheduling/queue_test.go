@@ -3,6 +3,7 @@ package scheduling
 import (
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/grussorusso/serverledge/internal/function"
 )
@@ -19,3 +20,65 @@ func TestQueuet(t *testing.T) {
 	q.Enqueue(r1)
 	fmt.Printf("Size = %d\n", q.Len())
 }
+
+func TestPriorityQueue(t *testing.T) {
+	f := function.Function{Name: "Function1"}
+	now := time.Now()
+	newReq := func(class function.ServiceClass, maxRespT float64) *scheduledRequest {
+		rq := &function.Request{Fun: &f, Arrival: now, RequestQoS: function.RequestQoS{Class: class, MaxRespT: maxRespT}}
+		return &scheduledRequest{Request: rq}
+	}
+	lowNoDeadline := newReq(function.LOW, 0)
+	low := newReq(function.LOW, 10)
+	lowUrgent := newReq(function.LOW, 1)
+	high := newReq(function.HIGH_PERFORMANCE, 0)
+	lowUrgent2 := newReq(function.LOW, 1)
+
+	q := NewPriorityQueue(5)
+	for _, r := range []*scheduledRequest{lowNoDeadline, low, lowUrgent, high, lowUrgent2} {
+		if !q.Enqueue(r) {
+			t.Fatalf("enqueue failed")
+		}
+	}
+	if q.Enqueue(low) {
+		t.Errorf("enqueued in a full queue")
+	}
+
+	if !q.Remove(low) || q.Remove(low) {
+		t.Errorf("unexpected result of Remove")
+	}
+	expected := []*scheduledRequest{high, lowUrgent, lowUrgent2, lowNoDeadline}
+	for i, r := range expected {
+		if v := q.Dequeue(); v != r {
+			t.Errorf("unexpected request at position %d", i)
+		}
+	}
+	if q.Len() != 0 || q.Dequeue() != nil {
+		t.Errorf("queue not empty")
+	}
+}
+
+func TestFIFOQueueRemove(t *testing.T) {
+	f := function.Function{Name: "Function1"}
+	reqs := make([]*scheduledRequest, 4)
+	for i := range reqs {
+		reqs[i] = &scheduledRequest{Request: &function.Request{Fun: &f}}
+	}
+
+	q := NewFIFOQueue(3)
+	q.Enqueue(reqs[0])
+	q.Dequeue()
+	q.Enqueue(reqs[1])
+	q.Enqueue(reqs[2])
+	q.Enqueue(reqs[3]) // wraps around
+
+	if !q.Remove(reqs[2]) {
+		t.Fatalf("Remove failed")
+	}
+	if got := q.Requests(); len(got) != 2 || got[0] != reqs[1] || got[1] != reqs[3] {
+		t.Errorf("unexpected queue content after Remove")
+	}
+	if !q.Enqueue(reqs[0]) || q.Len() != 3 {
+		t.Errorf("unexpected length after Remove")
+	}
+}
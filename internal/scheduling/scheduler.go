@@ -1,6 +1,7 @@
 package scheduling
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"log"
@@ -18,6 +19,7 @@ import (
 
 	"github.com/grussorusso/serverledge/internal/container"
 	"github.com/grussorusso/serverledge/internal/function"
+	"github.com/grussorusso/serverledge/utils"
 )
 
 var requests chan *scheduledRequest
@@ -25,6 +27,8 @@ var completions chan *completionNotification
 
 var remoteServerUrl string
 
+var QueueDeadlineErr = errors.New("deadline exceeded in queue")
+
 var offloadingClient *http.Client
 
 func Run(p Policy) {
@@ -38,16 +42,27 @@ func Run(p Policy) {
 	node.Resources.ContainerPools = make(map[string]*node.ContainerPool)
 	log.Printf("Current resources: %v\n", &node.Resources)
 
-	container.InitDockerContainerFactory()
+	if _, err := container.InitContainerFactory(); err != nil {
+		log.Fatal(err)
+	}
 
 	//janitor periodically remove expired warm container
+	node.InitContainerPolicies()
 	node.GetJanitorInstance()
 
+	// spawns and retires warm containers according to the forecast demand
+	node.StartPrewarming()
+
+	tlsConfig, err := utils.ClientTLSConfig()
+	if err != nil {
+		log.Fatalf("Invalid TLS configuration: %v\n", err)
+	}
 	tr := &http.Transport{
 		MaxIdleConns:        2500,
 		MaxIdleConnsPerHost: 2500,
 		MaxConnsPerHost:     0,
 		IdleConnTimeout:     30 * time.Minute,
+		TLSClientConfig:     tlsConfig,
 	}
 	offloadingClient = &http.Client{Transport: tr}
 
@@ -56,31 +71,68 @@ func Run(p Policy) {
 
 	remoteServerUrl = config.GetString(config.CLOUD_URL, "")
 
+	startAsyncWorkers()
+
 	log.Println("Scheduler started.")
+	loop(p, requests, completions, nil)
+}
 
+// loop dispatches arrivals and completions to the policy, until quit is closed.
+func loop(p Policy, requests <-chan *scheduledRequest, completions <-chan *completionNotification, quit <-chan struct{}) {
 	var r *scheduledRequest
 	var c *completionNotification
 	for {
 		select {
+		case <-quit:
+			return
 		case r = <-requests:
+			node.RecordArrival(r.Fun)
 			go p.OnArrival(r)
 		case c = <-completions:
-			node.ReleaseContainer(c.contID, c.fun)
+			if c.contID != "" && c.discard {
+				node.DiscardContainer(c.contID, c.fun)
+			} else if c.contID != "" {
+				node.ReleaseContainer(c.contID, c.fun)
+			}
 			p.OnCompletion(c.fun, c.executionReport)
+			if o, ok := p.(OffloadObserver); ok && c.remoteHost != "" {
+				o.OnOffload(c.remoteHost, c.offloadErr)
+			}
+
+			if c.executionReport != nil && !isOffloaded(c.executionReport) {
+				node.RecordCompletion(c.fun, c.executionReport.IsWarmStart, c.executionReport.Duration)
+			}
 
 			if metrics.Enabled && c.executionReport != nil {
 				metrics.AddCompletedInvocation(c.fun.Name)
-				if c.executionReport.SchedAction != SCHED_ACTION_OFFLOAD {
+				if !isOffloaded(c.executionReport) {
 					metrics.AddFunctionDurationValue(c.fun.Name, c.executionReport.Duration)
 				}
 			}
 		}
 	}
+}
 
+// withDeadline bounds the context of the request according to its timeout,
+// measured from its arrival.
+func withDeadline(r *function.Request) context.CancelFunc {
+	timeout := r.Timeout()
+	if timeout <= 0 {
+		return func() {}
+	}
+	var cancel context.CancelFunc
+	r.Ctx, cancel = context.WithDeadline(r.Ctx, r.Arrival.Add(timeout))
+	return cancel
 }
 
 // SubmitRequest submits a newly arrived request for scheduling and execution
 func SubmitRequest(r *function.Request) (function.ExecutionReport, error) {
+	// invalid requests are rejected before scheduling
+	if err := r.Fun.ValidateParams(r.Params); err != nil {
+		return function.ExecutionReport{}, err
+	}
+	defer withDeadline(r)()
+
 	schedRequest := scheduledRequest{
 		Request:         r,
 		decisionChannel: make(chan schedDecision, 1)}
@@ -104,44 +156,36 @@ func SubmitRequest(r *function.Request) (function.ExecutionReport, error) {
 	if schedDecision.action == DROP {
 		//log.Printf("[%s] Dropping request", r)
 		return function.ExecutionReport{}, node.OutOfResourcesErr
+	} else if schedDecision.action == EXPIRE {
+		return function.ExecutionReport{}, QueueDeadlineErr
 	} else if schedDecision.action == EXEC_REMOTE {
 		//log.Printf("Offloading request")
-		return Offload(r, schedDecision.remoteHost)
+		report, err := Offload(r, schedDecision.remoteHost)
+		// notify scheduler (no local container to release)
+		if err == nil {
+			completions <- &completionNotification{fun: r.Fun, executionReport: &report,
+				remoteHost: schedDecision.remoteHost}
+		} else {
+			completions <- &completionNotification{fun: r.Fun, remoteHost: schedDecision.remoteHost, offloadErr: err}
+		}
+		return report, err
 	} else {
-		return Execute(schedDecision.contID, &schedRequest, schedDecision.useWarm)
+		return executeLocally(&schedRequest, schedDecision)
 	}
 }
 
-// SubmitAsyncRequest submits a newly arrived async request for scheduling and execution
-func SubmitAsyncRequest(r *function.Request) {
-	schedRequest := scheduledRequest{
-		Request:         r,
-		decisionChannel: make(chan schedDecision, 1)}
-	requests <- &schedRequest
-
-	// wait on channel for scheduling action
-	schedDecision, ok := <-schedRequest.decisionChannel
-	if !ok {
-		publishAsyncResponse(r.Id(), function.Response{Success: false})
-		return
-	}
-
-	var err error
-	if schedDecision.action == DROP {
-		publishAsyncResponse(r.Id(), function.Response{Success: false})
-	} else if schedDecision.action == EXEC_REMOTE {
-		//log.Printf("Offloading request")
-		err = OffloadAsync(r, schedDecision.remoteHost)
-		if err != nil {
-			publishAsyncResponse(r.Id(), function.Response{Success: false})
-		}
-	} else {
-		report, err := Execute(schedDecision.contID, &schedRequest, schedDecision.useWarm)
+// executeLocally executes a request on the container chosen by the scheduler.
+// Paused containers are resumed here, rather than by the scheduler, falling
+// back to a cold start if they cannot be resumed.
+func executeLocally(r *scheduledRequest, decision schedDecision) (function.ExecutionReport, error) {
+	if decision.useWarm && node.ResumeContainer(decision.contID, r.Fun) != nil {
+		newContainer, err := node.NewContainer(r.Fun)
 		if err != nil {
-			publishAsyncResponse(r.Id(), function.Response{Success: false})
+			return function.ExecutionReport{}, err
 		}
-		publishAsyncResponse(r.Id(), function.Response{Success: true, ExecutionReport: report})
+		return Execute(newContainer, r, false)
 	}
+	return Execute(decision.contID, r, decision.useWarm)
 }
 
 func handleColdStart(r *scheduledRequest) (isSuccess bool) {
@@ -167,6 +211,10 @@ func dropRequest(r *scheduledRequest) {
 	r.decisionChannel <- schedDecision{action: DROP}
 }
 
+func expireRequest(r *scheduledRequest) {
+	r.decisionChannel <- schedDecision{action: EXPIRE}
+}
+
 func execLocally(r *scheduledRequest, c container.ContainerID, warmStart bool) {
 	decision := schedDecision{action: EXEC_LOCAL, contID: c, useWarm: warmStart}
 	r.decisionChannel <- decision
@@ -0,0 +1,370 @@
+package scheduling
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/grussorusso/serverledge/internal/config"
+	"github.com/grussorusso/serverledge/internal/container"
+	"github.com/grussorusso/serverledge/internal/container/containertest"
+	"github.com/grussorusso/serverledge/internal/executor"
+	"github.com/grussorusso/serverledge/internal/function"
+	"github.com/grussorusso/serverledge/internal/node"
+	"github.com/spf13/viper"
+)
+
+// observedPolicy wraps a Policy to let tests wait for completions.
+type observedPolicy struct {
+	Policy
+	completed chan struct{}
+}
+
+func (p *observedPolicy) OnCompletion(fun *function.Function, report *function.ExecutionReport) {
+	p.Policy.OnCompletion(fun, report)
+	p.completed <- struct{}{}
+}
+
+// testHarness drives the scheduler loop on top of a fake container factory.
+type testHarness struct {
+	t       *testing.T
+	factory *containertest.FakeFactory
+	policy  *observedPolicy
+	nextID  int
+}
+
+// startTestHarness starts the scheduler with the given (initialized) policy
+// and node resources.
+func startTestHarness(t *testing.T, p Policy, memMB int64, cpus float64, coldStart, execTime time.Duration) *testHarness {
+	requests = make(chan *scheduledRequest, 500)
+	completions = make(chan *completionNotification, 500)
+
+	node.Resources.AvailableMemMB = memMB
+	node.Resources.AvailableCPUs = cpus
+	node.Resources.ContainerPools = make(map[string]*node.ContainerPool)
+
+	h := &testHarness{
+		t:       t,
+		factory: containertest.InitFakeContainerFactory(coldStart, execTime),
+		policy:  &observedPolicy{Policy: p, completed: make(chan struct{}, 500)},
+	}
+
+	quit := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		loop(h.policy, requests, completions, quit)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		close(quit)
+		<-done
+		node.WaitBackgroundTasks()
+		h.factory.Close()
+	})
+	return h
+}
+
+func (h *testHarness) newRequest(f *function.Function) *function.Request {
+	h.nextID++
+	return &function.Request{
+		Ctx:     context.WithValue(context.Background(), "ReqId", fmt.Sprintf("%s-%d", f.Name, h.nextID)),
+		Fun:     f,
+		Params:  map[string]interface{}{},
+		Arrival: time.Now(),
+	}
+}
+
+// waitCompletions waits until n completions have been processed by the scheduler.
+func (h *testHarness) waitCompletions(n int) {
+	for i := 0; i < n; i++ {
+		select {
+		case <-h.policy.completed:
+		case <-time.After(5 * time.Second):
+			h.t.Fatalf("timeout waiting for completions (%d/%d)", i, n)
+		}
+	}
+}
+
+// submitConcurrently submits n requests at once and counts served and dropped ones.
+func (h *testHarness) submitConcurrently(f *function.Function, n int) (served int, dropped int) {
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	reqs := make([]*function.Request, n)
+	for i := range reqs {
+		reqs[i] = h.newRequest(f)
+	}
+	for _, r := range reqs {
+		wg.Add(1)
+		go func(r *function.Request) {
+			defer wg.Done()
+			_, err := SubmitRequest(r)
+			mu.Lock()
+			defer mu.Unlock()
+			if err == nil {
+				served++
+			} else if errors.Is(err, node.OutOfResourcesErr) {
+				dropped++
+			} else {
+				h.t.Errorf("unexpected error: %v", err)
+			}
+		}(r)
+	}
+	wg.Wait()
+	h.waitCompletions(served)
+	return served, dropped
+}
+
+func newTestFunction(name string) *function.Function {
+	return &function.Function{Name: name, Runtime: container.CUSTOM_RUNTIME, CustomImage: "fake", MemoryMB: 128, CPUDemand: 1.0}
+}
+
+func TestWarmStarts(t *testing.T) {
+	p := &DefaultLocalPolicy{}
+	p.Init()
+	h := startTestHarness(t, p, 128, 1.0, 10*time.Millisecond, 0)
+	f := newTestFunction("f")
+
+	for i := 0; i < 3; i++ {
+		report, err := SubmitRequest(h.newRequest(f))
+		if err != nil {
+			t.Fatalf("invocation failed: %v", err)
+		}
+		if report.IsWarmStart != (i > 0) {
+			t.Errorf("request %d: unexpected warm start: %v", i, report.IsWarmStart)
+		}
+		h.waitCompletions(1)
+	}
+
+	if h.factory.Created != 1 {
+		t.Errorf("expected 1 container, got %d", h.factory.Created)
+	}
+}
+
+func TestPausedWarmStarts(t *testing.T) {
+	viper.Set(config.CONTAINER_PAUSE_IDLE, true)
+	node.InitContainerPolicies()
+	t.Cleanup(func() {
+		viper.Set(config.CONTAINER_PAUSE_IDLE, nil)
+		node.InitContainerPolicies()
+	})
+	p := &DefaultLocalPolicy{}
+	p.Init()
+	h := startTestHarness(t, p, 128, 1.0, 10*time.Millisecond, 0)
+	f := newTestFunction("f")
+
+	if _, err := SubmitRequest(h.newRequest(f)); err != nil {
+		t.Fatalf("invocation failed: %v", err)
+	}
+	h.waitCompletions(1)
+	// the idle container is paused in background
+	node.WaitBackgroundTasks()
+
+	report, err := SubmitRequest(h.newRequest(f))
+	if err != nil || !report.IsWarmStart {
+		t.Fatalf("expected a warm start: %v", err)
+	}
+	if h.factory.Created != 1 {
+		t.Errorf("expected 1 container, got %d", h.factory.Created)
+	}
+	h.waitCompletions(1)
+}
+
+func TestPausedAsyncWarmStarts(t *testing.T) {
+	viper.Set(config.CONTAINER_PAUSE_IDLE, true)
+	node.InitContainerPolicies()
+	t.Cleanup(func() {
+		viper.Set(config.CONTAINER_PAUSE_IDLE, nil)
+		node.InitContainerPolicies()
+	})
+	p := &DefaultLocalPolicy{}
+	p.Init()
+	h := startTestHarness(t, p, 128, 1.0, 10*time.Millisecond, 0)
+	f := newTestFunction("f")
+
+	var statuses []string
+	for i := 0; i < 2; i++ {
+		r := h.newRequest(f)
+		r.Async = true
+		if _, err := executeAsyncRequest(r, func(s string) { statuses = append(statuses, s) }); err != nil {
+			t.Fatalf("invocation %d failed: %v", i, err)
+		}
+		h.waitCompletions(1)
+		// the idle container is paused in background
+		node.WaitBackgroundTasks()
+	}
+	if h.factory.Created != 1 {
+		t.Errorf("expected the paused container to be resumed, got %d containers", h.factory.Created)
+	}
+	if len(statuses) != 4 || statuses[0] != ASYNC_SCHEDULED || statuses[1] != ASYNC_RUNNING {
+		t.Errorf("unexpected statuses: %v", statuses)
+	}
+}
+
+func TestDropWithoutQueue(t *testing.T) {
+	p := &DefaultLocalPolicy{}
+	p.Init()
+	h := startTestHarness(t, p, 128, 1.0, 0, 100*time.Millisecond)
+
+	served, dropped := h.submitConcurrently(newTestFunction("f"), 3)
+	if served != 1 || dropped != 2 {
+		t.Errorf("expected 1 served and 2 dropped, got %d and %d", served, dropped)
+	}
+}
+
+func TestQueueing(t *testing.T) {
+	p := &DefaultLocalPolicy{}
+	p.Init()
+	p.queue = NewFIFOQueue(1)
+	h := startTestHarness(t, p, 128, 1.0, 0, 100*time.Millisecond)
+
+	served, dropped := h.submitConcurrently(newTestFunction("f"), 3)
+	if served != 2 || dropped != 1 {
+		t.Errorf("expected 2 served and 1 dropped, got %d and %d", served, dropped)
+	}
+	if h.factory.Created != 1 {
+		t.Errorf("expected the queued request to reuse the container, got %d containers", h.factory.Created)
+	}
+}
+
+func TestHeadOfLineSkipping(t *testing.T) {
+	p := &DefaultLocalPolicy{}
+	p.Init()
+	p.queue = NewPriorityQueue(2)
+	h := startTestHarness(t, p, 256, 2.0, 0, 100*time.Millisecond)
+	small := newTestFunction("small")
+	big := newTestFunction("big")
+	big.MemoryMB = 256
+
+	var wg sync.WaitGroup
+	submit := func(r *function.Request, report *function.ExecutionReport) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var err error
+			*report, err = SubmitRequest(r)
+			if err != nil {
+				t.Errorf("invocation failed: %v", err)
+			}
+		}()
+	}
+
+	reports := make([]function.ExecutionReport, 4)
+	submit(h.newRequest(small), &reports[0])
+	submit(h.newRequest(small), &reports[1])
+	time.Sleep(20 * time.Millisecond)
+	submit(h.newRequest(big), &reports[2]) // queued, needs the whole memory
+	time.Sleep(20 * time.Millisecond)
+	submit(h.newRequest(small), &reports[3]) // queued behind big
+	wg.Wait()
+	h.waitCompletions(4)
+
+	// the last request must not wait for big, reusing a released container
+	if !reports[3].IsWarmStart {
+		t.Errorf("queued request blocked by the head of the queue")
+	}
+}
+
+func TestQueueDeadline(t *testing.T) {
+	p := &DefaultLocalPolicy{}
+	p.Init()
+	p.queue = NewPriorityQueue(2)
+	p.maxWait = 50 * time.Millisecond
+	h := startTestHarness(t, p, 128, 1.0, 0, 200*time.Millisecond)
+	f := newTestFunction("f")
+
+	first := make(chan error, 1)
+	r := h.newRequest(f)
+	go func() {
+		_, err := SubmitRequest(r)
+		first <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	// expires because of the max. waiting time
+	t0 := time.Now()
+	if _, err := SubmitRequest(h.newRequest(f)); !errors.Is(err, QueueDeadlineErr) {
+		t.Errorf("expected QueueDeadlineErr, got: %v", err)
+	}
+	if elapsed := time.Since(t0); elapsed > 150*time.Millisecond {
+		t.Errorf("request expired after %v", elapsed)
+	}
+
+	// expires because of its max. response time
+	r = h.newRequest(f)
+	r.MaxRespT = 0.01
+	if _, err := SubmitRequest(r); !errors.Is(err, QueueDeadlineErr) {
+		t.Errorf("expected QueueDeadlineErr, got: %v", err)
+	}
+	if p.queue.Len() != 0 {
+		t.Errorf("expired requests left in the queue")
+	}
+
+	// served after waiting in the queue
+	p.queue.Lock()
+	p.maxWait = 0
+	p.queue.Unlock()
+	var report function.ExecutionReport
+	queued := make(chan error, 1)
+	r = h.newRequest(f)
+	go func() {
+		var err error
+		report, err = SubmitRequest(r)
+		queued <- err
+	}()
+	if err := <-first; err != nil {
+		t.Fatalf("invocation failed: %v", err)
+	}
+	if err := <-queued; err != nil {
+		t.Fatalf("invocation failed: %v", err)
+	}
+	h.waitCompletions(2)
+	if report.QueueTime <= 0 {
+		t.Errorf("queue time not reported: %v", report.QueueTime)
+	}
+}
+
+func TestFailedExecution(t *testing.T) {
+	p := &DefaultLocalPolicy{}
+	p.Init()
+	h := startTestHarness(t, p, 128, 1.0, 0, 0)
+	h.factory.Handler = func(*executor.InvocationRequest) *executor.InvocationResult {
+		return &executor.InvocationResult{Success: false}
+	}
+
+	_, err := SubmitRequest(h.newRequest(newTestFunction("f")))
+	if !errors.Is(err, FunctionErr) {
+		t.Fatalf("expected FunctionErr, got: %v", err)
+	}
+	if isRetriable(err) {
+		t.Errorf("failed functions must not be retried")
+	}
+	h.waitCompletions(1)
+
+	if node.Resources.AvailableCPUs != 1.0 {
+		t.Errorf("CPUs not released after failure: %v", &node.Resources)
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	p := &DefaultLocalPolicy{}
+	p.Init()
+	h := startTestHarness(t, p, 128, 1.0, 0, 500*time.Millisecond)
+
+	r := h.newRequest(newTestFunction("f"))
+	r.TimeoutSeconds = 0.1
+	if _, err := SubmitRequest(r); !errors.Is(err, TimeoutErr) {
+		t.Fatalf("expected TimeoutErr, got: %v", err)
+	}
+	h.waitCompletions(1)
+
+	// the container may still be busy, so it must not be reused
+	if node.WarmStatus()["f"] != 0 {
+		t.Errorf("timed out container released to the pool")
+	}
+	if node.Resources.AvailableMemMB != 128 || node.Resources.AvailableCPUs != 1.0 {
+		t.Errorf("resources not released after timeout: %v", &node.Resources)
+	}
+}
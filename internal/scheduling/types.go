@@ -1,6 +1,8 @@
 package scheduling
 
 import (
+	"time"
+
 	"github.com/grussorusso/serverledge/internal/container"
 	"github.com/grussorusso/serverledge/internal/function"
 )
@@ -9,17 +11,24 @@ import (
 type scheduledRequest struct {
 	*function.Request
 	decisionChannel chan schedDecision
+	queued          time.Time     // when the request entered the queue
+	queueDeadline   time.Time     // when the request expires in the queue (zero -> never)
+	queueWait       time.Duration // time spent in the queue
+	dequeued        chan struct{} // closed when the request leaves the queue
 }
 
 type completionNotification struct {
 	fun             *function.Function
 	contID          container.ContainerID
 	executionReport *function.ExecutionReport
+	discard         bool   // the container must be destroyed
+	remoteHost      string // node the request has been offloaded to (if any)
+	offloadErr      error  // failure of the offloading (if any)
 }
 
 // schedDecision wraps a action made by the scheduler.
-// Possible decisions are 1) drop, 2) execute locally or 3) execute on a remote
-// Node (offloading).
+// Possible decisions are 1) drop, 2) execute locally, 3) execute on a remote
+// Node (offloading) or 4) expire (the request waited too long in the queue).
 type schedDecision struct {
 	action     action
 	contID     container.ContainerID
@@ -33,4 +42,5 @@ const (
 	DROP        action = 0
 	EXEC_LOCAL         = 1
 	EXEC_REMOTE        = 2
+	EXPIRE             = 3
 )
@@ -0,0 +1,232 @@
+package trigger
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/grussorusso/serverledge/internal/config"
+	"github.com/grussorusso/serverledge/internal/scheduling"
+)
+
+// Supported broker types
+const MQTT = "mqtt"
+
+// Source is a topic of a message broker: each message published on the topic
+// fires the trigger.
+type Source struct {
+	Type           string // type of broker (e.g., "mqtt")
+	URL            string // e.g., "tcp://broker:1883"
+	Topic          string // may contain wildcards, if supported by the broker
+	QoS            int
+	ClientId       string  // (optional)
+	Username       string  // (optional)
+	Password       string  // (optional, encrypted once stored, see scheduling.SealSecret)
+	BatchSize      int     // max. number of messages per invocation (default: 1)
+	BatchWindow    float64 // max. seconds waited to fill a batch (default: 1)
+	MaxConcurrency int     // max. number of invocations in progress (default: 1)
+}
+
+// Message published on a broker.
+type Message struct {
+	Topic   string
+	Payload []byte
+	ack     func() // acknowledges the message to the broker (optional)
+}
+
+// NewMessage returns a message, which is acknowledged to the broker through
+// ack (if not nil) once processed.
+func NewMessage(topic string, payload []byte, ack func()) Message {
+	return Message{Topic: topic, Payload: payload, ack: ack}
+}
+
+// Subscriber receives the messages published on a type of broker.
+type Subscriber interface {
+	// Subscribe passes the messages published on the topic of the source to
+	// handler, until the context is canceled or the connection fails.
+	// Messages are acknowledged once the invocations they fire are
+	// completed.
+	Subscribe(ctx context.Context, clientId string, source *Source, handler func(Message)) error
+}
+
+var subscribers = map[string]Subscriber{
+	MQTT: mqttSubscriber{},
+}
+
+// RegisterSubscriber adds support for a type of broker.
+func RegisterSubscriber(brokerType string, s Subscriber) {
+	subscribers[brokerType] = s
+}
+
+// parameter holding payloads that are not JSON objects
+const payloadParam = "payload"
+
+// parameter holding the messages of a batch
+const messagesParam = "messages"
+
+// Validate checks that the source is well formed, and that its broker can
+// be contacted (see scheduling.ValidateHost).
+func (s *Source) Validate() error {
+	if _, ok := subscribers[s.Type]; !ok {
+		return fmt.Errorf("unsupported broker type '%s'", s.Type)
+	}
+	if s.URL == "" || s.Topic == "" {
+		return fmt.Errorf("broker URL and topic are required")
+	}
+	u, err := url.Parse(s.URL)
+	if err != nil || u.Hostname() == "" {
+		return fmt.Errorf("invalid broker URL")
+	}
+	if err = scheduling.ValidateHost(u.Hostname()); err != nil {
+		return fmt.Errorf("invalid broker URL: %v", err)
+	}
+	if s.Password != "" && !scheduling.SecretsEnabled() {
+		return fmt.Errorf("passwords are not accepted, as %s is not configured", config.CALLBACK_KEY)
+	}
+	if s.QoS < 0 || s.QoS > 1 {
+		return fmt.Errorf("unsupported QoS %d", s.QoS)
+	}
+	if s.BatchSize < 0 || s.BatchWindow < 0 || s.MaxConcurrency < 0 {
+		return fmt.Errorf("invalid batching or concurrency")
+	}
+	return nil
+}
+
+func (s *Source) batchSize() int {
+	return max(s.BatchSize, 1)
+}
+
+func (s *Source) batchWindow() time.Duration {
+	if s.BatchWindow == 0 {
+		return time.Second
+	}
+	return time.Duration(s.BatchWindow * float64(time.Second))
+}
+
+func (s *Source) maxConcurrency() int {
+	return max(s.MaxConcurrency, 1)
+}
+
+// messageParams maps a message to the parameters of an invocation: the
+// fields of JSON objects are added to the parameters of the trigger, while
+// other payloads are passed as a string.
+func messageParams(defaults map[string]interface{}, m Message) map[string]interface{} {
+	params := make(map[string]interface{}, len(defaults)+1)
+	for k, v := range defaults {
+		params[k] = v
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(m.Payload, &fields); err != nil || fields == nil {
+		params[payloadParam] = string(m.Payload)
+		return params
+	}
+	for k, v := range fields {
+		params[k] = v
+	}
+	return params
+}
+
+// batchParams maps a batch of messages to the parameters of an invocation,
+// which receives the messages as a list.
+func batchParams(defaults map[string]interface{}, batch []Message) map[string]interface{} {
+	if len(batch) == 1 {
+		return messageParams(defaults, batch[0])
+	}
+	messages := make([]interface{}, 0, len(batch))
+	for _, m := range batch {
+		messages = append(messages, messageParams(nil, m))
+	}
+	params := make(map[string]interface{}, len(defaults)+1)
+	for k, v := range defaults {
+		params[k] = v
+	}
+	params[messagesParam] = messages
+	return params
+}
+
+// consume subscribes to the source of a trigger and submits an invocation
+// for each batch of messages, until the context is canceled or the
+// subscription fails. Messages are not consumed while the max. number of
+// invocations is in progress, and are acknowledged once their invocation
+// has completed (i.e., they are delivered at least once with QoS 1).
+func consume(ctx context.Context, t *Trigger, submit func(params map[string]interface{})) error {
+	source := t.Source
+	subscriber := subscribers[source.Type]
+	clientId := source.ClientId
+	if clientId == "" {
+		clientId = "serverledge-" + t.Name
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	messages := make(chan Message)
+	failure := make(chan error, 1)
+	go func() {
+		failure <- subscriber.Subscribe(ctx, clientId, source, func(m Message) {
+			select {
+			case messages <- m:
+			case <-ctx.Done():
+			}
+		})
+	}()
+
+	inProgress := make(chan struct{}, source.maxConcurrency())
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	flush := func(batch []Message) bool {
+		select {
+		case inProgress <- struct{}{}:
+		case <-ctx.Done():
+			return false
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			submit(batchParams(t.Params, batch))
+			for _, m := range batch {
+				if m.ack != nil {
+					m.ack()
+				}
+			}
+			<-inProgress
+		}()
+		return true
+	}
+
+	var batch []Message
+	timer := time.NewTimer(0)
+	<-timer.C
+	for {
+		select {
+		case m := <-messages:
+			batch = append(batch, m)
+			if len(batch) >= source.batchSize() {
+				if !timer.Stop() && len(batch) > 1 {
+					<-timer.C
+				}
+				if !flush(batch) {
+					return ctx.Err()
+				}
+				batch = nil
+			} else if len(batch) == 1 {
+				timer.Reset(source.batchWindow())
+			}
+		case <-timer.C:
+			if len(batch) > 0 && !flush(batch) {
+				return ctx.Err()
+			}
+			batch = nil
+		case err := <-failure:
+			if len(batch) > 0 {
+				flush(batch)
+			}
+			if err == nil {
+				err = ctx.Err()
+			}
+			return err
+		}
+	}
+}
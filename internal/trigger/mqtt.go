@@ -0,0 +1,122 @@
+package trigger
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/grussorusso/serverledge/internal/scheduling"
+)
+
+// mqttSubscriber subscribes to MQTT topics, with QoS 0 or 1.
+type mqttSubscriber struct{}
+
+// interval between keep-alive messages
+const mqttKeepAlive = 30 * time.Second
+
+// timeout for connecting to the broker and subscribing
+const mqttDialTimeout = 10 * time.Second
+
+// Subscribe connects to the broker with a persistent session, so that QoS 1
+// messages not acknowledged yet are delivered again after a failure.
+func (mqttSubscriber) Subscribe(ctx context.Context, clientId string, source *Source, handler func(Message)) error {
+	brokerURL, err := mqttBrokerURL(source.URL)
+	if err != nil {
+		return err
+	}
+	password, err := scheduling.OpenSecret(source.Password)
+	if err != nil {
+		return err
+	}
+	lost := make(chan error, 1)
+	opts := mqtt.NewClientOptions().
+		AddBroker(brokerURL).
+		SetClientID(clientId).
+		SetUsername(source.Username).
+		SetPassword(password).
+		SetDialer(scheduling.RestrictDialer(&net.Dialer{Timeout: mqttDialTimeout})).
+		SetCleanSession(false).
+		SetKeepAlive(mqttKeepAlive).
+		SetConnectTimeout(mqttDialTimeout).
+		SetAutoReconnect(false).
+		SetAutoAckDisabled(true).
+		SetOrderMatters(source.QoS == 0).
+		SetConnectionLostHandler(func(_ mqtt.Client, err error) {
+			lost <- err
+		})
+	client := mqtt.NewClient(opts)
+	if err = waitToken(ctx, client.Connect()); err != nil {
+		return fmt.Errorf("could not connect to the broker: %v", err)
+	}
+	defer client.Disconnect(250)
+
+	token := client.Subscribe(source.Topic, byte(source.QoS), func(_ mqtt.Client, m mqtt.Message) {
+		if m.Qos() == 0 {
+			handler(Message{Topic: m.Topic(), Payload: m.Payload()})
+			return
+		}
+		// QoS 1 messages are handled concurrently (up to the unacknowledged
+		// messages allowed by the broker), and acknowledged once processed
+		processed := make(chan struct{})
+		handler(Message{Topic: m.Topic(), Payload: m.Payload(), ack: func() { close(processed) }})
+		select {
+		case <-processed:
+			m.Ack()
+		case <-ctx.Done():
+		}
+	})
+	if err = waitToken(ctx, token); err != nil {
+		return fmt.Errorf("subscription to '%s' failed: %v", source.Topic, err)
+	}
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case err = <-lost:
+		return err
+	}
+}
+
+// waitToken waits for the completion of an MQTT operation.
+func waitToken(ctx context.Context, token mqtt.Token) error {
+	timer := time.NewTimer(mqttDialTimeout)
+	defer timer.Stop()
+	select {
+	case <-token.Done():
+		return token.Error()
+	case <-timer.C:
+		return errors.New("timed out")
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// mqttBrokerURL validates the URL of a broker (e.g., "tcp://host:1883" or
+// "ssl://host:8883"), adding the default port if missing.
+func mqttBrokerURL(brokerURL string) (string, error) {
+	u, err := url.Parse(brokerURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid broker URL: %v", err)
+	}
+	// the allowed hosts may have changed since the validation of the source
+	if err = scheduling.ValidateHost(u.Hostname()); err != nil {
+		return "", err
+	}
+	switch u.Scheme {
+	case "tcp", "mqtt":
+		if u.Port() == "" {
+			u.Host += ":1883"
+		}
+	case "ssl", "tls", "mqtts":
+		if u.Port() == "" {
+			u.Host += ":8883"
+		}
+	default:
+		return "", fmt.Errorf("unsupported broker URL scheme '%s'", u.Scheme)
+	}
+	return u.String(), nil
+}
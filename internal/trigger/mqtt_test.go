@@ -0,0 +1,212 @@
+package trigger
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/grussorusso/serverledge/internal/config"
+	"github.com/spf13/viper"
+)
+
+// MQTT control packet types
+const (
+	mqttConnect   = 1
+	mqttConnack   = 2
+	mqttPublish   = 3
+	mqttPuback    = 4
+	mqttSubscribe = 8
+	mqttSuback    = 9
+)
+
+func writePacket(w io.Writer, header byte, body []byte) error {
+	packet := []byte{header}
+	// remaining length
+	n := len(body)
+	for {
+		b := byte(n % 128)
+		n /= 128
+		if n > 0 {
+			b |= 0x80
+		}
+		packet = append(packet, b)
+		if n == 0 {
+			break
+		}
+	}
+	_, err := w.Write(append(packet, body...))
+	return err
+}
+
+func readPacket(r *bufio.Reader) (byte, []byte, error) {
+	header, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	length := 0
+	for i := 0; i < 4; i++ {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		length |= int(b&0x7f) << (7 * i)
+		if b&0x80 == 0 {
+			break
+		}
+	}
+	body := make([]byte, length)
+	_, err = io.ReadFull(r, body)
+	return header, body, err
+}
+
+func appendString(b []byte, s string) []byte {
+	b = binary.BigEndian.AppendUint16(b, uint16(len(s)))
+	return append(b, s...)
+}
+
+// serveMQTT runs a broker accepting a single subscription, which publishes
+// the given payloads (with QoS 1) and counts the acknowledged ones.
+func serveMQTT(t *testing.T, listener net.Listener, topic string, payloads []string, acks *atomic.Int32) {
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			t.Errorf("accept failed: %v", err)
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+
+		if header, _, err := readPacket(r); err != nil || header>>4 != mqttConnect {
+			t.Errorf("expected CONNECT: %v", err)
+		}
+		_ = writePacket(conn, mqttConnack<<4, []byte{0, 0})
+		header, body, err := readPacket(r)
+		if err != nil || header>>4 != mqttSubscribe {
+			t.Errorf("expected SUBSCRIBE: %v", err)
+			return
+		}
+		if n := int(binary.BigEndian.Uint16(body[2:])); string(body[4:4+n]) != topic {
+			t.Errorf("unexpected topic filter: %s", body[4:4+n])
+		}
+		_ = writePacket(conn, mqttSuback<<4, append(body[:2:2], 1))
+
+		for i, p := range payloads {
+			msg := appendString(nil, topic)
+			msg = binary.BigEndian.AppendUint16(msg, uint16(i+1))
+			_ = writePacket(conn, mqttPublish<<4|0x02, append(msg, p...))
+		}
+		for {
+			header, _, err := readPacket(r)
+			if err != nil {
+				return
+			}
+			if header>>4 == mqttPuback {
+				acks.Add(1)
+			}
+		}
+	}()
+}
+
+func TestMQTTTrigger(t *testing.T) {
+	viper.Set(config.CALLBACK_ALLOWED_HOSTS, []string{"127.0.0.1"})
+	t.Cleanup(func() { viper.Set(config.CALLBACK_ALLOWED_HOSTS, nil) })
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("could not start the broker: %v", err)
+	}
+	defer listener.Close()
+	var acks atomic.Int32
+	serveMQTT(t, listener, "sensors/temp", []string{`{"t": 20}`, `{"t": 21}`, "22"}, &acks)
+
+	trigger := &Trigger{Name: "temp", Function: "f", Params: map[string]interface{}{"unit": "C"},
+		Source: &Source{Type: MQTT, URL: "tcp://" + listener.Addr().String(), Topic: "sensors/temp",
+			QoS: 1, BatchSize: 3, BatchWindow: 5}}
+	if err := trigger.Validate(); err != nil {
+		t.Fatalf("invalid trigger: %v", err)
+	}
+
+	var mu sync.Mutex
+	var invocations []map[string]interface{}
+	submitted := make(chan struct{})
+	release := make(chan struct{})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = consume(ctx, trigger, func(params map[string]interface{}) {
+			mu.Lock()
+			invocations = append(invocations, params)
+			mu.Unlock()
+			close(submitted)
+			<-release
+		})
+	}()
+
+	// messages are acknowledged once the invocation is completed
+	select {
+	case <-submitted:
+	case <-ctx.Done():
+		t.Fatalf("no invocation submitted")
+	}
+	time.Sleep(100 * time.Millisecond)
+	if n := acks.Load(); n != 0 {
+		t.Errorf("%d messages acknowledged before the invocation completed", n)
+	}
+	close(release)
+	for acks.Load() < 3 && ctx.Err() == nil {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := acks.Load(); n != 3 {
+		t.Errorf("expected 3 acknowledged messages, got %d", n)
+	}
+	cancel()
+	<-done
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(invocations) != 1 || invocations[0]["unit"] != "C" {
+		t.Fatalf("expected a single invocation, got %v", invocations)
+	}
+	// messages of a batch may be received in any order
+	batch, _ := invocations[0][messagesParam].([]interface{})
+	var values []string
+	for _, m := range batch {
+		params := m.(map[string]interface{})
+		if v, ok := params["t"]; ok {
+			values = append(values, fmt.Sprint(v))
+		} else {
+			values = append(values, params[payloadParam].(string))
+		}
+	}
+	sort.Strings(values)
+	if len(values) != 3 || values[0] != "20" || values[1] != "21" || values[2] != "22" {
+		t.Errorf("unexpected batch: %v", batch)
+	}
+}
+
+func TestSourceValidation(t *testing.T) {
+	source := &Source{Type: MQTT, URL: "tcp://127.0.0.1:1883", Topic: "sensors/temp"}
+	if err := source.Validate(); err == nil {
+		t.Errorf("expected brokers with private addresses to be rejected")
+	}
+
+	viper.Set(config.CALLBACK_ALLOWED_HOSTS, []string{"127.0.0.1"})
+	t.Cleanup(func() { viper.Set(config.CALLBACK_ALLOWED_HOSTS, nil) })
+	if err := source.Validate(); err != nil {
+		t.Errorf("unexpected error for an allowed broker: %v", err)
+	}
+	// passwords cannot be stored without an encryption key
+	source.Password = "secret"
+	if err := source.Validate(); err == nil {
+		t.Errorf("expected the password to be rejected")
+	}
+}
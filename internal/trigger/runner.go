@@ -0,0 +1,326 @@
+package trigger
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/grussorusso/serverledge/internal/admission"
+	"github.com/grussorusso/serverledge/internal/function"
+	"github.com/grussorusso/serverledge/internal/scheduling"
+	"github.com/grussorusso/serverledge/utils"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/client/v3/concurrency"
+)
+
+// Triggers are fired by a single node in each area, elected through Etcd: if
+// the leader crashes, its lease expires and another node takes over.
+const leaderPrefix = "/trigger-leader/"
+
+// lease TTL (seconds) of the leader
+const leaderTTL = 10
+
+// delay before campaigning again after a failure
+const campaignRetryInterval = 5 * time.Second
+
+// interval between the records of the (aggregated) firings of broker triggers
+const brokerHistoryInterval = 10 * time.Second
+
+// area of this node
+var localArea string
+
+// LocalArea returns the area of this node, whose triggers it may fire.
+func LocalArea() string {
+	return localArea
+}
+
+// Start makes the node take part in the election of the node firing the
+// triggers of its area.
+func Start(area string, nodeId string) {
+	localArea = area
+	go func() {
+		for {
+			err := lead(area, nodeId)
+			log.Printf("Stopped firing triggers: %v\n", err)
+			time.Sleep(campaignRetryInterval)
+		}
+	}()
+}
+
+// lead campaigns for the leadership of the area and, once elected, fires the
+// triggers until the leadership is lost.
+func lead(area string, nodeId string) error {
+	etcdClient, err := utils.GetEtcdClient()
+	if err != nil {
+		return err
+	}
+	session, err := concurrency.NewSession(etcdClient, concurrency.WithTTL(leaderTTL))
+	if err != nil {
+		return fmt.Errorf("could not create a session: %v", err)
+	}
+	defer session.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-session.Done():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	election := concurrency.NewElection(session, leaderPrefix+area)
+	if err = election.Campaign(ctx, nodeId); err != nil {
+		return fmt.Errorf("campaign failed: %v", err)
+	}
+	log.Printf("Firing the triggers of area %s\n", area)
+	return fireTriggers(ctx, etcdClient, area)
+}
+
+// fireTriggers fires the triggers of the area when due (or subscribes to
+// their sources), reloading them upon every change.
+func fireTriggers(ctx context.Context, etcdClient *clientv3.Client, area string) error {
+	changes := etcdClient.Watch(ctx, triggerPrefix, clientv3.WithPrefix())
+	subscriptions := make(map[string]*subscription)
+	defer func() {
+		for _, s := range subscriptions {
+			s.cancel()
+		}
+	}()
+	for {
+		triggers, err := getByArea(area)
+		if err != nil {
+			return err
+		}
+		updateSubscriptions(ctx, subscriptions, triggers)
+		schedules := make(map[*Trigger]Schedule, len(triggers))
+		nextFiring := make(map[*Trigger]time.Time, len(triggers))
+		now := time.Now()
+		for _, t := range triggers {
+			if t.Source != nil {
+				continue
+			}
+			s, err := ParseSchedule(t.Schedule)
+			if err != nil {
+				log.Printf("Invalid schedule for trigger %s: %v\n", t.Name, err)
+				continue
+			}
+			schedules[t] = s
+			nextFiring[t] = s.Next(now)
+		}
+
+		reload := false
+		for !reload {
+			timer := time.NewTimer(untilNext(nextFiring))
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return ctx.Err()
+			case _, ok := <-changes:
+				timer.Stop()
+				if !ok {
+					return fmt.Errorf("watch closed")
+				}
+				reload = true
+			case now := <-timer.C:
+				for t, next := range nextFiring {
+					if next.IsZero() || next.After(now) {
+						continue
+					}
+					go fireAndRecord(t, next, t.Params, true)
+					nextFiring[t] = schedules[t].Next(now)
+				}
+			}
+		}
+	}
+}
+
+// untilNext returns the time until the next firing.
+func untilNext(nextFiring map[*Trigger]time.Time) time.Duration {
+	wait := time.Hour
+	for _, next := range nextFiring {
+		if !next.IsZero() && time.Until(next) < wait {
+			wait = time.Until(next)
+		}
+	}
+	return max(wait, 0)
+}
+
+// subscription to the source of a trigger
+type subscription struct {
+	trigger *Trigger
+	cancel  context.CancelFunc
+}
+
+// updateSubscriptions subscribes to the sources of new triggers, and
+// unsubscribes from those of removed ones.
+func updateSubscriptions(ctx context.Context, subscriptions map[string]*subscription, triggers []*Trigger) {
+	current := make(map[string]*Trigger, len(triggers))
+	for _, t := range triggers {
+		if t.Source != nil {
+			current[t.Name] = t
+		}
+	}
+	for name, s := range subscriptions {
+		if t, ok := current[name]; !ok || !reflect.DeepEqual(t, s.trigger) {
+			s.cancel()
+			delete(subscriptions, name)
+		}
+	}
+	for name, t := range current {
+		if _, ok := subscriptions[name]; ok {
+			continue
+		}
+		subCtx, cancel := context.WithCancel(ctx)
+		subscriptions[name] = &subscription{trigger: t, cancel: cancel}
+		go listen(subCtx, t)
+	}
+}
+
+// listen fires a trigger upon the messages published on its source,
+// subscribing again upon failures.
+func listen(ctx context.Context, t *Trigger) {
+	history := &firingAggregator{}
+	go func() {
+		ticker := time.NewTicker(brokerHistoryInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				history.record(t.Name)
+			case <-ctx.Done():
+				history.record(t.Name)
+				return
+			}
+		}
+	}()
+
+	for {
+		err := consume(ctx, t, func(params map[string]interface{}) {
+			history.add(fire(t, time.Now(), params, false))
+		})
+		if ctx.Err() != nil {
+			return
+		}
+		log.Printf("Subscription of trigger %s failed: %v\n", t.Name, err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(campaignRetryInterval):
+		}
+	}
+}
+
+// fire invokes the function of a trigger, returning the firing.
+func fire(t *Trigger, when time.Time, params map[string]interface{}, async bool) *Firing {
+	firing := &Firing{Time: when}
+	reqId, err := invoke(t, when, params, async)
+	firing.ReqId = reqId
+	if err != nil {
+		log.Printf("Could not fire trigger %s: %v\n", t.Name, err)
+		firing.Error = err.Error()
+	}
+	return firing
+}
+
+// fireAndRecord fires a trigger and records the firing.
+func fireAndRecord(t *Trigger, when time.Time, params map[string]interface{}, async bool) {
+	if err := recordFiring(t.Name, fire(t, when, params, async)); err != nil {
+		log.Printf("Could not record the firing of trigger %s: %v\n", t.Name, err)
+	}
+}
+
+// firingAggregator merges the firings of a broker trigger, so that a single
+// firing is recorded for each interval, rather than one per invocation.
+type firingAggregator struct {
+	mu      sync.Mutex
+	pending *Firing // firings since the last record (nil if none)
+}
+
+func (a *firingAggregator) add(f *Firing) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.pending == nil {
+		a.pending = &Firing{Time: f.Time}
+	}
+	a.pending.Count++
+	a.pending.ReqId = f.ReqId
+	if f.Error != "" {
+		a.pending.Failures++
+		a.pending.Error = f.Error
+	}
+}
+
+// record records the firings aggregated so far (if any).
+func (a *firingAggregator) record(name string) {
+	a.mu.Lock()
+	f := a.pending
+	a.pending = nil
+	a.mu.Unlock()
+	if f == nil {
+		return
+	}
+	if err := recordFiring(name, f); err != nil {
+		log.Printf("Could not record the firings of trigger %s: %v\n", name, err)
+	}
+}
+
+// firingReqId returns the ID of the request of a firing, which is the same
+// if the firing is repeated (e.g., by a new leader). Names cannot contain
+// ':', which separates the namespace.
+func firingReqId(namespace string, function string, trigger string, when time.Time) string {
+	reqId := fmt.Sprintf("%s-%s-%d", function, trigger, when.UnixNano())
+	if namespace != "" {
+		return namespace + ":" + reqId
+	}
+	return reqId
+}
+
+// invoke submits an invocation of the function of a trigger. Sync
+// invocations return once completed.
+func invoke(t *Trigger, when time.Time, params map[string]interface{}, async bool) (string, error) {
+	namespace, _ := function.SplitName(t.Name)
+	ref, err := function.QualifyReference(namespace, t.Function)
+	if err != nil {
+		return "", err
+	}
+	fun, ok := function.GetFunction(ref)
+	if !ok {
+		return "", function.NotFoundErr
+	}
+
+	release, err := admission.Admit(fun.Name, "")
+	if err != nil {
+		return "", err
+	}
+
+	reqId := firingReqId(namespace, fun.PlainName(), t.PlainName(), when)
+	r := &function.Request{
+		Ctx:             context.WithValue(context.Background(), "ReqId", reqId),
+		Fun:             fun,
+		Params:          params,
+		Arrival:         time.Now(),
+		CanDoOffloading: true,
+		Async:           async,
+	}
+	if async {
+		// the admission slot is held until the request is served
+		err = scheduling.EnqueueAsyncRequest(r, release)
+		if err != nil {
+			release()
+		}
+		if errors.Is(err, scheduling.AsyncRequestExistsErr) {
+			// already fired by the previous leader
+			return reqId, nil
+		}
+		return reqId, err
+	}
+	defer release()
+	_, err = scheduling.SubmitRequest(r)
+	return reqId, err
+}
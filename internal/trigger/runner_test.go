@@ -0,0 +1,32 @@
+package trigger
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFiringAggregator(t *testing.T) {
+	start := time.Date(2024, time.February, 1, 10, 0, 0, 0, time.UTC)
+	a := &firingAggregator{}
+	a.add(&Firing{Time: start, ReqId: "r1"})
+	a.add(&Firing{Time: start.Add(time.Second), Error: "function not found"})
+	a.add(&Firing{Time: start.Add(2 * time.Second), ReqId: "r3"})
+
+	f := a.pending
+	if f == nil || f.Count != 3 || f.Failures != 1 {
+		t.Fatalf("unexpected aggregated firing: %+v", f)
+	}
+	if !f.Time.Equal(start) || f.ReqId != "r3" || f.Error != "function not found" {
+		t.Errorf("unexpected aggregated firing: %+v", f)
+	}
+}
+
+func TestFiringReqId(t *testing.T) {
+	when := time.Date(2024, time.February, 1, 2, 0, 0, 0, time.UTC)
+	if id := firingReqId("", "report", "nightly", when); id != "report-nightly-1706752800000000000" {
+		t.Errorf("unexpected ID: %s", id)
+	}
+	if firingReqId("ns1", "f", "t", when) == firingReqId("ns2", "f", "t", when) {
+		t.Errorf("expected distinct IDs across namespaces")
+	}
+}
@@ -0,0 +1,257 @@
+package trigger
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/grussorusso/serverledge/internal/function"
+	"github.com/grussorusso/serverledge/internal/scheduling"
+	"github.com/grussorusso/serverledge/utils"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// Trigger invokes a function periodically, according to a cron schedule, or
+// upon the messages published on a broker.
+type Trigger struct {
+	Name     string  // qualified with the namespace (see function.QualifiedName)
+	Function string  // reference to the function (e.g., "func@stable")
+	Schedule string  // see ParseSchedule (if Source is nil)
+	Source   *Source // (if Schedule is empty)
+	Params   map[string]interface{}
+	Area     string // area of the nodes firing the trigger (default: the area of the node registering it)
+}
+
+// Firing records an activation of a trigger. The firings of broker triggers
+// are aggregated (see firingAggregator).
+type Firing struct {
+	Time     time.Time
+	ReqId    string // async request (see /poll), or last request of aggregated firings
+	Error    string // last error of aggregated firings
+	Count    int    `json:",omitempty"` // number of aggregated firings
+	Failures int    `json:",omitempty"` // number of aggregated firings that failed
+}
+
+// Etcd prefixes
+const triggerPrefix = "/trigger/"
+const historyPrefix = "/trigger-history/"
+
+// number of firings kept for each trigger
+const maxHistory = 100
+
+var NotFoundErr = errors.New("trigger not found")
+var AlreadyExistsErr = errors.New("trigger already exists")
+
+func getEtcdKey(name string) string {
+	return triggerPrefix + name
+}
+
+// getHistoryPrefix returns the prefix of the firings of a trigger. The
+// separator cannot appear in names (see getVersionsPrefix in function).
+func getHistoryPrefix(name string) string {
+	return historyPrefix + name + ":"
+}
+
+// Validate checks that the trigger is well formed.
+func (t *Trigger) Validate() error {
+	if t.Source != nil {
+		if t.Schedule != "" {
+			return fmt.Errorf("triggers have either a schedule or a source")
+		}
+		if err := t.Source.Validate(); err != nil {
+			return err
+		}
+	} else if _, err := ParseSchedule(t.Schedule); err != nil {
+		return err
+	}
+	if _, _, _, err := function.ParseReference(t.Function); err != nil || t.Function == "" {
+		return fmt.Errorf("invalid function '%s'", t.Function)
+	}
+	return nil
+}
+
+// PlainName returns the name of the trigger without its namespace.
+func (t *Trigger) PlainName() string {
+	_, name := function.SplitName(t.Name)
+	return name
+}
+
+// SaveToEtcd stores a new trigger. The password of its source (if any) is
+// stored encrypted.
+func (t *Trigger) SaveToEtcd() error {
+	cli, err := utils.GetEtcdClient()
+	if err != nil {
+		return err
+	}
+	ctx := context.TODO()
+
+	stored := *t
+	if t.Source != nil {
+		source := *t.Source
+		if source.Password, err = scheduling.SealSecret(source.Password); err != nil {
+			return fmt.Errorf("Could not encrypt password: %v", err)
+		}
+		stored.Source = &source
+	}
+	payload, err := json.Marshal(stored)
+	if err != nil {
+		return fmt.Errorf("Could not marshal trigger: %v", err)
+	}
+
+	key := getEtcdKey(t.Name)
+	txnResp, err := cli.Txn(ctx).
+		If(clientv3.Compare(clientv3.CreateRevision(key), "=", 0)).
+		Then(clientv3.OpPut(key, string(payload))).
+		Commit()
+	if err != nil {
+		return fmt.Errorf("Failed Put: %v", err)
+	}
+	if !txnResp.Succeeded {
+		return AlreadyExistsErr
+	}
+	return nil
+}
+
+// Delete removes a trigger, along with its history.
+func Delete(name string) error {
+	cli, err := utils.GetEtcdClient()
+	if err != nil {
+		return err
+	}
+	ctx := context.TODO()
+
+	txnResp, err := cli.Txn(ctx).
+		Then(clientv3.OpDelete(getEtcdKey(name)),
+			clientv3.OpDelete(getHistoryPrefix(name), clientv3.WithPrefix())).
+		Commit()
+	if err != nil {
+		return fmt.Errorf("Failed Delete: %v", err)
+	}
+	if txnResp.Responses[0].GetResponseDeleteRange().Deleted < 1 {
+		return NotFoundErr
+	}
+	return nil
+}
+
+// GetAll returns the triggers in a namespace.
+func GetAll(namespace string) ([]*Trigger, error) {
+	prefix := getEtcdKey(function.QualifiedName(namespace, ""))
+	triggers, err := getWithPrefix(prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	filtered := make([]*Trigger, 0, len(triggers))
+	for _, t := range triggers {
+		if strings.Contains(t.Name[len(prefix)-len(triggerPrefix):], "/") {
+			continue // trigger in a nested namespace
+		}
+		filtered = append(filtered, t)
+	}
+	return filtered, nil
+}
+
+// getByArea returns the triggers fired by the nodes of an area.
+func getByArea(area string) ([]*Trigger, error) {
+	triggers, err := getWithPrefix(triggerPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	filtered := make([]*Trigger, 0, len(triggers))
+	for _, t := range triggers {
+		if t.Area == area {
+			filtered = append(filtered, t)
+		}
+	}
+	return filtered, nil
+}
+
+func getWithPrefix(prefix string) ([]*Trigger, error) {
+	cli, err := utils.GetEtcdClient()
+	if err != nil {
+		return nil, err
+	}
+	ctx := context.TODO()
+
+	resp, err := cli.Get(ctx, prefix, clientv3.WithPrefix())
+	if err != nil {
+		return nil, fmt.Errorf("Failed Get: %v", err)
+	}
+
+	triggers := make([]*Trigger, 0, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		var t Trigger
+		if err = json.Unmarshal(kv.Value, &t); err != nil {
+			return nil, fmt.Errorf("Could not unmarshal trigger: %v", err)
+		}
+		triggers = append(triggers, &t)
+	}
+	return triggers, nil
+}
+
+// GetHistory returns the last firings of a trigger, starting from the most
+// recent one.
+func GetHistory(name string) ([]Firing, error) {
+	cli, err := utils.GetEtcdClient()
+	if err != nil {
+		return nil, err
+	}
+	ctx := context.TODO()
+
+	resp, err := cli.Get(ctx, getEtcdKey(name), clientv3.WithKeysOnly())
+	if err != nil {
+		return nil, fmt.Errorf("Failed Get: %v", err)
+	}
+	if len(resp.Kvs) < 1 {
+		return nil, NotFoundErr
+	}
+
+	resp, err = cli.Get(ctx, getHistoryPrefix(name), clientv3.WithPrefix(),
+		clientv3.WithSort(clientv3.SortByKey, clientv3.SortDescend))
+	if err != nil {
+		return nil, fmt.Errorf("Failed Get: %v", err)
+	}
+	history := make([]Firing, 0, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		var f Firing
+		if err = json.Unmarshal(kv.Value, &f); err != nil {
+			return nil, fmt.Errorf("Could not unmarshal firing: %v", err)
+		}
+		history = append(history, f)
+	}
+	return history, nil
+}
+
+// recordFiring adds a firing to the history of a trigger, removing the
+// oldest ones.
+func recordFiring(name string, f *Firing) error {
+	cli, err := utils.GetEtcdClient()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+
+	payload, err := json.Marshal(f)
+	if err != nil {
+		return fmt.Errorf("Could not marshal firing: %v", err)
+	}
+	prefix := getHistoryPrefix(name)
+	// keys are sorted by time
+	if _, err = cli.Put(ctx, fmt.Sprintf("%s%020d", prefix, f.Time.UnixNano()), string(payload)); err != nil {
+		return fmt.Errorf("Failed Put: %v", err)
+	}
+
+	resp, err := cli.Get(ctx, prefix, clientv3.WithPrefix(), clientv3.WithKeysOnly(),
+		clientv3.WithSort(clientv3.SortByKey, clientv3.SortDescend))
+	if err != nil || len(resp.Kvs) <= maxHistory {
+		return err
+	}
+	oldest := string(resp.Kvs[maxHistory].Key)
+	_, err = cli.Delete(ctx, prefix, clientv3.WithRange(clientv3.GetPrefixRangeEnd(oldest)))
+	return err
+}
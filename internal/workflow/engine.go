@@ -0,0 +1,360 @@
+package workflow
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/grussorusso/serverledge/internal/admission"
+	"github.com/grussorusso/serverledge/internal/function"
+	"github.com/grussorusso/serverledge/internal/metrics"
+	"github.com/grussorusso/serverledge/internal/scheduling"
+)
+
+// max. number of states executed by a single invocation (workflows may loop)
+const maxSteps = 1000
+
+// key of the output of tasks whose result is not a JSON object
+const resultKey = "result"
+
+var TooManyStepsErr = errors.New("too many steps executed by the workflow")
+var TimeoutErr = errors.New("workflow timed out")
+
+// Options of a workflow invocation, applied to each function invocation.
+type Options struct {
+	ReqId           string
+	Class           function.ServiceClass
+	CanDoOffloading bool
+	ReturnOutput    bool
+	Identity        string // of the client, used for admission control (see auth.Identity)
+}
+
+// StepReport describes the execution of a task.
+type StepReport struct {
+	State    string // prefixed with the enclosing parallel states and branches (e.g., "fanout/left/resize")
+	Function string
+	Attempts int
+	Error    string
+	function.ExecutionReport
+}
+
+// Report describes the execution of a workflow.
+type Report struct {
+	Success      bool
+	Result       string // output of the workflow (JSON)
+	Error        string
+	ResponseTime float64
+	Steps        []StepReport // in order of completion
+}
+
+// Engine executes workflows, submitting function invocations to the scheduler.
+type Engine struct {
+	submit      func(r *function.Request) (function.ExecutionReport, error)
+	getFunction func(ref string) (*function.Function, bool)
+}
+
+func NewEngine(submit func(r *function.Request) (function.ExecutionReport, error),
+	getFunction func(ref string) (*function.Function, bool)) *Engine {
+	return &Engine{submit: submit, getFunction: getFunction}
+}
+
+var defaultEngine = NewEngine(scheduling.SubmitRequest, function.GetFunction)
+
+// Invoke executes a workflow with the given input.
+func Invoke(ctx context.Context, w *Workflow, params map[string]interface{}, opts *Options) *Report {
+	return defaultEngine.Invoke(ctx, w, params, opts)
+}
+
+// execution is the state of a workflow invocation.
+type execution struct {
+	*Engine
+	ctx       context.Context
+	namespace string
+	opts      *Options
+	steps     int64 // executed states
+	attempts  int64 // function invocations
+	mu        sync.Mutex
+	reports   []StepReport
+}
+
+// Invoke executes a workflow with the given input. The invocation is
+// interrupted if ctx is canceled, or once the workflow times out.
+func (e *Engine) Invoke(ctx context.Context, w *Workflow, params map[string]interface{}, opts *Options) *Report {
+	t0 := time.Now()
+	if w.TimeoutSeconds > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(w.TimeoutSeconds*float64(time.Second)))
+		defer cancel()
+	}
+	ex := &execution{Engine: e, ctx: ctx, namespace: w.Namespace(), opts: opts}
+	if params == nil {
+		params = make(map[string]interface{})
+	}
+
+	output, err := ex.run("", w.StartAt, w.States, params)
+	if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		err = TimeoutErr
+	}
+
+	report := &Report{Success: err == nil, Steps: ex.reports}
+	if err != nil {
+		report.Error = err.Error()
+	} else {
+		result, _ := json.Marshal(output)
+		report.Result = string(result)
+	}
+	report.ResponseTime = time.Since(t0).Seconds()
+	return report
+}
+
+// run executes a state machine from the given state.
+func (ex *execution) run(path string, startAt string, states map[string]*State, input map[string]interface{}) (map[string]interface{}, error) {
+	name := startAt
+	for {
+		if atomic.AddInt64(&ex.steps, 1) > maxSteps {
+			return nil, TooManyStepsErr
+		}
+		if err := ex.ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		s := states[name]
+		var output map[string]interface{}
+		var err error
+		switch s.Type {
+		case TASK:
+			output, err = ex.runTask(path+name, s, input)
+		case PARALLEL:
+			output, err = ex.runParallel(path+name+"/", s, input)
+		case CHOICE:
+			next := s.choose(input)
+			if next == "" {
+				return nil, fmt.Errorf("state %s: no matching choice", path+name)
+			}
+			name = next
+			continue
+		case SUCCEED:
+			return input, nil
+		case FAIL:
+			return nil, fmt.Errorf("state %s failed: %s", path+name, s.Error)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if s.Next == "" {
+			return output, nil
+		}
+		name = s.Next
+		input = output
+	}
+}
+
+// runTask invokes the function of a task state, retrying upon failure.
+func (ex *execution) runTask(path string, s *State, input map[string]interface{}) (map[string]interface{}, error) {
+	report := StepReport{State: path, Function: s.Function}
+	defer ex.addReport(&report)
+
+	ref, err := function.QualifyReference(ex.namespace, s.Function)
+	if err != nil {
+		report.Error = err.Error()
+		return nil, fmt.Errorf("state %s: %v", path, err)
+	}
+	fun, ok := ex.getFunction(ref)
+	if !ok {
+		report.Error = function.NotFoundErr.Error()
+		return nil, fmt.Errorf("state %s: unknown function %s", path, s.Function)
+	}
+
+	maxAttempts := 1
+	interval := 0.0
+	backoff := 1.0
+	if s.Retry != nil {
+		maxAttempts = max(s.Retry.MaxAttempts, 1)
+		interval = s.Retry.Interval
+		if s.Retry.BackoffRate > 0 {
+			backoff = s.Retry.BackoffRate
+		}
+	}
+
+	for {
+		report.Attempts++
+		var executionReport function.ExecutionReport
+		executionReport, err = ex.invoke(fun, fmt.Sprintf("%s-%d", ex.opts.ReqId, atomic.AddInt64(&ex.attempts, 1)), input)
+		if err == nil {
+			report.ExecutionReport = executionReport
+			report.Error = ""
+			return decodeResult(executionReport.Result), nil
+		}
+		report.Error = err.Error()
+		if report.Attempts >= maxAttempts {
+			return nil, fmt.Errorf("state %s: %v", path, err)
+		}
+
+		wait := time.Duration(interval * math.Pow(backoff, float64(report.Attempts-1)) * float64(time.Second))
+		select {
+		case <-time.After(wait):
+		case <-ex.ctx.Done():
+			return nil, ex.ctx.Err()
+		}
+	}
+}
+
+// invoke submits a function invocation, subject to admission control.
+func (ex *execution) invoke(fun *function.Function, reqId string, params map[string]interface{}) (function.ExecutionReport, error) {
+	release, err := admission.Admit(fun.Name, ex.opts.Identity)
+	var rejection *admission.RejectedErr
+	if errors.As(err, &rejection) {
+		if metrics.Enabled {
+			metrics.AddRejectedInvocation(fun.Name, rejection.Reason)
+		}
+		return function.ExecutionReport{}, err
+	}
+	defer release()
+	if metrics.Enabled {
+		metrics.AddAdmittedInvocation(fun.Name)
+	}
+
+	r := &function.Request{
+		Ctx:             context.WithValue(ex.ctx, "ReqId", reqId),
+		Fun:             fun,
+		Params:          params,
+		Arrival:         time.Now(),
+		RequestQoS:      function.RequestQoS{Class: ex.opts.Class},
+		CanDoOffloading: ex.opts.CanDoOffloading,
+		ReturnOutput:    ex.opts.ReturnOutput,
+	}
+	return ex.submit(r)
+}
+
+// runParallel executes the branches of a parallel state concurrently.
+func (ex *execution) runParallel(path string, s *State, input map[string]interface{}) (map[string]interface{}, error) {
+	outputs := make([]map[string]interface{}, len(s.Branches))
+	errs := make([]error, len(s.Branches))
+	var wg sync.WaitGroup
+	for i, b := range s.Branches {
+		wg.Add(1)
+		go func(i int, b *Branch) {
+			defer wg.Done()
+			outputs[i], errs[i] = ex.run(path+b.Name+"/", b.StartAt, b.States, input)
+		}(i, b)
+	}
+	wg.Wait()
+
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	output := make(map[string]interface{}, len(s.Branches))
+	for i, b := range s.Branches {
+		output[b.Name] = outputs[i]
+	}
+	return output, nil
+}
+
+func (ex *execution) addReport(report *StepReport) {
+	ex.mu.Lock()
+	defer ex.mu.Unlock()
+	ex.reports = append(ex.reports, *report)
+}
+
+// decodeResult converts the result of a function into the input of the
+// next state. Results that are not JSON objects are stored under resultKey.
+func decodeResult(result string) map[string]interface{} {
+	var value interface{}
+	if err := json.Unmarshal([]byte(result), &value); err != nil {
+		if result == "" {
+			return make(map[string]interface{})
+		}
+		return map[string]interface{}{resultKey: result}
+	}
+	if output, ok := value.(map[string]interface{}); ok {
+		return output
+	}
+	return map[string]interface{}{resultKey: value}
+}
+
+// choose returns the next state of a choice state.
+func (s *State) choose(input map[string]interface{}) string {
+	for _, c := range s.Choices {
+		if c.matches(input) {
+			return c.Next
+		}
+	}
+	return s.Default
+}
+
+func (c *Choice) matches(input map[string]interface{}) bool {
+	value, found := lookup(input, c.Variable)
+	if c.Operator == EXISTS_OP || !found {
+		return found && c.Operator == EXISTS_OP
+	}
+
+	switch c.Operator {
+	case EQ_OP:
+		return reflect.DeepEqual(value, c.Value)
+	case NE_OP:
+		return !reflect.DeepEqual(value, c.Value)
+	}
+
+	cmp, ok := compare(value, c.Value)
+	if !ok {
+		return false
+	}
+	switch c.Operator {
+	case LT_OP:
+		return cmp < 0
+	case LE_OP:
+		return cmp <= 0
+	case GT_OP:
+		return cmp > 0
+	case GE_OP:
+		return cmp >= 0
+	}
+	return false
+}
+
+// lookup returns the value of a (possibly nested) field of the input.
+func lookup(input map[string]interface{}, variable string) (interface{}, bool) {
+	var value interface{} = input
+	for _, field := range strings.Split(variable, ".") {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if value, ok = object[field]; !ok {
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+// compare compares two numbers or two strings.
+func compare(a interface{}, b interface{}) (int, bool) {
+	switch a := a.(type) {
+	case float64:
+		b, ok := b.(float64)
+		if !ok {
+			return 0, false
+		}
+		if a < b {
+			return -1, true
+		} else if a > b {
+			return 1, true
+		}
+		return 0, true
+	case string:
+		b, ok := b.(string)
+		if !ok {
+			return 0, false
+		}
+		return strings.Compare(a, b), true
+	}
+	return 0, false
+}
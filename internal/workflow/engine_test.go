@@ -0,0 +1,176 @@
+package workflow
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/grussorusso/serverledge/internal/function"
+)
+
+// testEngine returns an engine executing the given handlers in place of
+// functions, along with the number of invocations of each function.
+func testEngine(handlers map[string]func(params map[string]interface{}) (interface{}, error)) (*Engine, map[string]int) {
+	var mu sync.Mutex
+	invocations := make(map[string]int)
+	submit := func(r *function.Request) (function.ExecutionReport, error) {
+		mu.Lock()
+		invocations[r.Fun.Name]++
+		mu.Unlock()
+		result, err := handlers[r.Fun.Name](r.Params)
+		if err != nil {
+			return function.ExecutionReport{}, err
+		}
+		payload, _ := json.Marshal(result)
+		return function.ExecutionReport{Result: string(payload)}, nil
+	}
+	getFunction := func(ref string) (*function.Function, bool) {
+		if _, ok := handlers[ref]; !ok {
+			return nil, false
+		}
+		return &function.Function{Name: ref}, true
+	}
+	return NewEngine(submit, getFunction), invocations
+}
+
+func decodeOutput(t *testing.T, report *Report) map[string]interface{} {
+	if !report.Success {
+		t.Fatalf("workflow failed: %s", report.Error)
+	}
+	var output map[string]interface{}
+	if err := json.Unmarshal([]byte(report.Result), &output); err != nil {
+		t.Fatalf("invalid output: %s", report.Result)
+	}
+	return output
+}
+
+func TestSequenceAndChoice(t *testing.T) {
+	engine, _ := testEngine(map[string]func(map[string]interface{}) (interface{}, error){
+		"double": func(p map[string]interface{}) (interface{}, error) {
+			return map[string]interface{}{"n": p["n"].(float64) * 2}, nil
+		},
+		"describe": func(p map[string]interface{}) (interface{}, error) {
+			return "large", nil
+		},
+	})
+	w := &Workflow{Name: "w", StartAt: "double", States: map[string]*State{
+		"double": {Type: TASK, Function: "double", Next: "check"},
+		"check": {Type: CHOICE, Default: "done", Choices: []*Choice{
+			{Variable: "n", Operator: LT_OP, Value: 10.0, Next: "double"},
+			{Variable: "n", Operator: GE_OP, Value: 100.0, Next: "describe"},
+		}},
+		"describe": {Type: TASK, Function: "describe"},
+		"done":     {Type: SUCCEED},
+	}}
+	if err := w.Validate(); err != nil {
+		t.Fatalf("invalid workflow: %v", err)
+	}
+
+	// 3 -> 6 -> 12
+	output := decodeOutput(t, engine.Invoke(context.Background(), w, map[string]interface{}{"n": 3.0}, &Options{}))
+	if output["n"] != 12.0 {
+		t.Errorf("unexpected output: %v", output)
+	}
+	// 60 -> 120 -> "large"
+	report := engine.Invoke(context.Background(), w, map[string]interface{}{"n": 60.0}, &Options{})
+	if output = decodeOutput(t, report); output[resultKey] != "large" || len(report.Steps) != 2 {
+		t.Errorf("unexpected output: %v (%d steps)", output, len(report.Steps))
+	}
+}
+
+func TestParallelAndRetry(t *testing.T) {
+	failures := 2
+	engine, invocations := testEngine(map[string]func(map[string]interface{}) (interface{}, error){
+		"inc": func(p map[string]interface{}) (interface{}, error) {
+			return map[string]interface{}{"n": p["n"].(float64) + 1}, nil
+		},
+		"flaky": func(p map[string]interface{}) (interface{}, error) {
+			if failures > 0 {
+				failures--
+				return nil, errors.New("failed")
+			}
+			return p, nil
+		},
+		"sum": func(p map[string]interface{}) (interface{}, error) {
+			a := p["a"].(map[string]interface{})["n"].(float64)
+			b := p["b"].(map[string]interface{})["n"].(float64)
+			return map[string]interface{}{"sum": a + b}, nil
+		},
+	})
+	w := &Workflow{Name: "w", StartAt: "fanout", States: map[string]*State{
+		"fanout": {Type: PARALLEL, Next: "sum", Branches: []*Branch{
+			{Name: "a", StartAt: "inc", States: map[string]*State{"inc": {Type: TASK, Function: "inc"}}},
+			{Name: "b", StartAt: "flaky", States: map[string]*State{
+				"flaky": {Type: TASK, Function: "flaky", Retry: &RetryPolicy{MaxAttempts: 3}, Next: "inc"},
+				"inc":   {Type: TASK, Function: "inc"},
+			}},
+		}},
+		"sum": {Type: TASK, Function: "sum"},
+	}}
+	if err := w.Validate(); err != nil {
+		t.Fatalf("invalid workflow: %v", err)
+	}
+
+	report := engine.Invoke(context.Background(), w, map[string]interface{}{"n": 1.0}, &Options{})
+	if output := decodeOutput(t, report); output["sum"] != 4.0 {
+		t.Errorf("unexpected output: %v", output)
+	}
+	if invocations["flaky"] != 3 || len(report.Steps) != 4 {
+		t.Errorf("unexpected steps: %v", report.Steps)
+	}
+
+	// retries exhausted
+	failures = 3
+	report = engine.Invoke(context.Background(), w, map[string]interface{}{"n": 1.0}, &Options{})
+	if report.Success || invocations["sum"] != 1 {
+		t.Errorf("expected the workflow to fail")
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	engine, invocations := testEngine(map[string]func(map[string]interface{}) (interface{}, error){
+		"slow": func(p map[string]interface{}) (interface{}, error) {
+			time.Sleep(50 * time.Millisecond)
+			return p, nil
+		},
+	})
+	w := &Workflow{Name: "w", StartAt: "a", TimeoutSeconds: 0.01, States: map[string]*State{
+		"a": {Type: TASK, Function: "slow", Next: "b"},
+		"b": {Type: TASK, Function: "slow"},
+	}}
+
+	report := engine.Invoke(context.Background(), w, nil, &Options{})
+	if report.Success || report.Error != TimeoutErr.Error() || invocations["slow"] != 1 {
+		t.Errorf("expected the workflow to time out: %v", report)
+	}
+
+	// the invocation is interrupted if the caller gives up
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	w.TimeoutSeconds = 0
+	if report = engine.Invoke(ctx, w, nil, &Options{}); report.Success {
+		t.Errorf("expected the workflow to be canceled")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []*Workflow{
+		{Name: "w", StartAt: "missing", States: map[string]*State{"a": {Type: SUCCEED}}},
+		{Name: "w", StartAt: "a", States: map[string]*State{"a": {Type: TASK}}},
+		{Name: "w", StartAt: "a", States: map[string]*State{"a": {Type: TASK, Function: "f", Next: "b"}}},
+		{Name: "w", StartAt: "a", States: map[string]*State{"a": {Type: CHOICE, Choices: []*Choice{
+			{Variable: "x", Operator: "like", Next: "a"}}}}},
+		{Name: "w", StartAt: "a", States: map[string]*State{"a": {Type: PARALLEL, Branches: []*Branch{
+			{Name: "b", StartAt: "x", States: map[string]*State{"x": {Type: "loop"}}}}}}},
+		{Name: "w:1", StartAt: "a", States: map[string]*State{"a": {Type: SUCCEED}}},
+		{Name: "w", StartAt: "a", TimeoutSeconds: -1, States: map[string]*State{"a": {Type: SUCCEED}}},
+	}
+	for i, w := range tests {
+		if err := w.Validate(); err == nil {
+			t.Errorf("workflow %d: expected validation error", i)
+		}
+	}
+}
@@ -0,0 +1,271 @@
+package workflow
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/grussorusso/serverledge/internal/function"
+	"github.com/grussorusso/serverledge/utils"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// Workflow is a state machine whose states invoke functions. The output of
+// each state is the input of the next one.
+type Workflow struct {
+	Name           string // qualified with the namespace (see function.QualifiedName)
+	StartAt        string
+	States         map[string]*State
+	TimeoutSeconds float64 // max. duration of invocations (0 -> unbounded)
+}
+
+// Types of states
+const (
+	TASK     = "task"     // invokes a function
+	PARALLEL = "parallel" // runs branches concurrently, merging their outputs
+	CHOICE   = "choice"   // moves to a state depending on its input
+	SUCCEED  = "succeed"  // terminates the workflow, returning its input
+	FAIL     = "fail"     // terminates the workflow with an error
+)
+
+// State is a step of a workflow. The workflow terminates after states
+// without Next.
+type State struct {
+	Type     string
+	Next     string
+	Function string       // task: reference to the function (e.g., "func@stable")
+	Retry    *RetryPolicy // task: retries upon failure (optional)
+	Branches []*Branch    // parallel
+	Choices  []*Choice    // choice: the first matching rule is applied
+	Default  string       // choice: next state if no rule matches
+	Error    string       // fail
+}
+
+// Branch is a state machine executed by a parallel state. Its output is
+// stored under Name in the output of the parallel state.
+type Branch struct {
+	Name    string
+	StartAt string
+	States  map[string]*State
+}
+
+// RetryPolicy describes how failed tasks are retried.
+type RetryPolicy struct {
+	MaxAttempts int     // including the first one
+	Interval    float64 // seconds before the first retry
+	BackoffRate float64 // multiplier of the interval after each retry (default: 1)
+}
+
+// Choice is a rule comparing a field of the input with a value.
+type Choice struct {
+	Variable string // field of the input; nested fields are separated by "."
+	Operator string // see *_OP
+	Value    interface{}
+	Next     string
+}
+
+// Choice operators
+const (
+	EQ_OP     = "eq"
+	NE_OP     = "ne"
+	LT_OP     = "lt"
+	LE_OP     = "le"
+	GT_OP     = "gt"
+	GE_OP     = "ge"
+	EXISTS_OP = "exists" // the variable is set (Value is ignored)
+)
+
+const workflowPrefix = "/workflow/"
+
+var NotFoundErr = errors.New("workflow not found")
+var AlreadyExistsErr = errors.New("workflow already exists")
+
+func getEtcdKey(name string) string {
+	return workflowPrefix + name
+}
+
+// Validate checks that the workflow is well formed.
+func (w *Workflow) Validate() error {
+	if err := function.ValidateName(w.PlainName()); err != nil {
+		return err
+	}
+	if w.TimeoutSeconds < 0 {
+		return fmt.Errorf("invalid timeout: %v", w.TimeoutSeconds)
+	}
+	return validateStates(w.StartAt, w.States)
+}
+
+func validateStates(startAt string, states map[string]*State) error {
+	if _, ok := states[startAt]; !ok {
+		return fmt.Errorf("unknown start state: '%s'", startAt)
+	}
+	checkNext := func(name string, next string) error {
+		if _, ok := states[next]; next != "" && !ok {
+			return fmt.Errorf("state %s: unknown next state '%s'", name, next)
+		}
+		return nil
+	}
+
+	for name, s := range states {
+		if s == nil {
+			return fmt.Errorf("state %s: empty definition", name)
+		}
+		if err := checkNext(name, s.Next); err != nil {
+			return err
+		}
+		switch s.Type {
+		case TASK:
+			if _, _, _, err := function.ParseReference(s.Function); err != nil || s.Function == "" {
+				return fmt.Errorf("state %s: invalid function '%s'", name, s.Function)
+			}
+			if s.Retry != nil && (s.Retry.Interval < 0 || s.Retry.BackoffRate < 0) {
+				return fmt.Errorf("state %s: invalid retry policy", name)
+			}
+		case PARALLEL:
+			if len(s.Branches) < 1 {
+				return fmt.Errorf("state %s: no branches", name)
+			}
+			names := make(map[string]bool)
+			for _, b := range s.Branches {
+				if b == nil || b.Name == "" || names[b.Name] {
+					return fmt.Errorf("state %s: branches must have distinct names", name)
+				}
+				names[b.Name] = true
+				if err := validateStates(b.StartAt, b.States); err != nil {
+					return fmt.Errorf("state %s, branch %s: %v", name, b.Name, err)
+				}
+			}
+		case CHOICE:
+			if len(s.Choices) < 1 && s.Default == "" {
+				return fmt.Errorf("state %s: no choices", name)
+			}
+			for _, c := range s.Choices {
+				if c == nil || c.Variable == "" || c.Next == "" {
+					return fmt.Errorf("state %s: choices need a variable and a next state", name)
+				}
+				switch c.Operator {
+				case EQ_OP, NE_OP, LT_OP, LE_OP, GT_OP, GE_OP, EXISTS_OP:
+				default:
+					return fmt.Errorf("state %s: unknown operator '%s'", name, c.Operator)
+				}
+				if err := checkNext(name, c.Next); err != nil {
+					return err
+				}
+			}
+			if err := checkNext(name, s.Default); err != nil {
+				return err
+			}
+		case SUCCEED, FAIL:
+		default:
+			return fmt.Errorf("state %s: unknown type '%s'", name, s.Type)
+		}
+	}
+	return nil
+}
+
+// PlainName returns the name of the workflow without its namespace.
+func (w *Workflow) PlainName() string {
+	_, name := function.SplitName(w.Name)
+	return name
+}
+
+// Namespace returns the namespace of the workflow.
+func (w *Workflow) Namespace() string {
+	namespace, _ := function.SplitName(w.Name)
+	return namespace
+}
+
+// SaveToEtcd stores a new workflow.
+func (w *Workflow) SaveToEtcd() error {
+	cli, err := utils.GetEtcdClient()
+	if err != nil {
+		return err
+	}
+	ctx := context.TODO()
+
+	payload, err := json.Marshal(*w)
+	if err != nil {
+		return fmt.Errorf("Could not marshal workflow: %v", err)
+	}
+
+	key := getEtcdKey(w.Name)
+	txnResp, err := cli.Txn(ctx).
+		If(clientv3.Compare(clientv3.CreateRevision(key), "=", 0)).
+		Then(clientv3.OpPut(key, string(payload))).
+		Commit()
+	if err != nil {
+		return fmt.Errorf("Failed Put: %v", err)
+	}
+	if !txnResp.Succeeded {
+		return AlreadyExistsErr
+	}
+	return nil
+}
+
+// Get retrieves a workflow given its (qualified) name.
+func Get(name string) (*Workflow, error) {
+	cli, err := utils.GetEtcdClient()
+	if err != nil {
+		return nil, err
+	}
+	ctx := context.TODO()
+
+	getResponse, err := cli.Get(ctx, getEtcdKey(name))
+	if err != nil {
+		return nil, fmt.Errorf("Failed Get: %v", err)
+	}
+	if len(getResponse.Kvs) < 1 {
+		return nil, NotFoundErr
+	}
+
+	var w Workflow
+	if err = json.Unmarshal(getResponse.Kvs[0].Value, &w); err != nil {
+		return nil, fmt.Errorf("Could not unmarshal workflow: %v", err)
+	}
+	return &w, nil
+}
+
+// Delete removes a workflow given its (qualified) name.
+func Delete(name string) error {
+	cli, err := utils.GetEtcdClient()
+	if err != nil {
+		return err
+	}
+	ctx := context.TODO()
+
+	resp, err := cli.Delete(ctx, getEtcdKey(name))
+	if err != nil {
+		return fmt.Errorf("Failed Delete: %v", err)
+	}
+	if resp.Deleted < 1 {
+		return NotFoundErr
+	}
+	return nil
+}
+
+// GetAll returns the (plain) names of the workflows in a namespace.
+func GetAll(namespace string) ([]string, error) {
+	cli, err := utils.GetEtcdClient()
+	if err != nil {
+		return nil, err
+	}
+	ctx := context.TODO()
+
+	prefix := getEtcdKey(function.QualifiedName(namespace, ""))
+	resp, err := cli.Get(ctx, prefix, clientv3.WithPrefix(), clientv3.WithKeysOnly())
+	if err != nil {
+		return nil, err
+	}
+
+	workflows := make([]string, 0, len(resp.Kvs))
+	for _, s := range resp.Kvs {
+		name := string(s.Key)[len(prefix):]
+		if strings.Contains(name, "/") {
+			continue // workflow in a nested namespace
+		}
+		workflows = append(workflows, name)
+	}
+	return workflows, nil
+}
@@ -0,0 +1,98 @@
+package utils
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+
+	"github.com/grussorusso/serverledge/internal/config"
+)
+
+// Client authentication modes for the API server (see config.TLS_CLIENT_AUTH)
+const (
+	CLIENT_AUTH_NONE     = "none"
+	CLIENT_AUTH_OPTIONAL = "optional"
+	CLIENT_AUTH_REQUIRED = "required"
+)
+
+// TLSEnabled returns true if the API servers use TLS.
+func TLSEnabled() bool {
+	return config.GetString(config.TLS_CERT, "") != ""
+}
+
+// APIScheme returns the URL scheme of the API servers.
+func APIScheme() string {
+	if TLSEnabled() {
+		return "https"
+	}
+	return "http"
+}
+
+// ServerTLSConfig returns the TLS configuration of the API server, or nil
+// if TLS is disabled.
+func ServerTLSConfig() (*tls.Config, error) {
+	if !TLSEnabled() {
+		return nil, nil
+	}
+	tlsConfig, err := LoadTLSConfig(config.GetString(config.TLS_CERT, ""), config.GetString(config.TLS_KEY, ""),
+		config.GetString(config.TLS_CA, ""))
+	if err != nil {
+		return nil, err
+	}
+
+	switch mode := config.GetString(config.TLS_CLIENT_AUTH, CLIENT_AUTH_NONE); mode {
+	case CLIENT_AUTH_NONE:
+		tlsConfig.ClientAuth = tls.NoClientCert
+	case CLIENT_AUTH_OPTIONAL:
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	case CLIENT_AUTH_REQUIRED:
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	default:
+		return nil, fmt.Errorf("invalid client authentication mode: %s", mode)
+	}
+	if tlsConfig.ClientAuth != tls.NoClientCert && tlsConfig.ClientCAs == nil {
+		return nil, fmt.Errorf("client authentication requires a CA")
+	}
+	return tlsConfig, nil
+}
+
+// ClientTLSConfig returns the TLS configuration used to contact the API
+// servers of other nodes, or nil if TLS is disabled. The certificate of
+// the node is presented for mutual authentication.
+func ClientTLSConfig() (*tls.Config, error) {
+	if !TLSEnabled() {
+		return nil, nil
+	}
+	return LoadTLSConfig(config.GetString(config.TLS_CERT, ""), config.GetString(config.TLS_KEY, ""),
+		config.GetString(config.TLS_CA, ""))
+}
+
+// LoadTLSConfig creates a TLS configuration with the given certificate
+// and CA (both optional), used to verify both servers and clients.
+func LoadTLSConfig(certFile string, keyFile string, caFile string) (*tls.Config, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if certFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not load certificate: %v", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	if caFile != "" {
+		caCert, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not read CA certificate: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caCert) {
+			return nil, fmt.Errorf("invalid CA certificate: %s", caFile)
+		}
+		tlsConfig.RootCAs = pool
+		tlsConfig.ClientCAs = pool
+	}
+
+	return tlsConfig, nil
+}